@@ -0,0 +1,168 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "text/tabwriter"
+    "github.com/eliaonceagain/suptext/src"
+)
+
+// Batch row states
+const (
+    batchConverted = "converted"
+    batchWarnings = "warnings"
+    batchSkipped = "skipped"
+    batchFailed = "failed"
+    batchCancelled = "cancelled"
+)
+
+// batchRow is the outcome of an input of a batch
+type batchRow struct {
+    Input string
+    Status string
+    Cues int
+    Warnings int
+    Detail string
+    Code int
+}
+
+// batch converts the inputs below root with jobs inputs at once, mirroring their folders in
+// output if set. Inputs done according to the manifest are skipped, those not started once ctx is
+// done are cancelled. Prints a summary table and returns the exit code, that of the failures if
+// they agree.
+func (c *conversion) batch(ctx context.Context, root string, output string, manifest_path string, jobs int) int {
+    if info, err := os.Stat(root); err != nil || !info.IsDir() {
+        fatalf(exitUsage, "--recursive needs a directory, got %s", root)
+    }
+    if output == "-" {
+        fatal(exitUsage, "--recursive can't write to stdout")
+    }
+    if !suptext.TesseractSupported && (c.Opts.Engine == "" || c.Opts.Engine == suptext.EngineTesseract) {
+        fatal(exitOCR, suptext.ErrNoTesseract)
+    }
+    inputs, err := suptext.FindInputs(root)
+    if err != nil {
+        fatalf(exitIO, "Failed to list inputs: %v", err)
+    }
+    if manifest_path == "" {
+        manifest_path = filepath.Join(root, suptext.DefaultManifestName)
+    }
+    manifest, err := suptext.LoadManifest(manifest_path)
+    if err != nil {
+        fatal(exitIO, err)
+    }
+    log.Printf("Converting %d inputs below %s", len(inputs), root)
+
+    // Inputs run in parallel instead of their tracks, trainers of the same glyph database
+    // would overwrite each other's glyphs
+    c.Jobs = 1
+    if jobs <= 0 || c.Opts.TrainGlyphs {
+        jobs = 1
+    }
+    rows := make([]batchRow, len(inputs))
+    sem := make(chan struct{}, jobs)
+    var wg sync.WaitGroup
+    for i, fname := range inputs {
+        sem <- struct{}{}
+        if ctx.Err() != nil {
+            <-sem
+            rows[i] = batchRow{Input: fname, Status: batchCancelled, Code: exitCancelled, Detail: "not started"}
+            if rel, err := filepath.Rel(root, fname); err == nil {
+                rows[i].Input = rel
+            }
+            continue
+        }
+        wg.Add(1)
+        go func(i int, fname string) {
+            defer func() { <-sem; wg.Done() }()
+            rows[i] = c.batchInput(ctx, root, fname, output, manifest)
+        }(i, fname)
+    }
+    wg.Wait()
+    return printBatch(rows)
+}
+
+// batchInput converts an input of a batch and records it in the manifest
+func (c *conversion) batchInput(ctx context.Context, root string, fname string, output string, manifest *suptext.Manifest) batchRow {
+    row := batchRow{Input: fname}
+    if rel, err := filepath.Rel(root, fname); err == nil {
+        row.Input = rel
+    }
+    if entry, ok := manifest.Done(fname); ok {
+        row.Status, row.Cues, row.Warnings = batchSkipped, entry.Cues, len(entry.Warnings)
+        row.Detail = "done in a previous run"
+        return row
+    }
+
+    dir, err := mirrorDir(root, fname, output)
+    if err != nil {
+        row.Status, row.Code, row.Detail = batchFailed, exitIO, err.Error()
+        return row
+    }
+    res, err := c.run(ctx, fname, dir)
+    entry := suptext.ManifestEntry{Status: suptext.BatchDone, Outputs: res.Outputs, Cues: res.Cues, Warnings: res.Warnings}
+    row.Cues, row.Warnings = res.Cues, len(res.Warnings)
+    switch {
+    case exitCode(err) == exitCancelled:
+        log.Printf("Cancelled converting %s: %v", fname, err)
+        entry.Status, entry.Error = suptext.BatchCancelled, err.Error()
+        row.Status, row.Code, row.Detail = batchCancelled, exitCancelled, err.Error()
+    case err != nil:
+        log.Printf("Failed to convert %s: %v", fname, err)
+        entry.Status, entry.Error = suptext.BatchFailed, err.Error()
+        row.Status, row.Code, row.Detail = batchFailed, exitCode(err), err.Error()
+    case res.Skipped:
+        row.Status, row.Detail = batchSkipped, "subtitle files are newer"
+    case len(res.Warnings) > 0:
+        row.Status, row.Detail = batchWarnings, res.Warnings[0]
+    default:
+        row.Status, row.Detail = batchConverted, strings.Join(res.Outputs, ", ")
+    }
+    if err := manifest.Record(fname, entry); err != nil {
+        log.Printf("Warning: Failed to save batch manifest: %v", err)
+    }
+    return row
+}
+
+// mirrorDir creates the folder of fname below root in output and returns it with a trailing
+// separator, empty without output to write next to the input
+func mirrorDir(root string, fname string, output string) (string, error) {
+    if output == "" {
+        return "", nil
+    }
+    rel, err := filepath.Rel(root, filepath.Dir(fname))
+    if err != nil {
+        rel = ""
+    }
+    dir := filepath.Join(output, rel) + string(filepath.Separator)
+    return dir, os.MkdirAll(dir, 0755)
+}
+
+// printBatch prints the summary table of a batch and returns its exit code
+func printBatch(rows []batchRow) int {
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(w, "INPUT\tSTATUS\tCUES\tWARNINGS\tDETAIL")
+    counts := map[string]int{}
+    code := 0
+    for _, r := range rows {
+        fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", r.Input, r.Status, r.Cues, r.Warnings, r.Detail)
+        counts[r.Status]++
+        if r.Status != batchFailed && r.Status != batchCancelled {
+            continue
+        }
+        if code == 0 {
+            code = r.Code
+        } else if code != r.Code {
+            code = exitError
+        }
+    }
+    w.Flush()
+    fmt.Printf("%d converted, %d with warnings, %d skipped, %d failed, %d cancelled\n",
+        counts[batchConverted], counts[batchWarnings], counts[batchSkipped], counts[batchFailed], counts[batchCancelled])
+    return code
+}
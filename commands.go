@@ -0,0 +1,195 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "strings"
+    "text/tabwriter"
+    "github.com/eliaonceagain/suptext/src"
+)
+
+// inspectCommand prints the segments of a SUP file or video track as a table or JSON lines, with
+// their display set and epoch
+func inspectCommand(args []string) {
+    fs := newFlagSet("inspect", "<input|->")
+    format := fs.String("format", "table", "Output format: table, or json for a JSON line per segment")
+    start := fs.String("start", "", "Only segments from this PTS, e.g. 01:30 or 90.5")
+    end := fs.String("end", "", "Only segments before this PTS")
+    types := fs.String("type", "", "Only segments of these types joined by ',', e.g. pcs,ods")
+    lang := fs.String("lang", suptext.DefaultLanguages, "Subtitle track languages joined by '+'")
+    tracks := addTrackFlags(fs)
+    fs.Parse(args)
+    fname := singleInput(fs)
+    policy := tracks.policy(*lang)
+
+    var filter suptext.SegmentFilter
+    var err error
+    if *start != "" {
+        if filter.Start, err = suptext.ParseTimecode(*start); err != nil {
+            fatal(exitUsage, err)
+        }
+    }
+    if *end != "" {
+        if filter.End, err = suptext.ParseTimecode(*end); err != nil {
+            fatal(exitUsage, err)
+        }
+    }
+    if *types != "" {
+        for _, name := range strings.Split(*types, ",") {
+            typ, err := suptext.ParseSegmentType(strings.TrimSpace(name))
+            if err != nil {
+                fatal(exitUsage, err)
+            }
+            filter.Types = append(filter.Types, typ)
+        }
+    }
+
+    var print func(info suptext.SegmentInfo) error
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    switch *format {
+    case "table":
+        fmt.Fprintln(w, "EPOCH\tSET\tOFFSET\tTYPE\tSIZE\tPTS\tPTS TIME\tDTS\tDTS TIME\tFIELDS")
+        // Epochs and display sets are numbered at their first segment
+        epoch, set := -1, -1
+        print = func(info suptext.SegmentInfo) error {
+            epoch_col, set_col, offset := "", "", "-"
+            if info.Epoch != epoch {
+                epoch, epoch_col = info.Epoch, fmt.Sprint(info.Epoch)
+            }
+            if info.DisplaySet != set {
+                set, set_col = info.DisplaySet, fmt.Sprint(info.DisplaySet)
+            }
+            if info.Offset >= 0 {
+                offset = fmt.Sprintf("0x%08x", info.Offset)
+            }
+            _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%d\t%s\t%s\n", epoch_col, set_col, offset, info.Type,
+                info.Size, info.PTS, info.PTSTime, info.DTS, info.DTSTime, info.Fields.String())
+            return err
+        }
+    case "json":
+        enc := json.NewEncoder(os.Stdout)
+        print = func(info suptext.SegmentInfo) error {
+            return enc.Encode(info)
+        }
+    default:
+        fatalf(exitUsage, "Unknown inspect format '%s' (expected table or json)", *format)
+    }
+    var write_err error
+    emit := func(info suptext.SegmentInfo) error {
+        if !filter.Match(info) {
+            return nil
+        }
+        write_err = print(info)
+        return write_err
+    }
+
+    in := mustOpenInput(fname)
+    defer in.Close()
+    if in.Demuxer == nil {
+        err = suptext.InspectSUP(in.reader, emit)
+    } else {
+        err = inspectTrack(in, policy, emit)
+    }
+    if err := w.Flush(); err != nil && write_err == nil {
+        write_err = err
+    }
+    switch {
+    case write_err != nil:
+        fatal(exitIO, write_err)
+    case err != nil && exitCode(err) == exitError:
+        fatal(exitParse, err)
+    case err != nil:
+        fatal(exitCode(err), err)
+    }
+}
+
+// inspectTrack calls emit with the segments of the track of in picked by policy, in stream order
+func inspectTrack(in *input, policy suptext.TrackPolicy, emit func(suptext.SegmentInfo) error) error {
+    inspectors := map[uint64]*suptext.SegmentInspector{}
+    // The policy may pick the largest track, so the segments of every candidate are kept
+    segments := map[uint64][]suptext.SegmentInfo{}
+    err := suptext.SetSegmentHook(in.Demuxer, func(track uint64, section suptext.Section, data []byte) {
+        s, ok := inspectors[track]
+        if !ok {
+            s = &suptext.SegmentInspector{}
+            inspectors[track] = s
+        }
+        segments[track] = append(segments[track], s.InspectSection(section, data))
+    })
+    if err != nil {
+        return withCode(exitUsage, err)
+    }
+    t, _, err := suptext.SelectTrack(in.Demuxer, policy)
+    if err != nil {
+        return withCode(exitParse, err)
+    }
+    log.Printf("Using track %d: %s %s %q", t.ID, t.Language, t.Flags(), t.Name)
+    for _, info := range segments[t.ID] {
+        if err := emit(info); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// exportImagesCommand saves the subtitle of each epoch start as <dir>/<index>.png
+func exportImagesCommand(args []string) {
+    fs := newFlagSet("export-images", "<input|->")
+    var output string
+    fs.StringVar(&output, "output", "", "Image directory (default <name>_images next to the input)")
+    fs.StringVar(&output, "o", "", "Shorthand for -output")
+    forced_only := fs.Bool("forced-only", false, "Only export subtitles containing forced objects")
+    lang := fs.String("lang", suptext.DefaultLanguages, "Subtitle track languages joined by '+'")
+    tracks := addTrackFlags(fs)
+    fs.Parse(args)
+    fname := singleInput(fs)
+    policy := tracks.policy(*lang)
+
+    in := mustOpenInput(fname)
+    defer in.Close()
+    pgs := in.mustRead(policy)
+    if output == "" {
+        output = fmt.Sprintf("%s_images", in.Base())
+    }
+    count, err := pgs.ExportImages(output, *forced_only)
+    if err != nil {
+        fatal(exitIO, err)
+    }
+    log.Printf("Saved %d images to %s", count, filepath.Clean(output))
+}
+
+// validateCommand lists the display sets that would lose or garble their subtitle, exiting with
+// exitParse if there are any
+func validateCommand(args []string) {
+    fs := newFlagSet("validate", "<input|->")
+    lang := fs.String("lang", suptext.DefaultLanguages, "Subtitle track languages joined by '+'")
+    tracks := addTrackFlags(fs)
+    fs.Parse(args)
+    fname := singleInput(fs)
+    policy := tracks.policy(*lang)
+
+    in := mustOpenInput(fname)
+    defer in.Close()
+    pgs := in.mustRead(policy)
+    problems := pgs.Validate()
+    for _, p := range problems {
+        fmt.Println(p.String())
+    }
+    if len(problems) > 0 {
+        fatalf(exitParse, "Found %d problems in %d display sets", len(problems), len(pgs.Sections))
+    }
+    log.Printf("No problems in %d display sets", len(pgs.Sections))
+}
+
+// tracksCommand lists the PGS tracks of a video or Blu-ray folder
+func tracksCommand(args []string) {
+    fs := newFlagSet("tracks", "<input>")
+    lang := fs.String("lang", suptext.DefaultLanguages, "Subtitle track languages joined by '+'")
+    tracks := addTrackFlags(fs)
+    fs.Parse(args)
+    fname := singleInput(fs)
+    listTracks(fname, tracks.policy(*lang))
+}
@@ -2,49 +2,1055 @@ package main
 
 import (
     "bufio"
+    "context"
+    "errors"
+    "flag"
     "fmt"
     "log"
     "os"
+    "os/signal"
     "path/filepath"
+    "runtime"
     "strings"
+    "sync"
+    "syscall"
+    "text/tabwriter"
+    "time"
     "github.com/eliaonceagain/suptext/src"
 )
 
+// Exit codes, flag parsing errors exit with exitUsage too
+const (
+    exitError = 1 // Any other error
+    exitUsage = 2 // Invalid command line
+    exitParse = 3 // Invalid subtitles, container or Blu-ray folder
+    exitOCR = 4 // OCR setup failed or objects failed to recognize
+    exitIO = 5 // Reading input or writing output files failed
+    exitCancelled = 6 // Timed out or interrupted, the cues recognized so far were written
+)
+
+// Overwrite policies of existing subtitle files
+const (
+    overwriteAlways = "always"
+    overwriteNever = "never"
+    overwriteSkip = "skip"
+    overwriteOlder = "older"
+)
+
+// commands by name, convert is run when the first argument isn't one
+var commands = map[string]func(args []string){
+    "convert": convertCommand,
+    "inspect": inspectCommand,
+    "export-images": exportImagesCommand,
+    "validate": validateCommand,
+    "tracks": tracksCommand,
+    "watch": watchCommand,
+    "serve": serveCommand,
+    "cache": cacheCommand,
+    "glyphs": glyphsCommand,
+}
+
 func main() {
-    // Read input file name
-    args := os.Args
-    if len(args) == 1 {
-        log.Fatal("Missing fname input")
-    } else if len(args) > 2 {
-        log.Fatal(args[0], " supports a single file input")
+    args := os.Args[1:]
+    if len(args) > 0 && (args[0] == "help" || args[0] == "--help") {
+        usage()
+        return
     }
-    fname := args[1]
-    log.Printf("Reading SUP file: %s", fname)
+    if len(args) > 0 && commands[args[0]] != nil {
+        commands[args[0]](args[1:])
+        return
+    }
+    convertCommand(args)
+}
 
-    // Open input file
-    fin, err := os.Open(fname)
-    if err != nil {
-        log.Fatal(err)
+func usage() {
+    fmt.Fprintf(os.Stderr, `Usage: %s [command] [options] <input|->
+
+Commands:
+  convert        Recognize subtitles into SRT, VTT or ASS files (default)
+  inspect        Print the segments of the subtitles with their offsets, timestamps and fields
+  export-images  Save each subtitle as a PNG image
+  validate       Report display sets that are missing segments or fail to decode
+  tracks         List the PGS tracks of a video or Blu-ray folder
+  watch          Convert the inputs dropped into directories until interrupted
+  serve          Run an HTTP service converting uploaded SUP files
+  cache prune    Prune the persistent OCR cache
+  glyphs         Import or export glyph databases
+
+Run '%s <command> -h' for the options of a command.
+Exit codes: 1 error, 2 usage, 3 invalid input, 4 OCR failed, 5 I/O error, 6 timed out or interrupted
+`, os.Args[0], os.Args[0])
+}
+
+// fatal logs v and exits with code
+func fatal(code int, v ...interface{}) {
+    log.Print(v...)
+    os.Exit(code)
+}
+
+func fatalf(code int, format string, v ...interface{}) {
+    log.Printf(format, v...)
+    os.Exit(code)
+}
+
+// codeError is an error with the exit code it ends the process with
+type codeError struct {
+    Code int
+    Err error
+}
+
+func (e *codeError) Error() string {
+    return e.Err.Error()
+}
+
+// errorf returns an error exiting with code
+func errorf(code int, format string, v ...interface{}) error {
+    return &codeError{Code: code, Err: fmt.Errorf(format, v...)}
+}
+
+// withCode returns err exiting with code, nil if err is nil
+func withCode(code int, err error) error {
+    if err == nil {
+        return nil
+    }
+    return &codeError{Code: code, Err: err}
+}
+
+// exitCode returns the exit code of err, exitError if it has none
+func exitCode(err error) int {
+    var e *codeError
+    if errors.As(err, &e) {
+        return e.Code
+    }
+    return exitError
+}
+
+// cancelReason describes why ctx is done
+func cancelReason(ctx context.Context) string {
+    if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+        return "Timed out"
     }
-    defer fin.Close()
+    return "Interrupted"
+}
+
+// interruptContext returns a context done on the first interrupt or termination signal, a second
+// one kills at once
+func interruptContext() (context.Context, context.CancelFunc) {
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    go func() {
+        <-ctx.Done()
+        stop()
+    }()
+    return ctx, stop
+}
+
+// newFlagSet returns the flag set of a command, its usage lists the command's arguments
+func newFlagSet(name string, args string) *flag.FlagSet {
+    fs := flag.NewFlagSet(name, flag.ExitOnError)
+    fs.Usage = func() {
+        fmt.Fprintf(fs.Output(), "Usage: %s %s [options] %s\n", os.Args[0], name, args)
+        fs.PrintDefaults()
+    }
+    return fs
+}
+
+// isSet reports whether the flag name was given on the command line
+func isSet(fs *flag.FlagSet, name string) bool {
+    set := false
+    fs.Visit(func(f *flag.Flag) {
+        set = set || f.Name == name
+    })
+    return set
+}
 
+// trackFlags are the options picking the PGS track of a video
+type trackFlags struct {
+    Policy suptext.TrackPolicy
+    Languages string
+}
+
+func addTrackFlags(fs *flag.FlagSet) *trackFlags {
+    t := &trackFlags{}
+    fs.Uint64Var(&t.Policy.ID, "track", 0, "Matroska track number or transport stream PID, e.g. 0x1200, of the PGS subtitles (default picked by the track options)")
+    fs.StringVar(&t.Languages, "track-lang", "", "Preferred subtitle track languages joined by '+', the first one having tracks is used (default -lang)")
+    fs.StringVar(&t.Policy.Forced, "track-forced", suptext.TrackAvoid, "Forced subtitle tracks: prefer, avoid or any")
+    fs.StringVar(&t.Policy.SDH, "track-sdh", suptext.TrackAny, "SDH subtitle tracks: prefer, avoid or any")
+    fs.BoolVar(&t.Policy.Largest, "track-largest", true, "Pick the largest of the remaining tracks instead of the default one")
+    return t
+}
+
+// policy returns the validated track policy, preferring the OCR languages without -track-lang
+func (t *trackFlags) policy(languages string) suptext.TrackPolicy {
+    if t.Languages != "" {
+        languages = t.Languages
+    }
+    policy := t.Policy
+    policy.Languages = strings.Split(languages, "+")
+    for _, pref := range []string{policy.Forced, policy.SDH} {
+        if err := suptext.ValidateTrackPreference(pref); err != nil {
+            fatal(exitUsage, err)
+        }
+    }
+    return policy
+}
+
+// singleInput returns the input argument of a command
+func singleInput(fs *flag.FlagSet) string {
+    switch fs.NArg() {
+    case 0:
+        fs.Usage()
+        fatal(exitUsage, "Missing input file")
+    case 1:
+        return fs.Arg(0)
+    }
+    fatal(exitUsage, os.Args[0], " supports a single file input")
+    return ""
+}
+
+// input is an opened SUP file, Matroska file, transport stream or Blu-ray folder
+type input struct {
+    Name string
+    // Nil for SUP files
+    Demuxer suptext.Demuxer
+    BDMV string
+    reader *bufio.Reader
+    file *os.File
+    // Stops reading once done
+    ctx context.Context
+    // Counts the segments read if not nil
+    progress *suptext.ProgressTracker
+}
+
+// openInput opens fname, stdin for "-", and the demuxer of containers and Blu-ray folders.
+// Reading fails once ctx is done.
+func openInput(ctx context.Context, fname string) (*input, error) {
+    in := &input{Name: fname, ctx: ctx}
+    if fname != "-" {
+        if dir, ok := suptext.FindBDMV(fname); ok {
+            b, err := suptext.OpenBDMV(dir)
+            if err != nil {
+                return nil, errorf(exitParse, "Failed to read Blu-ray folder: %v", err)
+            }
+            log.Printf("Reading playlist %s (%s) with %d PGS streams", b.Playlist.Name, suptext.FormatMilliseconds(b.Playlist.Duration()), len(b.Playlist.PGSStreams()))
+            in.BDMV, in.Demuxer = dir, b
+            return in, nil
+        }
+    }
+
+    in.file = os.Stdin
+    if fname != "-" {
+        var err error
+        if in.file, err = os.Open(fname); err != nil {
+            return nil, withCode(exitIO, err)
+        }
+    }
     // Create a buffered reader
-    r := bufio.NewReader(fin)
-    pgs, err := suptext.ReadPGS(r)
+    in.reader = bufio.NewReader(suptext.NewContextReader(ctx, in.file))
+    d, err := suptext.OpenDemuxer(in.reader)
     if err != nil {
-        log.Fatalf("Failed parsing segment header: %s", err)
+        in.Close()
+        return nil, errorf(exitParse, "Failed to read container: %v", err)
+    }
+    in.Demuxer = d
+    return in, nil
+}
+
+// mustOpenInput opens fname or exits
+func mustOpenInput(fname string) *input {
+    in, err := openInput(context.Background(), fname)
+    if err != nil {
+        fatal(exitCode(err), err)
+    }
+    return in
+}
+
+func (in *input) Close() {
+    if in.file != nil && in.file != os.Stdin {
+        in.file.Close()
+    }
+}
+
+// Base returns the input name without extension, outputs are named after it. Blu-ray folders
+// are named after the disc root, the folder containing BDMV.
+func (in *input) Base() string {
+    if in.BDMV != "" {
+        root := filepath.Clean(in.BDMV)
+        if strings.EqualFold(filepath.Base(root), "BDMV") {
+            root = filepath.Dir(root)
+        }
+        return root
+    }
+    if in.Name == "-" {
+        return "stdin"
     }
+    return strings.TrimSuffix(in.Name, filepath.Ext(in.Name))
+}
 
-    // Open output file SRT
-    srt_fname := fmt.Sprintf("%s.srt", strings.TrimSuffix(fname, filepath.Ext(fname)))
-    fout, err := os.Create(srt_fname)
+// read returns the subtitles of a SUP file, or the track of a container picked by policy
+func (in *input) read(policy suptext.TrackPolicy) (suptext.PGS, error) {
+    if in.Demuxer != nil {
+        log.Printf("Reading video file: %s", in.Name)
+        t, pgs, err := suptext.SelectTrack(in.Demuxer, policy)
+        if err != nil && in.ctx.Err() != nil {
+            return pgs, errorf(exitCancelled, "%s reading %s", cancelReason(in.ctx), in.Name)
+        } else if err != nil {
+            return pgs, withCode(exitParse, err)
+        }
+        log.Printf("Using track %d: %s %s %q", t.ID, t.Language, t.Flags(), t.Name)
+        return pgs, nil
+    }
+    log.Printf("Reading SUP file: %s", in.Name)
+    pgs, err := suptext.ReadPGSProgress(in.ctx, in.reader, in.progress)
+    if err != nil && in.ctx.Err() != nil {
+        return pgs, errorf(exitCancelled, "%s reading %s", cancelReason(in.ctx), in.Name)
+    } else if err != nil {
+        return pgs, errorf(exitParse, "Failed parsing segment header: %s", err)
+    }
+    return pgs, nil
+}
+
+// mustRead reads the subtitles picked by policy or exits
+func (in *input) mustRead(policy suptext.TrackPolicy) suptext.PGS {
+    pgs, err := in.read(policy)
     if err != nil {
-        log.Fatalf("Failed to create file: %v", err)
+        fatal(exitCode(err), err)
+    }
+    return pgs
+}
+
+// ocrFlags are the recognition options of the commands converting subtitles
+type ocrFlags struct {
+    fs *flag.FlagSet
+    opts suptext.Options
+    vars variablesFlag
+    use_cache bool
+    cache_max_size string
+    config string
+}
+
+func addOCRFlags(fs *flag.FlagSet) *ocrFlags {
+    f := &ocrFlags{fs: fs, vars: variablesFlag{}}
+    opts := &f.opts
+    fs.BoolVar(&opts.KeepColors, "colors", false, "Keep non white/yellow text colors, e.g. as <font> tags in SRT")
+    fs.BoolVar(&opts.ForcedOnly, "forced-only", false, "Only output cues containing forced subtitles, e.g. foreign language dialogue")
+    fs.StringVar(&opts.Languages, "lang", suptext.DefaultLanguages, "OCR languages joined by '+', e.g. deu+eng")
+    fs.StringVar(&opts.TessdataPrefix, "tessdata", "", "Directory containing traineddata files (default $TESSDATA_PREFIX)")
+    fs.StringVar(&opts.Model, "model", "", "Tesseract model: fast, best or legacy (default installed models)")
+    fs.IntVar(&opts.PageSegMode, "psm", 0, "Tesseract page segmentation mode 1-13, e.g. 6 for a single block (default Tesseract's)")
+    fs.StringVar(&opts.Whitelist, "whitelist", "", "Only recognize these characters")
+    fs.StringVar(&opts.Blacklist, "blacklist", "", "Never recognize these characters")
+    fs.StringVar(&opts.UserWords, "user-words", "", "Tesseract user words file, e.g. character names")
+    fs.StringVar(&opts.UserPatterns, "user-patterns", "", "Tesseract user patterns file")
+    fs.Var(f.vars, "var", "Tesseract variable as name=value, may be repeated")
+    fs.BoolVar(&opts.Fix, "fix", false, "Correct common OCR mistakes with the built-in English rules")
+    fs.StringVar(&opts.Rules, "rules", "", "Correct OCR mistakes with the rules of this file instead of the built-in ones")
+    fs.StringVar(&opts.Dictionary, "dict", "", "Hunspell dictionary to correct unknown words with, e.g. /usr/share/hunspell/en_US")
+    fs.StringVar(&opts.Engine, "engine", suptext.EngineTesseract, "OCR engine: tesseract, glyph or command")
+    fs.StringVar(&opts.GlyphDB, "glyph-db", "", "Glyph database file of the glyph engine")
+    fs.BoolVar(&opts.TrainGlyphs, "train-glyphs", false, "Add the glyphs of words confidently recognized by Tesseract to the glyph database")
+    fs.StringVar(&opts.OCRCommand, "ocr-command", "", "Command of the command engine, reads a PNG on stdin or from the {image} argument")
+    fs.StringVar(&opts.OCRCommandOutput, "ocr-output", suptext.CommandOutputText, "Output of the OCR command: text or json")
+    fs.Float64Var(&opts.OCRTimeout, "ocr-timeout", suptext.DefaultCommandTimeout, "Seconds before an OCR command is killed")
+    fs.IntVar(&opts.OCRJobs, "ocr-jobs", 0, "Maximum number of OCR commands running at once in the process (default number of CPUs)")
+    fs.BoolVar(&f.use_cache, "cache", false, "Keep OCR results in the persistent cache at "+suptext.DefaultCacheDir())
+    fs.StringVar(&opts.CacheDir, "cache-dir", "", "Keep OCR results in the persistent cache at this directory")
+    fs.StringVar(&f.cache_max_size, "cache-max-size", "", "Prune least recently used cache entries above this size, e.g. 500M")
+    fs.Float64Var(&opts.CueTimeout, "cue-timeout", 0, "Seconds the OCR of a cue may take before its remaining text is dropped (default no limit)")
+    fs.StringVar(&f.config, "config", "", "JSON config file with OCR options, overridden by command line flags")
+    return f
+}
+
+// options returns the recognition options of the parsed flags
+func (f *ocrFlags) options() suptext.Options {
+    var err error
+    // The config file options are replaced by the flags bound to f.opts
+    if f.config != "" {
+        loadConfig(f.fs, f.config, &f.opts)
+    }
+    opts := f.opts
+    for k, v := range f.vars {
+        if opts.Variables == nil {
+            opts.Variables = map[string]string{}
+        }
+        opts.Variables[k] = v
+    }
+    if f.use_cache && opts.CacheDir == "" {
+        opts.CacheDir = suptext.DefaultCacheDir()
+    }
+    if f.cache_max_size != "" {
+        if opts.CacheMaxSize, err = suptext.ParseSize(f.cache_max_size); err != nil {
+            fatal(exitUsage, err)
+        }
+    }
+    return opts
+}
+
+// convertFlags are the options of the commands writing subtitle files
+type convertFlags struct {
+    *ocrFlags
+    Output string
+    AllTracks bool
+    Jobs int
+    tracks *trackFlags
+    format string
+    overwrite string
+    forced bool
+    spell_report string
+    review string
+    threshold float64
+    timeout float64
+}
+
+func addConvertFlags(fs *flag.FlagSet) *convertFlags {
+    f := &convertFlags{ocrFlags: addOCRFlags(fs)}
+    fs.BoolVar(&f.forced, "forced", false, "Also write the forced cues to <name>.forced.<format>")
+    fs.StringVar(&f.Output, "output", "", "Subtitle file, directory or - for stdout (default <name>.<format> next to the input, stdout for stdin)")
+    fs.StringVar(&f.Output, "o", "", "Shorthand for -output")
+    fs.StringVar(&f.format, "format", "", "Output format: srt, vtt or ass (default the -output extension, else srt)")
+    fs.StringVar(&f.overwrite, "overwrite", overwriteAlways, "Existing subtitle files: always overwrite, never (fail), skip converting, or older overwrites those older than their input (default older with --recursive)")
+    f.tracks = addTrackFlags(fs)
+    fs.BoolVar(&f.AllTracks, "all-tracks", false, "Convert every PGS track of a video to <name>.<lang>[.forced][.sdh].<format>")
+    fs.IntVar(&f.Jobs, "jobs", runtime.NumCPU(), "Inputs converted at once with --recursive and watch, otherwise tracks of --all-tracks and Blu-ray folders")
+    fs.StringVar(&f.spell_report, "spell-report", "", "Write the unknown words left after spell checking to this file")
+    fs.StringVar(&f.review, "review", "", "Write cues recognized below the review threshold to this file")
+    fs.Float64Var(&f.threshold, "review-threshold", suptext.DefaultReviewThreshold, "Lowest accepted word confidence (0-100)")
+    fs.Float64Var(&f.timeout, "timeout", 0, "Seconds the conversion of an input may take, the cues recognized so far are written (default no limit)")
+    return f
+}
+
+// conversion returns the conversion of the parsed flags, using the overwrite policy unless
+// --overwrite is given
+func (f *convertFlags) conversion(overwrite string) *conversion {
+    opts := f.options()
+    if f.forced && opts.ForcedOnly {
+        fatal(exitUsage, "--forced and --forced-only can't be combined")
+    }
+    if isSet(f.fs, "overwrite") {
+        overwrite = f.overwrite
     }
-    defer fout.Close()
+    switch overwrite {
+    case overwriteAlways, overwriteNever, overwriteSkip, overwriteOlder:
+    default:
+        fatalf(exitUsage, "Unknown overwrite policy '%s' (expected %s, %s, %s or %s)", overwrite, overwriteAlways, overwriteNever, overwriteSkip, overwriteOlder)
+    }
+    format := f.format
+    if format == "" {
+        format = suptext.FormatOfFile(f.Output)
+    }
+    if format == "" {
+        format = suptext.FormatSRT
+    }
+    if err := suptext.ValidateFormat(format); err != nil {
+        fatal(exitUsage, err)
+    }
+    if f.timeout < 0 || opts.CueTimeout < 0 {
+        fatal(exitUsage, "--timeout and --cue-timeout can't be negative")
+    }
+    return &conversion{
+        Opts: opts,
+        Out: outputs{
+            Format: format,
+            Overwrite: overwrite,
+            Forced: f.forced,
+            Review: f.review,
+            ReviewThreshold: f.threshold,
+            SpellReport: f.spell_report,
+        },
+        Policy: f.tracks.policy(opts.Languages),
+        AllTracks: f.AllTracks,
+        Jobs: f.Jobs,
+        Timeout: time.Duration(f.timeout * float64(time.Second)),
+    }
+}
 
-    // Dump SRT
-    log.Printf("Writing SRT file: %s", srt_fname)
-    pgs.ToSRT(fout)
+// convertCommand recognizes the subtitles of a file, video or Blu-ray folder
+func convertCommand(args []string) {
+    fs := newFlagSet("convert", "<input|->")
+    fs.Usage = func() {
+        usage()
+        fmt.Fprintf(fs.Output(), "\nConvert options:\n")
+        fs.PrintDefaults()
+    }
+    flags := addConvertFlags(fs)
+    recursive := fs.Bool("recursive", false, "Convert the SUP files, videos and Blu-ray folders below the input directory")
+    manifest := fs.String("manifest", "", "Batch manifest resuming interrupted --recursive conversions (default <dir>/"+suptext.DefaultManifestName+")")
+    list_tracks := fs.Bool("list-tracks", false, "List the PGS subtitle tracks of a video or Blu-ray folder and the one the track options pick")
+    progress := fs.String("progress", progressAuto, "Progress of single inputs: bar, log lines every 10s, off, or auto for a bar on terminals and log lines otherwise")
+    fs.Parse(args)
+    fname := singleInput(fs)
+    if *list_tracks && *recursive {
+        fatal(exitUsage, "--list-tracks and --recursive can't be combined")
+    }
+    overwrite := overwriteAlways
+    if *recursive {
+        overwrite = overwriteOlder
+    }
+    c := flags.conversion(overwrite)
+    if *list_tracks {
+        listTracks(fname, c.Policy)
+        return
+    }
+
+    ctx, stop := interruptContext()
+    defer stop()
+    if *recursive {
+        code := c.batch(ctx, fname, flags.Output, *manifest, flags.Jobs)
+        stop()
+        os.Exit(code)
+    }
+    display, tracker := newProgressDisplay(*progress)
+    c.Progress = tracker
+    res, err := c.run(ctx, fname, flags.Output)
+    display.finish()
+    if err != nil {
+        fatal(exitCode(err), err)
+    }
+    if res.OCRErrors > 0 {
+        fatalf(exitOCR, "Failed to recognize %d objects", res.OCRErrors)
+    }
     log.Println("Success")
 }
+
+// conversion converts inputs with the same options
+type conversion struct {
+    Opts suptext.Options
+    Out outputs
+    Policy suptext.TrackPolicy
+    // Convert every track of videos, always done for Blu-ray folders
+    AllTracks bool
+    // Tracks recognized at once
+    Jobs int
+    // Time an input may take, no limit if zero
+    Timeout time.Duration
+    // Counts the segments read and cues recognized if not nil
+    Progress *suptext.ProgressTracker
+}
+
+// result is what converting an input gave
+type result struct {
+    Outputs []string
+    Cues int
+    // Objects that failed to recognize, their text is missing
+    OCRErrors int
+    Warnings []string
+    // Nothing was written, the subtitle files exist
+    Skipped bool
+}
+
+// run converts fname into output, the subtitle file or directory, see outputFile. Once ctx is
+// done or the timeout passed, the cues recognized so far are written with an exitCancelled error.
+func (c *conversion) run(ctx context.Context, fname string, output string) (result, error) {
+    if c.Timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+        defer cancel()
+    }
+    in, err := openInput(ctx, fname)
+    if err != nil {
+        return result{}, err
+    }
+    defer in.Close()
+    in.progress = c.Progress
+    if in.Demuxer != nil {
+        suptext.SetProgress(in.Demuxer, c.Progress)
+    }
+    opts := c.Opts
+    opts.Progress = c.Progress
+    if !suptext.TesseractSupported && (c.Opts.Engine == "" || c.Opts.Engine == suptext.EngineTesseract) {
+        return result{}, withCode(exitOCR, suptext.ErrNoTesseract)
+    }
+    out := c.Out
+    if info, err := os.Stat(fname); err == nil && fname != "-" {
+        out.InputTime = info.ModTime()
+    }
+
+    // Blu-ray folders give a subtitle file per PGS stream of the main playlist
+    if in.BDMV != "" || c.AllTracks {
+        if in.Demuxer == nil {
+            return result{}, errorf(exitUsage, "--all-tracks needs a Matroska file, transport stream or Blu-ray folder")
+        }
+        base, err := outputBase(in, output)
+        if err != nil {
+            return result{}, err
+        }
+        if in.BDMV == "" {
+            log.Printf("Reading all tracks of video file: %s", fname)
+        }
+        return convertTracks(ctx, in.Demuxer, opts, base, out, c.Jobs)
+    }
+
+    sub_fname, err := outputFile(in, output, out.Format)
+    if err != nil {
+        return result{}, err
+    }
+    if sub_fname == "-" && out.Forced {
+        return result{}, errorf(exitUsage, "--forced needs a subtitle file output")
+    }
+    if write, err := out.canWrite(sub_fname); err != nil || !write {
+        if err == nil {
+            log.Printf("Skipping existing subtitle file: %s", sub_fname)
+        }
+        return result{Outputs: []string{sub_fname}, Skipped: true}, err
+    }
+    pgs, err := in.read(c.Policy)
+    if err != nil {
+        return result{}, err
+    }
+    return convert(ctx, &pgs, opts, sub_fname, out)
+}
+
+// outputFile returns the subtitle file of a single track: output itself, the input name in the
+// output directory or next to the input, or stdout for stdin
+func outputFile(in *input, output string, format string) (string, error) {
+    if output == "-" || (output == "" && in.Name == "-") {
+        return "-", nil
+    }
+    if output != "" && !isDir(output) {
+        return output, nil
+    }
+    base, err := outputBase(in, output)
+    return fmt.Sprintf("%s.%s", base, format), err
+}
+
+// outputBase returns the base name of the track outputs of in, in the output directory if set
+func outputBase(in *input, output string) (string, error) {
+    if output == "" {
+        if in.Name == "-" {
+            return "", errorf(exitUsage, "--all-tracks of stdin needs an --output directory")
+        }
+        return in.Base(), nil
+    }
+    if !isDir(output) {
+        return "", errorf(exitUsage, "--output must be a directory when converting several tracks")
+    }
+    return filepath.Join(output, filepath.Base(in.Base())), nil
+}
+
+// isDir reports whether path is an existing directory or ends with a separator
+func isDir(path string) bool {
+    if strings.HasSuffix(path, "/") || strings.HasSuffix(path, string(filepath.Separator)) {
+        return true
+    }
+    info, err := os.Stat(path)
+    return err == nil && info.IsDir()
+}
+
+// outputs are the format and policy of subtitle files and the files written next to them
+type outputs struct {
+    Format string
+    Overwrite string
+    // Modification time of the input for the older policy
+    InputTime time.Time
+    Forced bool
+    Review string
+    ReviewThreshold float64
+    SpellReport string
+}
+
+// withSuffix inserts suffix before the extension of the report file names
+func (o outputs) withSuffix(suffix string) outputs {
+    insert := func(fname string) string {
+        if fname == "" {
+            return ""
+        }
+        ext := filepath.Ext(fname)
+        return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(fname, ext), suffix, ext)
+    }
+    o.Review, o.SpellReport = insert(o.Review), insert(o.SpellReport)
+    return o
+}
+
+// canWrite reports whether the subtitle file fname may be written by the overwrite policy, an
+// error if it exists and must never be overwritten
+func (o outputs) canWrite(fname string) (bool, error) {
+    if fname == "-" || o.Overwrite == overwriteAlways {
+        return true, nil
+    }
+    info, err := os.Stat(fname)
+    if err != nil {
+        return true, nil
+    }
+    switch o.Overwrite {
+    case overwriteNever:
+        return false, errorf(exitIO, "Subtitle file already exists: %s", fname)
+    case overwriteOlder:
+        return o.InputTime.IsZero() || info.ModTime().Before(o.InputTime), nil
+    }
+    return false, nil
+}
+
+// markPartial dates the files of a cancelled conversion before the input, so the older policy
+// converts it again
+func (o outputs) markPartial(fnames []string) {
+    if o.InputTime.IsZero() {
+        return
+    }
+    t := o.InputTime.Add(-time.Second)
+    for _, fname := range fnames {
+        if err := os.Chtimes(fname, t, t); err != nil {
+            log.Printf("Warning: Failed to date partial subtitle file: %v", err)
+        }
+    }
+}
+
+// create opens the subtitle file fname for writing, stdout for "-"
+func (o outputs) create(fname string) (*os.File, error) {
+    if fname == "-" {
+        return os.Stdout, nil
+    }
+    flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+    if o.Overwrite == overwriteNever {
+        flags |= os.O_EXCL
+    }
+    f, err := os.OpenFile(fname, flags, 0644)
+    if err != nil {
+        return nil, errorf(exitIO, "Failed to create file: %v", err)
+    }
+    return f, nil
+}
+
+// convert recognizes pgs and writes the subtitle file fname, and <name>.forced.<format> and the
+// reports if enabled. Once ctx is done the cues recognized so far are written.
+func convert(ctx context.Context, pgs *suptext.PGS, opts suptext.Options, fname string, out outputs) (result, error) {
+    var res result
+    for _, p := range pgs.Validate() {
+        res.Warnings = append(res.Warnings, p.String())
+    }
+
+    // Open output subtitle file
+    fout, err := out.create(fname)
+    if err != nil {
+        return res, err
+    }
+    if fout != os.Stdout {
+        defer fout.Close()
+        res.Outputs = append(res.Outputs, fname)
+    }
+
+    // Dump subtitles
+    log.Printf("Writing %s file: %s", strings.ToUpper(out.Format), fname)
+    cues, summary, err := pgs.OCRCuesContext(ctx, opts)
+    if err != nil && !summary.Cancelled {
+        return res, errorf(exitOCR, "Failed to initialize OCR: %v", err)
+    }
+    log.Printf("Recognized %s", summary.String())
+    res.Cues, res.OCRErrors = len(cues), summary.OCRErrors
+    if summary.OCRErrors > 0 {
+        res.Warnings = append(res.Warnings, fmt.Sprintf("%d objects failed to recognize", summary.OCRErrors))
+    }
+    if err := suptext.WriteCues(fout, cues, out.Format); err != nil {
+        return res, withCode(exitIO, err)
+    }
+    if out.Forced {
+        ext := filepath.Ext(fname)
+        forced_fname := fmt.Sprintf("%s.forced%s", strings.TrimSuffix(fname, ext), ext)
+        write, err := out.canWrite(forced_fname)
+        if err != nil {
+            return res, err
+        }
+        if !write {
+            log.Printf("Skipping existing forced subtitle file: %s", forced_fname)
+        } else if written, err := writeForced(cues, forced_fname, out); err != nil {
+            return res, err
+        } else if written {
+            res.Outputs = append(res.Outputs, forced_fname)
+        }
+    }
+
+    // Dump review list, bitmaps are saved next to it
+    if out.Review != "" {
+        if err := writeReview(pgs, cues, out.Review, out.ReviewThreshold); err != nil {
+            return res, err
+        }
+    }
+    if out.SpellReport != "" && summary.Spelling != nil {
+        if err := writeSpellReport(summary.Spelling, out.SpellReport); err != nil {
+            return res, err
+        }
+    }
+    if summary.Cancelled {
+        out.markPartial(res.Outputs)
+        return res, errorf(exitCancelled, "%s after recognizing %d cues, %s has the cues recognized so far", cancelReason(ctx), len(cues), fname)
+    }
+    return res, nil
+}
+
+// convertTracks reads every PGS track of d at once and writes <base>.<lang>[.forced][.sdh].<format>
+// for each, recognizing up to jobs tracks in parallel
+func convertTracks(ctx context.Context, d suptext.Demuxer, opts suptext.Options, base string, out outputs, jobs int) (result, error) {
+    tracks, pgs, err := suptext.ReadAllTracks(d)
+    if err != nil && ctx.Err() != nil {
+        return result{}, errorf(exitCancelled, "%s reading tracks", cancelReason(ctx))
+    } else if err != nil {
+        return result{}, withCode(exitParse, err)
+    }
+    if len(tracks) == 0 {
+        return result{}, errorf(exitParse, "No PGS subtitle tracks found")
+    }
+    // Trainers of the same glyph database would overwrite each other's glyphs
+    if jobs <= 0 || opts.TrainGlyphs {
+        jobs = 1
+    }
+    suffixes := suptext.TrackSuffixes(tracks, out.Forced)
+    sem := make(chan struct{}, jobs)
+    var wg sync.WaitGroup
+    var mu sync.Mutex
+    res := result{Skipped: true}
+    // Every track file is checked before any is written, so a refused one leaves no others behind
+    fnames := make([]string, len(tracks))
+    writes := make([]bool, len(tracks))
+    for i := range tracks {
+        fnames[i] = fmt.Sprintf("%s.%s.%s", base, suffixes[i], out.Format)
+        if writes[i], err = out.canWrite(fnames[i]); err != nil {
+            return res, err
+        }
+    }
+    var first_err error
+    for i, t := range tracks {
+        track_fname := fnames[i]
+        if !writes[i] {
+            log.Printf("Skipping existing subtitle file of track %d: %s", t.ID, track_fname)
+            mu.Lock()
+            res.Outputs = append(res.Outputs, track_fname)
+            mu.Unlock()
+            continue
+        }
+        track_opts := opts
+        track_opts.Languages = suptext.TrackOCRLanguages(t, opts.Languages)
+        track_pgs := pgs[t.ID]
+        track_out := out.withSuffix(suffixes[i])
+        // Forced tracks have nothing but forced cues
+        track_out.Forced = out.Forced && !t.Forced
+        suffix := suffixes[i]
+        log.Printf("Converting track %d (%s, OCR %s): %s", t.ID, suffix, track_opts.Languages, t.Name)
+        sem <- struct{}{}
+        // Tracks not started yet are left out
+        if ctx.Err() != nil {
+            <-sem
+            mu.Lock()
+            if first_err == nil {
+                first_err = errorf(exitCancelled, "%s before converting track %d", cancelReason(ctx), t.ID)
+            }
+            mu.Unlock()
+            break
+        }
+        wg.Add(1)
+        go func() {
+            defer func() { <-sem; wg.Done() }()
+            track_res, err := convert(ctx, &track_pgs, track_opts, track_fname, track_out)
+            mu.Lock()
+            defer mu.Unlock()
+            if err != nil && first_err == nil {
+                first_err = err
+            } else if err != nil {
+                log.Printf("Failed to convert track %s: %v", suffix, err)
+            }
+            res.Skipped = false
+            res.Outputs = append(res.Outputs, track_res.Outputs...)
+            res.Cues += track_res.Cues
+            res.OCRErrors += track_res.OCRErrors
+            for _, w := range track_res.Warnings {
+                res.Warnings = append(res.Warnings, fmt.Sprintf("%s: %s", suffix, w))
+            }
+        }()
+    }
+    wg.Wait()
+    return res, first_err
+}
+
+// listTracks prints the PGS tracks of a container or Blu-ray folder, marking the candidates
+// of the policy and the track it picks
+func listTracks(fname string, policy suptext.TrackPolicy) {
+    in := mustOpenInput(fname)
+    defer in.Close()
+    if in.Demuxer == nil {
+        fatal(exitUsage, "Listing tracks needs a Matroska file, transport stream or Blu-ray folder")
+    }
+
+    tracks, _, err := suptext.ReadAllTracks(in.Demuxer)
+    if err != nil {
+        fatal(exitParse, err)
+    }
+    candidates, err := policy.Candidates(tracks)
+    if err != nil {
+        log.Printf("Warning: %v", err)
+    }
+    var selected uint64
+    if len(candidates) > 0 {
+        selected = policy.Select(candidates).ID
+    }
+    w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+    fmt.Fprintln(w, "ID\tLANG\tSIZE\tFLAGS\tNAME\tPOLICY")
+    for _, t := range tracks {
+        status := ""
+        for _, c := range candidates {
+            if c.ID == t.ID {
+                status = "candidate"
+            }
+        }
+        if t.ID == selected {
+            status = "selected"
+        }
+        fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\n", t.ID, t.Language, t.Size, t.Flags(), t.Name, status)
+    }
+    w.Flush()
+}
+
+// writeForced writes the forced cues of the full output, if any, and reports whether it did
+func writeForced(cues []suptext.Cue, fname string, out outputs) (bool, error) {
+    forced := suptext.ForcedCues(cues)
+    if len(forced) == 0 {
+        log.Printf("No forced cues, skipping: %s", fname)
+        return false, nil
+    }
+    f, err := out.create(fname)
+    if err != nil {
+        return false, err
+    }
+    defer f.Close()
+    log.Printf("Writing %d forced cues to %s file: %s", len(forced), strings.ToUpper(out.Format), fname)
+    if err := suptext.WriteCues(f, forced, out.Format); err != nil {
+        return false, withCode(exitIO, err)
+    }
+    return true, nil
+}
+
+func writeReview(pgs *suptext.PGS, cues []suptext.Cue, fname string, threshold float64) error {
+    frev, err := os.Create(fname)
+    if err != nil {
+        return errorf(exitIO, "Failed to create file: %v", err)
+    }
+    defer frev.Close()
+
+    img_dir := fmt.Sprintf("%s_images", strings.TrimSuffix(fname, filepath.Ext(fname)))
+    count, err := pgs.WriteReview(frev, cues, threshold, img_dir)
+    if err != nil {
+        return withCode(exitIO, err)
+    }
+    log.Printf("Wrote %d of %d cues below confidence %.1f to review file: %s", count, len(cues), threshold, fname)
+    return nil
+}
+
+func writeSpellReport(report *suptext.SpellReport, fname string) error {
+    f, err := os.Create(fname)
+    if err != nil {
+        return errorf(exitIO, "Failed to create file: %v", err)
+    }
+    defer f.Close()
+    if err := report.Write(f); err != nil {
+        return errorf(exitIO, "Failed to write to file: %v", err)
+    }
+    log.Printf("Wrote %d unknown words to spell report: %s", len(report.Unknown), fname)
+    return nil
+}
+
+// cacheCommand runs `cache prune [--cache-dir <dir>] [--max-size <size>]`
+func cacheCommand(args []string) {
+    if len(args) == 0 || args[0] != "prune" {
+        fatal(exitUsage, "Usage: ", os.Args[0], " cache prune [--cache-dir <dir>] [--max-size <size>]")
+    }
+    fs := flag.NewFlagSet("cache prune", flag.ExitOnError)
+    dir := fs.String("cache-dir", suptext.DefaultCacheDir(), "Cache directory")
+    max_size := fs.String("max-size", "0", "Remove least recently used entries above this size, e.g. 500M")
+    fs.Parse(args[1:])
+
+    size, err := suptext.ParseSize(*max_size)
+    if err != nil {
+        fatal(exitUsage, err)
+    }
+    res, err := suptext.PruneCacheDir(*dir, size)
+    if err != nil {
+        fatalf(exitIO, "Failed to prune cache: %v", err)
+    }
+    log.Printf("Removed %d files (%d bytes), %d entries (%d bytes) left in %s", res.Removed, res.Freed, res.Entries, res.Size, *dir)
+}
+
+// glyphsCommand runs `glyphs import <db> <file>...` and `glyphs export [--min-count <n>] <db> <file>`
+func glyphsCommand(args []string) {
+    usage := fmt.Sprint("Usage: ", os.Args[0], " glyphs import <db> <file>... | glyphs export [--min-count <n>] <db> <file|->")
+    if len(args) == 0 {
+        fatal(exitUsage, usage)
+    }
+    fs := flag.NewFlagSet("glyphs "+args[0], flag.ExitOnError)
+    min_count := fs.Int("min-count", 1, "Only export glyphs seen at least this many times")
+    fs.Parse(args[1:])
+    files := fs.Args()
+
+    switch {
+    case args[0] == "import" && len(files) >= 2:
+        db, err := suptext.LoadGlyphDB(files[0])
+        if err != nil {
+            fatal(exitParse, err)
+        }
+        for _, fname := range files[1:] {
+            if _, err := os.Stat(fname); err != nil {
+                fatal(exitIO, err)
+            }
+            other, err := suptext.LoadGlyphDB(fname)
+            if err != nil {
+                fatal(exitParse, err)
+            }
+            db.Merge(other)
+        }
+        if err := db.Save(files[0]); err != nil {
+            fatalf(exitIO, "Failed to save glyph database: %v", err)
+        }
+        log.Printf("Imported %d files, %d glyphs in %s", len(files) - 1, len(db.Entries), files[0])
+    case args[0] == "export" && len(files) == 2:
+        if _, err := os.Stat(files[0]); err != nil {
+            fatal(exitIO, err)
+        }
+        db, err := suptext.LoadGlyphDB(files[0])
+        if err != nil {
+            fatal(exitParse, err)
+        }
+        fout := os.Stdout
+        if files[1] != "-" {
+            if fout, err = os.Create(files[1]); err != nil {
+                fatalf(exitIO, "Failed to create file: %v", err)
+            }
+            defer fout.Close()
+        }
+        if err := db.Write(fout, *min_count); err != nil {
+            fatalf(exitIO, "Failed to write to file: %v", err)
+        }
+    default:
+        fatal(exitUsage, usage)
+    }
+}
+
+// loadConfig reads options from a config file then re-applies the flags set on the command line
+func loadConfig(fs *flag.FlagSet, fname string, opts *suptext.Options) {
+    explicit := map[string]string{}
+    fs.Visit(func(f *flag.Flag) {
+        explicit[f.Name] = f.Value.String()
+    })
+    file_opts, err := suptext.LoadOptions(fname)
+    if err != nil {
+        fatal(exitUsage, err)
+    }
+    *opts = file_opts
+    for name, value := range explicit {
+        // Variables are merged into the config file ones afterwards
+        if name == "var" {
+            continue
+        }
+        fs.Set(name, value)
+    }
+}
+
+// variablesFlag collects repeated name=value flags
+type variablesFlag map[string]string
+
+func (v variablesFlag) String() string {
+    return ""
+}
+
+func (v variablesFlag) Set(value string) error {
+    name, val, ok := strings.Cut(value, "=")
+    if !ok || name == "" {
+        return fmt.Errorf("expected name=value, got '%s'", value)
+    }
+    v[name] = val
+    return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eliaonceagain/suptext/src"
+)
+
+// fakeDemuxer has tracks without display sets
+type fakeDemuxer struct {
+	tracks []suptext.SubtitleTrack
+}
+
+func (d *fakeDemuxer) SubtitleTracks() []suptext.SubtitleTrack {
+	return d.tracks
+}
+
+func (d *fakeDemuxer) ReadTracks(ids []uint64) (map[uint64]suptext.PGS, error) {
+	pgs := map[uint64]suptext.PGS{}
+	for _, id := range ids {
+		pgs[id] = suptext.PGS{}
+	}
+	return pgs, nil
+}
+
+func TestConvertTracks_OverwriteNever(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "movie")
+	d := &fakeDemuxer{tracks: []suptext.SubtitleTrack{{ID: 1, Language: "eng"}, {ID: 2, Language: "deu"}}}
+	if err := os.WriteFile(base+".deu.srt", []byte("existing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := outputs{Format: suptext.FormatSRT, Overwrite: overwriteNever}
+	opts := suptext.Options{Engine: suptext.EngineGlyph, GlyphDB: filepath.Join(dir, "glyphs.db")}
+	_, err := convertTracks(context.Background(), d, opts, base, out, 2)
+	if exitCode(err) != exitIO {
+		t.Fatalf("Expected existing file error, got: %v", err)
+	}
+	// No track is converted once any file must not be overwritten
+	if _, err := os.Stat(base + ".eng.srt"); !os.IsNotExist(err) {
+		t.Errorf("Expected no subtitle file of the first track, got: %v", err)
+	}
+}
+
+func TestProgressDisplay_LogEvery(t *testing.T) {
+	var buf syncBuffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	// A slow cue reports nothing, the log lines keep coming
+	tracker := suptext.NewProgressTracker(nil)
+	tracker.AddCues(2)
+	d := &progressDisplay{}
+	d.logEvery(tracker, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	d.finish()
+	lines := strings.Count(buf.String(), "Recognized 0/2 cues")
+	if lines < 2 {
+		t.Errorf("Expected periodic log lines, got %q", buf.String())
+	}
+	time.Sleep(30 * time.Millisecond)
+	if strings.Count(buf.String(), "Recognized") != lines {
+		t.Errorf("Expected no log line after finish, got %q", buf.String())
+	}
+}
+
+// syncBuffer is a buffer written by the log lines of another goroutine
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
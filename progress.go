@@ -0,0 +1,164 @@
+package main
+
+import (
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "strings"
+    "sync"
+    "time"
+    "github.com/eliaonceagain/suptext/src"
+)
+
+// Progress display modes
+const (
+    progressAuto = "auto"
+    progressBar = "bar"
+    progressLog = "log"
+    progressOff = "off"
+)
+
+const (
+    // Time between progress log lines, and between redraws of the bar
+    progressLogInterval = 10 * time.Second
+    progressBarInterval = 100 * time.Millisecond
+    progressBarWidth = 30
+)
+
+// progressDisplay shows the progress of a conversion as a bar redrawn at the bottom of stderr, log
+// lines printed meanwhile go above it, or as periodic log lines
+type progressDisplay struct {
+    mu sync.Mutex
+    bar bool
+    out io.Writer
+    last time.Time
+    // Bar currently drawn, empty if none
+    line string
+    // Stop the log lines, and tell they stopped
+    stop chan struct{}
+    stopped chan struct{}
+}
+
+// newProgressDisplay returns the display of mode, a bar in auto mode if stderr is a terminal, and
+// the tracker reporting to it. Both are nil if mode is off.
+func newProgressDisplay(mode string) (*progressDisplay, *suptext.ProgressTracker) {
+    switch mode {
+    case progressOff:
+        return nil, nil
+    case progressAuto:
+        mode = progressLog
+        if isTerminal(os.Stderr) {
+            mode = progressBar
+        }
+    case progressBar, progressLog:
+    default:
+        fatalf(exitUsage, "Unknown progress mode '%s' (expected %s, %s, %s or %s)", mode, progressAuto, progressBar, progressLog, progressOff)
+    }
+    d := &progressDisplay{bar: mode == progressBar, out: os.Stderr, last: time.Now()}
+    if !d.bar {
+        tracker := suptext.NewProgressTracker(nil)
+        d.logEvery(tracker, progressLogInterval)
+        return d, tracker
+    }
+    log.SetOutput(d)
+    return d, suptext.NewProgressTracker(d.report)
+}
+
+// logEvery logs the progress of tracker every interval until finish, also while a slow cue reports
+// no change
+func (d *progressDisplay) logEvery(tracker *suptext.ProgressTracker, interval time.Duration) {
+    d.stop, d.stopped = make(chan struct{}), make(chan struct{})
+    go func() {
+        defer close(d.stopped)
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-ticker.C:
+                log.Print(tracker.Progress().String())
+            case <-d.stop:
+                return
+            }
+        }
+    }()
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+    info, err := f.Stat()
+    return err == nil && info.Mode() & os.ModeCharDevice != 0 && os.Getenv("TERM") != "dumb"
+}
+
+// report draws the bar of p unless it was drawn recently
+func (d *progressDisplay) report(p suptext.Progress) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    // The last cue is always drawn
+    done := p.Stage == suptext.StageRecognizing && p.Cues == p.TotalCues
+    if time.Since(d.last) < progressBarInterval && !done {
+        return
+    }
+    d.last = time.Now()
+    d.line = progressLine(p)
+    fmt.Fprintf(d.out, "\r\033[K%s", d.line)
+}
+
+// Write prints log lines above the bar
+func (d *progressDisplay) Write(b []byte) (int, error) {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    if d.line != "" {
+        fmt.Fprint(d.out, "\r\033[K")
+    }
+    n, err := d.out.Write(b)
+    if d.line != "" {
+        fmt.Fprint(d.out, d.line)
+    }
+    return n, err
+}
+
+// finish stops the log lines, or erases the bar and restores the log output
+func (d *progressDisplay) finish() {
+    if d == nil {
+        return
+    }
+    if !d.bar {
+        close(d.stop)
+        <-d.stopped
+        return
+    }
+    d.mu.Lock()
+    if d.line != "" {
+        fmt.Fprint(d.out, "\r\033[K")
+        d.line = ""
+    }
+    d.mu.Unlock()
+    log.SetOutput(os.Stderr)
+}
+
+// progressLine returns the bar of p, e.g. "[#########.....] 120/450 cues 1:23 ETA 3:10"
+func progressLine(p suptext.Progress) string {
+    if p.Stage != suptext.StageRecognizing {
+        return fmt.Sprintf("Reading %d segments, %d display sets %s", p.Segments, p.DisplaySets, formatClock(p.Elapsed))
+    }
+    filled := progressBarWidth
+    if p.TotalCues > 0 {
+        filled = progressBarWidth * p.Cues / p.TotalCues
+    }
+    line := fmt.Sprintf("[%s%s] %d/%d cues %s", strings.Repeat("#", filled), strings.Repeat(".", progressBarWidth - filled),
+        p.Cues, p.TotalCues, formatClock(p.Elapsed))
+    if p.ETA > 0 {
+        line += " ETA " + formatClock(p.ETA)
+    }
+    return line
+}
+
+// formatClock formats d as m:ss, or h:mm:ss above an hour
+func formatClock(d time.Duration) string {
+    s := int(d.Round(time.Second).Seconds())
+    if s >= 3600 {
+        return fmt.Sprintf("%d:%02d:%02d", s / 3600, s / 60 % 60, s % 60)
+    }
+    return fmt.Sprintf("%d:%02d", s / 60, s % 60)
+}
@@ -16,6 +16,8 @@ function help {
   echo "Exactly one of the following options must be set"
   echo "  -v,  --video <path>      : Set the video file"
   echo "  -s,  --sup <path>        : Set the supplementary file"
+  echo "Optional:"
+  echo "  -l,  --lang <langs>      : OCR and subtitle track languages, e.g. deu+eng (default: eng)"
   echo "  -h,  --help              : Display this help message"
   exit 1
 }
@@ -34,21 +36,54 @@ function get_tempfile {
   echo "${tmpfile}"
 }
 
-function get_largest_size_eng_pgs_stream_index {
-  # Probe for PGS ENG subtitles in input video
-  eng_pgs_stream="$(ffprobe -loglevel error \
+function stream_languages {
+  # Print the ISO 639-2 stream language codes matching a tesseract language code
+  lang="${1%%_*}"
+  case "${lang}" in
+    deu|ger) echo "deu ger" ;;
+    fra|fre) echo "fra fre" ;;
+    nld|dut) echo "nld dut" ;;
+    ces|cze) echo "ces cze" ;;
+    ell|gre) echo "ell gre" ;;
+    fas|per) echo "fas per" ;;
+    ron|rum) echo "ron rum" ;;
+    slk|slo) echo "slk slo" ;;
+    zho|chi) echo "zho chi" ;;
+    isl|ice) echo "isl ice" ;;
+    sqi|alb) echo "sqi alb" ;;
+    hye|arm) echo "hye arm" ;;
+    eus|baq) echo "eus baq" ;;
+    kat|geo) echo "kat geo" ;;
+    mkd|mac) echo "mkd mac" ;;
+    msa|may) echo "msa may" ;;
+    cym|wel) echo "cym wel" ;;
+    *) echo "${lang}" ;;
+  esac
+}
+
+function get_largest_size_pgs_stream_index {
+  # Probe for PGS subtitles in input video
+  pgs_streams="$(ffprobe -loglevel error \
     -select_streams s \
     -show_entries stream=index:stream_tags=language:stream=codec_name:stream_tags=number_of_bytes-eng \
     -of csv=p=0 \
-    "${input_video}" | grep eng | grep hdmv_pgs_subtitle)"
-  # Validate PGS ENG subtitles was found
-  if [[ -z "${eng_pgs_stream}" ]]; then
-    logerr "No eng-PGS subtitles detected in video file."
+    "${input_video}" | grep hdmv_pgs_subtitle || true)"
+  # Select streams of the first requested language that has any
+  IFS=+ read -ra langs <<< "${input_lang}"
+  lang_pgs_stream=""
+  for lang in "${langs[@]}"; do
+    lang_pgs_stream="$(echo "${pgs_streams}" | awk -F, -v codes="$(stream_languages "${lang}")" \
+      'BEGIN { n = split(codes, c, " "); for (i = 1; i <= n; i++) m[c[i]] = 1 } ($3 in m)')"
+    [[ -n "${lang_pgs_stream}" ]] && break
+  done
+  # Validate PGS subtitles was found
+  if [[ -z "${lang_pgs_stream}" ]]; then
+    logerr "No ${input_lang}-PGS subtitles detected in video file."
   fi
-  if [[ $(echo "${eng_pgs_stream}" | wc -l) == 1 ]]; then
-    echo "${eng_pgs_stream%%,*}"
+  if [[ $(echo "${lang_pgs_stream}" | wc -l) == 1 ]]; then
+    echo "${lang_pgs_stream%%,*}"
   else
-    # If more than one eng-PGS stream then return the largest size stream
+    # If more than one PGS stream in the language then return the largest size stream
     max_size=-1
     largest_stream_index=-1
     while IFS=, read -r stream_index _ _ stream_size; do
@@ -56,15 +91,15 @@ function get_largest_size_eng_pgs_stream_index {
             max_size=${stream_size}
             largest_stream_index=${stream_index}
         fi
-    done <<< "${eng_pgs_stream}"
+    done <<< "${lang_pgs_stream}"
     echo "${largest_stream_index}"
   fi
 }
 
 function video_input {
   if file -i "${input_video}" | grep -q video ; then
-    stream_index="$(get_largest_size_eng_pgs_stream_index)"
-    log "Found eng-PGS subtitles at stream index: ${stream_index}"
+    stream_index="$(get_largest_size_pgs_stream_index)"
+    log "Found ${input_lang}-PGS subtitles at stream index: ${stream_index}"
   else
     logerr "Input is not a video file"
   fi
@@ -76,7 +111,7 @@ function video_input {
     logerr "Failed to extract subtitles from input video"
   fi
   log "Successfully extracted subtitles from input video"
-  suptext "${tempfile_path}.sup"
+  suptext --lang "${input_lang}" "${tempfile_path}.sup"
   # Cleanup
   cp "${tempfile_path}.srt" "${input_video_path_no_extension}.srt"
   rm "${tempfile_path}.sup" "${tempfile_path}.srt"
@@ -84,6 +119,7 @@ function video_input {
 
 input_video=""
 input_sup=""
+input_lang="eng"
 while [[ $# -gt 0 ]]; do
   case $1 in
     -v|--video)
@@ -94,6 +130,10 @@ while [[ $# -gt 0 ]]; do
       input_sup="$2"
       shift
       ;;
+    -l|--lang)
+      input_lang="$2"
+      shift
+      ;;
     *)
       help
       ;;
@@ -107,5 +147,5 @@ if [[ -n "${input_video}" ]]; then
   video_input
 else
   log "Processing video file: $(basename "${input_sup}")"
-  suptext "${input_sup}"
+  suptext --lang "${input_lang}" "${input_sup}"
 fi
@@ -0,0 +1,86 @@
+package main
+
+import (
+    "context"
+    "log"
+    "net"
+    "net/http"
+    "os"
+    "os/signal"
+    "runtime"
+    "syscall"
+    "time"
+    "github.com/eliaonceagain/suptext/src"
+)
+
+// serveCommand runs the HTTP conversion service until interrupted
+func serveCommand(args []string) {
+    fs := newFlagSet("serve", "")
+    flags := addOCRFlags(fs)
+    listen := fs.String("listen", "localhost:8080", "Address to listen on, e.g. :8080 for every interface")
+    workers := fs.Int("workers", runtime.NumCPU(), "Jobs recognized at once, each worker keeps its OCR engines")
+    max_upload := fs.String("max-upload", "256M", "Largest accepted SUP upload")
+    max_queued := fs.Int("max-queued", suptext.DefaultMaxQueued, "Jobs waiting for a worker before uploads are refused")
+    job_timeout := fs.Float64("job-timeout", 0, "Seconds a job may run before it's cancelled with the cues recognized so far (default no limit)")
+    languages := fs.String("languages", "", "Languages jobs may ask for besides --lang, separated by '+' (default those installed in the tessdata directory)")
+    max_engines := fs.Int("max-engines", suptext.DefaultMaxEngines, "OCR engines each worker keeps, the least recently used is closed above")
+    job_ttl := fs.Float64("job-ttl", suptext.DefaultJobTTL.Minutes(), "Minutes finished jobs and their results are kept")
+    fs.Parse(args)
+    if fs.NArg() > 0 {
+        fs.Usage()
+        os.Exit(exitUsage)
+    }
+    opts := flags.options()
+    if opts.TrainGlyphs {
+        fatal(exitUsage, "serve can't train glyphs")
+    }
+    if !suptext.TesseractSupported && (opts.Engine == "" || opts.Engine == suptext.EngineTesseract) {
+        fatal(exitOCR, suptext.ErrNoTesseract)
+    }
+    max_size, err := suptext.ParseSize(*max_upload)
+    if err != nil {
+        fatal(exitUsage, err)
+    }
+    if *workers <= 0 || *max_queued <= 0 || *max_engines <= 0 || *job_ttl <= 0 {
+        fatal(exitUsage, "--workers, --max-queued, --max-engines and --job-ttl must be positive")
+    }
+    if *job_timeout < 0 {
+        fatal(exitUsage, "--job-timeout can't be negative")
+    }
+
+    s := &suptext.Server{
+        Opts: opts,
+        Workers: *workers,
+        MaxUploadSize: max_size,
+        MaxQueued: *max_queued,
+        JobTTL: time.Duration(*job_ttl * float64(time.Minute)),
+        JobTimeout: time.Duration(*job_timeout * float64(time.Second)),
+        MaxEngines: *max_engines,
+    }
+    if *languages != "" {
+        s.Languages = (&suptext.Options{Languages: *languages}).LanguageList()
+    }
+    ln, err := net.Listen("tcp", *listen)
+    if err != nil {
+        fatal(exitError, err)
+    }
+    srv := &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    errs := make(chan error, 1)
+    go func() {
+        errs <- srv.Serve(ln)
+    }()
+    log.Printf("Listening on %s with %d workers", ln.Addr(), *workers)
+    select {
+    case err := <-errs:
+        fatal(exitError, err)
+    case <-ctx.Done():
+    }
+    // A second signal kills at once
+    stop()
+    log.Printf("Stopping, waiting for uploads and running jobs")
+    if err := srv.Shutdown(context.Background()); err != nil {
+        log.Printf("Warning: Failed to stop listening: %v", err)
+    }
+    s.Close()
+}
@@ -0,0 +1,162 @@
+package suptext
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// InputExtensions are the extensions of the SUP files and videos found in batch directories
+var InputExtensions = []string{".sup", ".mkv", ".mka", ".mks", ".m2ts", ".mts", ".ts"}
+
+// DefaultManifestName is the batch manifest file written in the converted directory
+const DefaultManifestName = ".suptext-manifest.json"
+
+// Manifest entry states
+const (
+    BatchDone = "done"
+    BatchFailed = "failed"
+    // Timed out or interrupted, converted again when resuming
+    BatchCancelled = "cancelled"
+)
+
+// FindInputs returns the SUP files, videos and Blu-ray folders below root, sorted by path.
+// Blu-ray folders are inputs as a whole, their files aren't listed.
+func FindInputs(root string) ([]string, error) {
+    var inputs []string
+    err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        if d.IsDir() {
+            if strings.HasPrefix(d.Name(), ".") && path != root {
+                return filepath.SkipDir
+            }
+            if strings.EqualFold(d.Name(), "BDMV") {
+                return filepath.SkipDir
+            }
+            if _, ok := FindBDMV(path); ok {
+                inputs = append(inputs, path)
+                return filepath.SkipDir
+            }
+            return nil
+        }
+        ext := strings.ToLower(filepath.Ext(path))
+        for _, e := range InputExtensions {
+            if ext == e {
+                inputs = append(inputs, path)
+                break
+            }
+        }
+        return nil
+    })
+    sort.Strings(inputs)
+    return inputs, err
+}
+
+// ManifestEntry is the result of converting an input in a batch
+type ManifestEntry struct {
+    Status string `json:"status"`
+    // Input size and modification time when it was converted
+    Size int64 `json:"size"`
+    ModTime time.Time `json:"mod_time"`
+    // Written files, relative to the manifest
+    Outputs []string `json:"outputs,omitempty"`
+    Cues int `json:"cues"`
+    Warnings []string `json:"warnings,omitempty"`
+    Error string `json:"error,omitempty"`
+    Finished time.Time `json:"finished"`
+}
+
+// Manifest records the inputs of a batch, by path relative to the manifest, so that an
+// interrupted batch resumes with the inputs it didn't finish. Safe for concurrent use.
+type Manifest struct {
+    Entries map[string]ManifestEntry `json:"entries"`
+    path string
+    mu sync.Mutex
+}
+
+// LoadManifest reads the manifest at path, empty if it doesn't exist yet
+func LoadManifest(path string) (*Manifest, error) {
+    m := &Manifest{Entries: map[string]ManifestEntry{}, path: path}
+    data, err := os.ReadFile(path)
+    if os.IsNotExist(err) {
+        return m, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    if err := json.Unmarshal(data, m); err != nil {
+        return nil, fmt.Errorf("Invalid manifest %s: %v", path, err)
+    }
+    if m.Entries == nil {
+        m.Entries = map[string]ManifestEntry{}
+    }
+    return m, nil
+}
+
+// rel returns path relative to the manifest directory
+func (m *Manifest) rel(path string) string {
+    dir, err := filepath.Abs(filepath.Dir(m.path))
+    if err != nil {
+        return path
+    }
+    abs, err := filepath.Abs(path)
+    if err != nil {
+        return path
+    }
+    if rel, err := filepath.Rel(dir, abs); err == nil {
+        return filepath.ToSlash(rel)
+    }
+    return path
+}
+
+// Done returns the entry of input if it was converted unchanged and its outputs still exist
+func (m *Manifest) Done(input string) (ManifestEntry, bool) {
+    m.mu.Lock()
+    entry, ok := m.Entries[m.rel(input)]
+    m.mu.Unlock()
+    if !ok || entry.Status != BatchDone {
+        return entry, false
+    }
+    info, err := os.Stat(input)
+    if err != nil || info.Size() != entry.Size || !info.ModTime().Equal(entry.ModTime) {
+        return entry, false
+    }
+    for _, out := range entry.Outputs {
+        if _, err := os.Stat(filepath.Join(filepath.Dir(m.path), filepath.FromSlash(out))); err != nil {
+            return entry, false
+        }
+    }
+    return entry, true
+}
+
+// Record saves the result of input, its outputs are given relative to the working directory
+func (m *Manifest) Record(input string, entry ManifestEntry) error {
+    if info, err := os.Stat(input); err == nil {
+        entry.Size, entry.ModTime = info.Size(), info.ModTime()
+    }
+    outputs := make([]string, len(entry.Outputs))
+    for i, out := range entry.Outputs {
+        outputs[i] = m.rel(out)
+    }
+    entry.Outputs = outputs
+    if entry.Finished.IsZero() {
+        entry.Finished = time.Now()
+    }
+
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.Entries[m.rel(input)] = entry
+    data, err := json.MarshalIndent(m, "", JSONIndent)
+    if err != nil {
+        return err
+    }
+    return writeFileAtomic(m.path, data)
+}
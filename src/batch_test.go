@@ -0,0 +1,83 @@
+package suptext
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFindInputs(t *testing.T) {
+	root := t.TempDir()
+	disc := filepath.Join(root, "Movie")
+	if err := os.Rename(createTestBDMV(t), disc); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.sup", "season/b.MKV", "season/b.srt", "season/c.m2ts", ".trash/d.sup"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inputs, err := FindInputs(root)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	// The disc root is an input, not the clips of its BDMV folder
+	want := []string{disc, filepath.Join(root, "a.sup"), filepath.Join(root, "season", "b.MKV"), filepath.Join(root, "season", "c.m2ts")}
+	if len(inputs) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, inputs)
+	}
+	for i := range want {
+		if inputs[i] != want[i] {
+			t.Errorf("Expected input %d to be %s, got %s", i, want[i], inputs[i])
+		}
+	}
+}
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "movie.sup")
+	output := filepath.Join(dir, "movie.srt")
+	os.WriteFile(input, []byte("PG"), 0644)
+	os.WriteFile(output, nil, 0644)
+	path := filepath.Join(dir, DefaultManifestName)
+
+	m, err := LoadManifest(path)
+	if err != nil {
+		t.Fatalf("Expected no error for missing manifest, got: %v", err)
+	}
+	if _, ok := m.Done(input); ok {
+		t.Error("Expected input not to be done in an empty manifest")
+	}
+	if err := m.Record(input, ManifestEntry{Status: BatchDone, Outputs: []string{output}, Cues: 3}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// An interrupted batch resumes from the saved manifest
+	m, err = LoadManifest(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	entry, ok := m.Done(input)
+	if !ok || entry.Cues != 3 || entry.Outputs[0] != "movie.srt" {
+		t.Errorf("Expected done entry with relative outputs, got %+v (%v)", entry, ok)
+	}
+
+	// Changed inputs and missing outputs are converted again
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(input, later, later)
+	if _, ok := m.Done(input); ok {
+		t.Error("Expected changed input not to be done")
+	}
+	m.Record(input, ManifestEntry{Status: BatchDone, Outputs: []string{output}})
+	os.Remove(output)
+	if _, ok := m.Done(input); ok {
+		t.Error("Expected input with a missing output not to be done")
+	}
+	m.Record(input, ManifestEntry{Status: BatchFailed, Error: "broken"})
+	if _, ok := m.Done(input); ok {
+		t.Error("Expected failed input not to be done")
+	}
+}
@@ -0,0 +1,321 @@
+package suptext
+
+import (
+    "encoding/binary"
+    "fmt"
+    "io"
+    "log"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// Playlist and clip timestamps tick at 45kHz
+const BDMVTimestampRate = 45
+
+// PlayItem is a clip played from In to Out, with the PGS streams of its STN table
+type PlayItem struct {
+    Clip string
+    In uint32
+    Out uint32
+    PGS []TSStream
+}
+
+// Playlist is a Blu-ray MPLS playlist
+type Playlist struct {
+    Name string
+    Items []PlayItem
+}
+
+// Duration returns the playing time of all items in milliseconds
+func (p *Playlist) Duration() uint32 {
+    var ticks uint64
+    for _, item := range p.Items {
+        if item.Out > item.In {
+            ticks += uint64(item.Out - item.In)
+        }
+    }
+    return uint32(ticks / BDMVTimestampRate)
+}
+
+// PGSStreams returns the PGS streams of the first item, stream numbers are the same for every item
+func (p *Playlist) PGSStreams() []TSStream {
+    if len(p.Items) == 0 {
+        return nil
+    }
+    return p.Items[0].PGS
+}
+
+// ReadMPLS reads the play items of a playlist, the main path only
+func ReadMPLS(r io.Reader) (Playlist, error) {
+    data, err := io.ReadAll(r)
+    if err != nil {
+        return Playlist{}, err
+    }
+    if len(data) < 20 || string(data[:4]) != "MPLS" {
+        return Playlist{}, fmt.Errorf("Not an MPLS playlist")
+    }
+    pos := int(binary.BigEndian.Uint32(data[8:12]))
+    if pos + 10 > len(data) {
+        return Playlist{}, fmt.Errorf("Invalid MPLS playlist offset %d", pos)
+    }
+    count := int(binary.BigEndian.Uint16(data[pos + 6:pos + 8]))
+    pos += 10
+
+    var playlist Playlist
+    for i := 0; i < count; i++ {
+        if pos + 2 > len(data) {
+            return Playlist{}, fmt.Errorf("Truncated MPLS play item %d", i)
+        }
+        length := int(binary.BigEndian.Uint16(data[pos:pos + 2]))
+        if pos + 2 + length > len(data) {
+            return Playlist{}, fmt.Errorf("Truncated MPLS play item %d", i)
+        }
+        item, err := parsePlayItem(data[pos + 2:pos + 2 + length])
+        if err != nil {
+            return Playlist{}, fmt.Errorf("Invalid MPLS play item %d: %v", i, err)
+        }
+        playlist.Items = append(playlist.Items, item)
+        pos += 2 + length
+    }
+    return playlist, nil
+}
+
+func parsePlayItem(data []byte) (PlayItem, error) {
+    if len(data) < 32 {
+        return PlayItem{}, fmt.Errorf("too short")
+    }
+    item := PlayItem{
+        Clip: string(data[0:5]),
+        In: binary.BigEndian.Uint32(data[12:16]),
+        Out: binary.BigEndian.Uint32(data[16:20]),
+    }
+    pos := 32
+    // Multi angle items list the clips of the other angles
+    if data[10] & 0x10 != 0 {
+        if pos + 2 > len(data) {
+            return PlayItem{}, fmt.Errorf("truncated angles")
+        }
+        pos += 2 + maxInt(int(data[pos]) - 1, 0) * 10
+    }
+    if pos + 16 > len(data) {
+        return PlayItem{}, fmt.Errorf("truncated STN table")
+    }
+    stn := data[pos:]
+    video, audio, pg := int(stn[4]), int(stn[5]), int(stn[6])
+    pos = 16
+    for i := 0; i < video + audio + pg; i++ {
+        // Stream entry and attributes are each prefixed by their length
+        if pos >= len(stn) || pos + 1 + int(stn[pos]) >= len(stn) {
+            return PlayItem{}, fmt.Errorf("truncated stream entry")
+        }
+        entry := stn[pos + 1:pos + 1 + int(stn[pos])]
+        pos += 1 + len(entry)
+        if pos + 1 + int(stn[pos]) > len(stn) {
+            return PlayItem{}, fmt.Errorf("truncated stream attributes")
+        }
+        attrs := stn[pos + 1:pos + 1 + int(stn[pos])]
+        pos += 1 + len(attrs)
+        if i < video + audio || len(attrs) < 4 || attrs[0] != TSStreamTypePGS {
+            continue
+        }
+        if len(entry) < 3 || entry[0] != 1 {
+            log.Printf("Warning: Skipping PGS stream %d of clip %s outside the main path", i - video - audio + 1, item.Clip)
+            continue
+        }
+        item.PGS = append(item.PGS, TSStream{
+            PID: binary.BigEndian.Uint16(entry[1:3]),
+            Type: attrs[0],
+            Language: string(attrs[1:4]),
+        })
+    }
+    return item, nil
+}
+
+// ReadCLPI reads the streams of a clip's program sequences
+func ReadCLPI(r io.Reader) ([]TSStream, error) {
+    data, err := io.ReadAll(r)
+    if err != nil {
+        return nil, err
+    }
+    if len(data) < 16 || string(data[:4]) != "HDMV" {
+        return nil, fmt.Errorf("Not a CLPI clip info file")
+    }
+    pos := int(binary.BigEndian.Uint32(data[12:16]))
+    if pos + 6 > len(data) {
+        return nil, fmt.Errorf("Invalid CLPI program info offset %d", pos)
+    }
+    sequences := int(data[pos + 5])
+    pos += 6
+
+    var streams []TSStream
+    for i := 0; i < sequences; i++ {
+        if pos + 8 > len(data) {
+            return nil, fmt.Errorf("Truncated CLPI program sequence %d", i)
+        }
+        count := int(data[pos + 6])
+        pos += 8
+        for j := 0; j < count; j++ {
+            if pos + 3 > len(data) || pos + 3 + int(data[pos + 2]) > len(data) {
+                return nil, fmt.Errorf("Truncated CLPI stream %d", j)
+            }
+            s := TSStream{PID: binary.BigEndian.Uint16(data[pos:pos + 2])}
+            info := data[pos + 3:pos + 3 + int(data[pos + 2])]
+            if len(info) > 0 {
+                s.Type = info[0]
+            }
+            if s.IsPGS() && len(info) >= 4 {
+                s.Language = string(info[1:4])
+            }
+            streams = append(streams, s)
+            pos += 3 + len(info)
+        }
+    }
+    return streams, nil
+}
+
+// BDMV is the main feature playlist of a Blu-ray folder
+type BDMV struct {
+    Dir string
+    Playlist Playlist
+    // Counts the segments and display sets of the streams read if not nil
+    Progress *ProgressTracker
+}
+
+// FindBDMV returns the BDMV folder of path, which is either that folder or the disc root containing it
+func FindBDMV(path string) (string, bool) {
+    for _, dir := range []string{path, filepath.Join(path, "BDMV")} {
+        if info, err := os.Stat(filepath.Join(dir, "PLAYLIST")); err == nil && info.IsDir() {
+            return dir, true
+        }
+    }
+    return "", false
+}
+
+// OpenBDMV reads the playlists of a BDMV folder and picks the longest one as the main feature
+func OpenBDMV(dir string) (*BDMV, error) {
+    fnames, err := filepath.Glob(filepath.Join(dir, "PLAYLIST", "*.mpls"))
+    if err != nil {
+        return nil, err
+    }
+    sort.Strings(fnames)
+    var main *Playlist
+    for _, fname := range fnames {
+        f, err := os.Open(fname)
+        if err != nil {
+            return nil, err
+        }
+        playlist, err := ReadMPLS(f)
+        f.Close()
+        if err != nil {
+            log.Printf("Warning: Skipping playlist %s: %v", fname, err)
+            continue
+        }
+        playlist.Name = strings.TrimSuffix(filepath.Base(fname), filepath.Ext(fname))
+        if main == nil || playlist.Duration() > main.Duration() {
+            main = &playlist
+        }
+    }
+    if main == nil {
+        return nil, fmt.Errorf("No playlists found in %s", dir)
+    }
+    return &BDMV{Dir: dir, Playlist: *main}, nil
+}
+
+// ReadPGSStreams decodes the PGS streams of the playlist, stitching the clips in playlist order
+// so timestamps run from the start of the playlist
+func (b *BDMV) ReadPGSStreams() ([]PGS, error) {
+    streams := make([]PGS, len(b.Playlist.PGSStreams()))
+    var offset uint64
+    for _, item := range b.Playlist.Items {
+        pids := b.clipPIDs(item, len(streams))
+        pgs := map[uint16]PGS{}
+        if len(pids) > 0 {
+            f, err := os.Open(filepath.Join(b.Dir, "STREAM", item.Clip + ".m2ts"))
+            if err != nil {
+                return nil, err
+            }
+            t, err := OpenTS(f)
+            if err == nil {
+                t.Progress = b.Progress
+                pgs, err = t.ReadPGSStreams(pids)
+            }
+            f.Close()
+            if err != nil {
+                return nil, fmt.Errorf("Failed to read clip %s: %v", item.Clip, err)
+            }
+        }
+
+        // Display sets are kept from In to Out and moved to the item's playlist time
+        in := uint64(item.In) / BDMVTimestampRate
+        out := uint64(item.Out) / BDMVTimestampRate
+        for i := range streams {
+            if i >= len(item.PGS) {
+                continue
+            }
+            for _, ds := range pgs[item.PGS[i].PID].Sections {
+                if pts := uint64(ds.PCS.PTS); pts >= in && pts < out {
+                    shiftDisplaySet(&ds, int64(offset) - int64(in))
+                    streams[i].Sections = append(streams[i].Sections, ds)
+                }
+            }
+        }
+        if item.Out > item.In {
+            offset += out - in
+        }
+    }
+    return streams, nil
+}
+
+// clipPIDs returns the PIDs of the first n PGS streams of an item found in its clip info
+func (b *BDMV) clipPIDs(item PlayItem, n int) []uint16 {
+    var clip []TSStream
+    f, err := os.Open(filepath.Join(b.Dir, "CLIPINF", item.Clip + ".clpi"))
+    if err == nil {
+        clip, err = ReadCLPI(f)
+        f.Close()
+    }
+    if err != nil {
+        log.Printf("Warning: Failed to read clip info of %s: %v", item.Clip, err)
+    }
+    var pids []uint16
+    for i, s := range item.PGS {
+        if i >= n {
+            break
+        }
+        found := clip == nil
+        for _, c := range clip {
+            found = found || c.PID == s.PID
+        }
+        if !found {
+            log.Printf("Warning: PGS stream PID 0x%04X missing from clip %s", s.PID, item.Clip)
+            continue
+        }
+        pids = append(pids, s.PID)
+    }
+    return pids
+}
+
+// shiftDisplaySet moves the timestamps of a display set's segments by delta milliseconds
+func shiftDisplaySet(ds *DisplaySet, delta int64) {
+    move := func(ts uint32) uint32 {
+        if int64(ts) + delta < 0 {
+            return 0
+        }
+        return uint32(int64(ts) + delta)
+    }
+    shift := func(s *Section) {
+        if s.Type == 0 {
+            return
+        }
+        s.PTS, s.DTS = move(s.PTS), move(s.DTS)
+    }
+    shift(&ds.PCS)
+    shift(&ds.WDS)
+    shift(&ds.PDS)
+    shift(&ds.END)
+    for i := range ds.ODS {
+        shift(&ds.ODS[i])
+    }
+}
@@ -0,0 +1,152 @@
+package suptext
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Helper function to create an MPLS playlist whose items have a video stream and the given PGS streams
+func createMPLS(items []PlayItem) []byte {
+	var list []byte
+	for _, item := range items {
+		data := make([]byte, 32)
+		copy(data[0:5], item.Clip)
+		copy(data[5:9], "M2TS")
+		binary.BigEndian.PutUint32(data[12:16], item.In)
+		binary.BigEndian.PutUint32(data[16:20], item.Out)
+		stn := make([]byte, 16)
+		stn[4], stn[6] = 1, byte(len(item.PGS))
+		stn = append(stn, 9, 1, 0x10, 0x11, 0, 0, 0, 0, 0, 0, 5, 0x1B, 0x61, 0, 0, 0)
+		for _, s := range item.PGS {
+			stn = append(stn, 9, 1, byte(s.PID>>8), byte(s.PID), 0, 0, 0, 0, 0, 0)
+			stn = append(stn, 5, TSStreamTypePGS, s.Language[0], s.Language[1], s.Language[2], 0)
+		}
+		binary.BigEndian.PutUint16(stn[0:2], uint16(len(stn)-2))
+		data = append(data, stn...)
+		list = append(list, byte(len(data)>>8), byte(len(data)))
+		list = append(list, data...)
+	}
+	header := make([]byte, 30)
+	copy(header, "MPLS0200")
+	binary.BigEndian.PutUint32(header[8:12], 20)
+	binary.BigEndian.PutUint32(header[20:24], uint32(len(list)+6))
+	binary.BigEndian.PutUint16(header[26:28], uint16(len(items)))
+	return append(header, list...)
+}
+
+// Helper function to create a CLPI file with a single program of the given streams
+func createCLPI(streams []TSStream) []byte {
+	data := make([]byte, 16)
+	copy(data, "HDMV0200")
+	binary.BigEndian.PutUint32(data[12:16], 16)
+	data = append(data, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0x01, 0x00, byte(len(streams)), 0)
+	for _, s := range streams {
+		data = append(data, byte(s.PID>>8), byte(s.PID), 5, s.Type, 'e', 'n', 'g', 0)
+	}
+	return data
+}
+
+// Helper function to create an M2TS clip with a display set per PTS of each PGS PID
+func createTestClip(displaySets map[uint16][]uint32) []byte {
+	var buf bytes.Buffer
+	write := func(packet []byte) {
+		buf.Write([]byte{0, 0, 0, 0})
+		buf.Write(packet)
+	}
+	var streams []byte
+	for _, pid := range []uint16{0x1200, 0x1201} {
+		streams = append(streams, TSStreamTypePGS, 0xE0|byte(pid>>8), byte(pid), 0xF0, 0x00)
+	}
+	write(createTSPacket(tsPATPID, true, 0, createPSISection(0x00, []byte{0, 1, 0xE1, 0x00})))
+	write(createTSPacket(0x100, true, 0, createPSISection(0x02, append([]byte{0xF0, 0x11, 0xF0, 0x00}, streams...))))
+	for pid, pts := range displaySets {
+		for i, ts := range pts {
+			write(createTSPacket(pid, true, uint8(i), createPESPacket(ts, 0, createPacketDisplaySet())))
+		}
+	}
+	return buf.Bytes()
+}
+
+func createTestBDMV(t *testing.T) string {
+	root := t.TempDir()
+	dir := filepath.Join(root, "BDMV")
+	for _, sub := range []string{"PLAYLIST", "CLIPINF", "STREAM"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(name string, data []byte) {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pgs := []TSStream{{PID: 0x1200, Language: "eng"}, {PID: 0x1201, Language: "ger"}}
+	write("PLAYLIST/00000.mpls", createMPLS([]PlayItem{{Clip: "00003", In: 0, Out: 45 * 1000, PGS: pgs}}))
+	write("PLAYLIST/00001.mpls", createMPLS([]PlayItem{
+		{Clip: "00001", In: 45 * 10000, Out: 45 * 20000, PGS: pgs},
+		{Clip: "00002", In: 45 * 5000, Out: 45 * 15000, PGS: pgs},
+	}))
+	write("PLAYLIST/00002.mpls", []byte("broken"))
+	write("CLIPINF/00001.clpi", createCLPI([]TSStream{{PID: 0x1011, Type: 0x1B}, {PID: 0x1200, Type: TSStreamTypePGS}, {PID: 0x1201, Type: TSStreamTypePGS}}))
+	write("STREAM/00001.m2ts", createTestClip(map[uint16][]uint32{0x1200: {9000, 12000, 19000}, 0x1201: {15000}}))
+	write("STREAM/00002.m2ts", createTestClip(map[uint16][]uint32{0x1200: {6000}}))
+	return root
+}
+
+func TestOpenBDMV(t *testing.T) {
+	root := createTestBDMV(t)
+	dir, ok := FindBDMV(root)
+	if !ok || dir != filepath.Join(root, "BDMV") {
+		t.Fatalf("Expected BDMV folder of the disc root, got %s", dir)
+	}
+	if _, ok := FindBDMV(dir); !ok {
+		t.Error("Expected BDMV folder to be found itself")
+	}
+	if _, ok := FindBDMV(t.TempDir()); ok {
+		t.Error("Expected no BDMV folder in an empty directory")
+	}
+
+	b, err := OpenBDMV(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if b.Playlist.Name != "00001" || b.Playlist.Duration() != 20000 {
+		t.Errorf("Expected longest playlist 00001 of 20s, got %s of %d ms", b.Playlist.Name, b.Playlist.Duration())
+	}
+	streams := b.Playlist.PGSStreams()
+	if len(streams) != 2 || streams[0].PID != 0x1200 || streams[0].Language != "eng" || streams[1].Language != "ger" {
+		t.Fatalf("Unexpected PGS streams %+v", streams)
+	}
+
+	pgs, err := b.ReadPGSStreams()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var eng []uint32
+	for _, ds := range pgs[0].Sections {
+		eng = append(eng, ds.PCS.PTS)
+	}
+	// 9s is before the first item's In, the second clip starts 10s into the playlist
+	if len(eng) != 3 || eng[0] != 2000 || eng[1] != 9000 || eng[2] != 11000 {
+		t.Errorf("Expected English display sets at 2000, 9000 and 11000, got %v", eng)
+	}
+	if len(pgs[1].Sections) != 1 || pgs[1].Sections[0].PCS.PTS != 5000 || pgs[1].Sections[0].END.PTS != 5000 {
+		t.Errorf("Expected a German display set at 5000, got %+v", pgs[1].Sections)
+	}
+}
+
+func TestReadCLPI(t *testing.T) {
+	streams, err := ReadCLPI(bytes.NewReader(createCLPI([]TSStream{{PID: 0x1011, Type: 0x1B}, {PID: 0x1200, Type: TSStreamTypePGS}})))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(streams) != 2 || streams[1].PID != 0x1200 || streams[1].Language != "eng" || streams[0].Language != "" {
+		t.Errorf("Unexpected clip streams %+v", streams)
+	}
+	if _, err := ReadCLPI(bytes.NewReader([]byte("MPLS0200"))); err == nil {
+		t.Error("Expected error for invalid clip info")
+	}
+}
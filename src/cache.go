@@ -0,0 +1,67 @@
+package suptext
+
+import (
+    "crypto/sha256"
+    "encoding/binary"
+    "encoding/hex"
+    "log"
+)
+
+// OCRCache holds the recognition results of the bitmaps seen during a run,
+// backed by a persistent DiskCache if set
+type OCRCache struct {
+    results map[string]OCRResult
+    Disk *DiskCache
+    Hits int
+    DiskHits int // Hits read from Disk, included in Hits
+    Misses int
+}
+
+func NewOCRCache() *OCRCache {
+    return &OCRCache{results: map[string]OCRResult{}}
+}
+
+// Get returns the cached result of a bitmap hash, counting hits and misses
+func (c *OCRCache) Get(key string) (OCRResult, bool) {
+    result, ok := c.results[key]
+    if !ok && c.Disk != nil {
+        if result, ok = c.Disk.Get(key); ok {
+            c.results[key] = result
+            c.DiskHits++
+        }
+    }
+    if ok {
+        c.Hits++
+    } else {
+        c.Misses++
+    }
+    return result, ok
+}
+
+func (c *OCRCache) Put(key string, result OCRResult) {
+    c.results[key] = result
+    if c.Disk != nil {
+        if err := c.Disk.Put(key, result); err != nil {
+            log.Printf("Warning: Failed to write OCR cache entry: %v", err)
+        }
+    }
+}
+
+// Hash identifies the bitmap by its dimensions and the palette color of every pixel,
+// so identical images match even when drawn with different palette entries
+func (b *Bitmap) Hash() string {
+    h := sha256.New()
+    var buf [4]byte
+    binary.BigEndian.PutUint16(buf[:2], uint16(len(b.Pixels)))
+    h.Write(buf[:2])
+    for _, row := range b.Pixels {
+        binary.BigEndian.PutUint16(buf[:2], uint16(len(row)))
+        h.Write(buf[:2])
+        for _, px := range row {
+            p := b.Palettes[px]
+            buf[0], buf[1], buf[2], buf[3] = p.Y, p.Cr, p.Cb, p.A
+            h.Write(buf[:])
+        }
+    }
+    return hex.EncodeToString(h.Sum(nil))
+}
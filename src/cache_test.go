@@ -0,0 +1,56 @@
+package suptext
+
+import (
+	"testing"
+)
+
+func TestBitmapHash(t *testing.T) {
+	var palettes [256]PaletteDefinition
+	palettes[1] = PaletteDefinition{Y: 235, Cr: 128, Cb: 128, A: 255}
+	palettes[2] = PaletteDefinition{Y: 235, Cr: 128, Cb: 128, A: 255}
+	palettes[3] = PaletteDefinition{Y: 235, Cr: 128, Cb: 128, A: 128}
+
+	a := Bitmap{Pixels: [][]uint8{{0, 1}, {1, 0}}, Palettes: palettes}
+	b := Bitmap{Pixels: [][]uint8{{0, 2}, {2, 0}}, Palettes: palettes}
+	faded := Bitmap{Pixels: [][]uint8{{0, 3}, {3, 0}}, Palettes: palettes}
+	reshaped := Bitmap{Pixels: [][]uint8{{0, 1, 1, 0}}, Palettes: palettes}
+
+	if a.Hash() != b.Hash() {
+		t.Error("Expected identical images with different palette entries to match")
+	}
+	if a.Hash() == faded.Hash() {
+		t.Error("Expected faded image not to match")
+	}
+	if a.Hash() == reshaped.Hash() {
+		t.Error("Expected image with different dimensions not to match")
+	}
+}
+
+func TestOCRCache(t *testing.T) {
+	cache := NewOCRCache()
+	if _, ok := cache.Get("a"); ok {
+		t.Error("Expected miss on empty cache")
+	}
+	cache.Put("a", OCRResult{Text: "Hello", Words: 1, Confidence: 90, MinConfidence: 90})
+	result, ok := cache.Get("a")
+	if !ok || result.Text != "Hello" {
+		t.Errorf("Expected cached result, got %+v", result)
+	}
+	if cache.Hits != 1 || cache.Misses != 1 {
+		t.Errorf("Expected 1 hit and 1 miss, got %d hits %d misses", cache.Hits, cache.Misses)
+	}
+}
+
+func TestBitmapOCR_CacheHit(t *testing.T) {
+	bmp := Bitmap{Pixels: [][]uint8{{1}}}
+	cache := NewOCRCache()
+	cache.Put(bmp.Hash(), OCRResult{Text: "Cached"})
+	// A cached bitmap never reaches the OCR client
+	result, err := bmp.OCR(nil, cache)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if result.Text != "Cached" {
+		t.Errorf("Expected cached text, got %q", result.Text)
+	}
+}
@@ -0,0 +1,122 @@
+package suptext
+
+import (
+    "fmt"
+    "image/color"
+)
+
+// Palette entries below these values are treated as background, outline or anti-aliasing
+const FillMinAlpha = 0x80
+const FillMinLuma = 0x20
+
+// Default subtitle colors are considered bright when every relevant RGB channel is above this value
+const DefaultColorMinLevel = 0xc0
+const DefaultColorMaxBlue = 0x60
+
+func (p PaletteDefinition) RGB() (uint8, uint8, uint8) {
+    return color.YCbCrToRGB(p.Y, p.Cb, p.Cr)
+}
+
+func (p PaletteDefinition) Hex() string {
+    r, g, b := p.RGB()
+    return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
+
+// IsFill reports whether the palette entry can be the fill color of a glyph
+func (p PaletteDefinition) IsFill() bool {
+    return p.A >= FillMinAlpha && p.Y >= FillMinLuma
+}
+
+// IsDefaultTextColor reports whether the palette entry is white or yellow
+func (p PaletteDefinition) IsDefaultTextColor() bool {
+    r, g, b := p.RGB()
+    if r < DefaultColorMinLevel || g < DefaultColorMinLevel {
+        return false
+    }
+    return b >= DefaultColorMinLevel || b <= DefaultColorMaxBlue
+}
+
+// DominantFillColor returns the most used fill palette entry within the given rows of pixels
+func DominantFillColor(pixels [][]uint8, palettes [256]PaletteDefinition) (PaletteDefinition, bool) {
+    var counts [256]int
+    for _, row := range pixels {
+        for _, px := range row {
+            counts[px]++
+        }
+    }
+
+    best := -1
+    for i, n := range counts {
+        if n == 0 || !palettes[i].IsFill() {
+            continue
+        }
+        if best < 0 || n > counts[best] {
+            best = i
+        }
+    }
+    if best < 0 {
+        return PaletteDefinition{}, false
+    }
+    return palettes[best], true
+}
+
+// TextBands returns the [start, end) row ranges of pixels that contain fill colored pixels
+func TextBands(pixels [][]uint8, palettes [256]PaletteDefinition) [][2]int {
+    var bands [][2]int
+    start := -1
+    for row, line := range pixels {
+        filled := false
+        for _, px := range line {
+            if palettes[px].IsFill() {
+                filled = true
+                break
+            }
+        }
+        if filled && start < 0 {
+            start = row
+        } else if !filled && start >= 0 {
+            bands = append(bands, [2]int{start, row})
+            start = -1
+        }
+    }
+    if start >= 0 {
+        bands = append(bands, [2]int{start, len(pixels)})
+    }
+    return bands
+}
+
+// LineColors returns the fill color of each recognized text line, empty for default colors.
+// Colors are matched per line when the bitmap has exactly one band of pixels per non-empty
+// line, otherwise the dominant color of the whole bitmap is used for all lines.
+func (b *Bitmap) LineColors(texts []string) []string {
+    colors := make([]string, len(texts))
+
+    var nonEmpty []int
+    for i, t := range texts {
+        if t != "" {
+            nonEmpty = append(nonEmpty, i)
+        }
+    }
+
+    bands := TextBands(b.Pixels, b.Palettes)
+    if len(bands) == len(nonEmpty) {
+        for j, i := range nonEmpty {
+            colors[i] = b.colorHex(b.Pixels[bands[j][0]:bands[j][1]])
+        }
+        return colors
+    }
+
+    hex := b.colorHex(b.Pixels)
+    for _, i := range nonEmpty {
+        colors[i] = hex
+    }
+    return colors
+}
+
+func (b *Bitmap) colorHex(pixels [][]uint8) string {
+    fill, ok := DominantFillColor(pixels, b.Palettes)
+    if !ok || fill.IsDefaultTextColor() {
+        return ""
+    }
+    return fill.Hex()
+}
@@ -0,0 +1,112 @@
+package suptext
+
+import (
+	"testing"
+)
+
+// Palette with transparent background, black outline, white, yellow and cyan fills
+func testColorPalettes() [256]PaletteDefinition {
+	var palettes [256]PaletteDefinition
+	palettes[1] = PaletteDefinition{Y: 16, Cr: 128, Cb: 128, A: 255}  // Black outline
+	palettes[2] = PaletteDefinition{Y: 235, Cr: 128, Cb: 128, A: 255} // White
+	palettes[3] = PaletteDefinition{Y: 210, Cr: 146, Cb: 16, A: 255}  // Yellow
+	palettes[4] = PaletteDefinition{Y: 170, Cr: 16, Cb: 166, A: 255}  // Cyan
+	palettes[5] = PaletteDefinition{Y: 170, Cr: 16, Cb: 166, A: 32}   // Faded cyan
+	return palettes
+}
+
+func TestIsDefaultTextColor(t *testing.T) {
+	palettes := testColorPalettes()
+	if !palettes[2].IsDefaultTextColor() {
+		t.Errorf("Expected white %s to be a default color", palettes[2].Hex())
+	}
+	if !palettes[3].IsDefaultTextColor() {
+		t.Errorf("Expected yellow %s to be a default color", palettes[3].Hex())
+	}
+	if palettes[4].IsDefaultTextColor() {
+		t.Errorf("Expected cyan %s not to be a default color", palettes[4].Hex())
+	}
+}
+
+func TestDominantFillColor_IgnoresOutlineAndTransparent(t *testing.T) {
+	palettes := testColorPalettes()
+	pixels := [][]uint8{
+		{0, 1, 1, 1, 1, 0},
+		{1, 4, 4, 5, 5, 1},
+		{0, 1, 1, 5, 5, 0},
+	}
+	fill, ok := DominantFillColor(pixels, palettes)
+	if !ok {
+		t.Fatal("Expected a fill color")
+	}
+	if fill != palettes[4] {
+		t.Errorf("Expected cyan fill, got %+v", fill)
+	}
+}
+
+func TestDominantFillColor_NoFill(t *testing.T) {
+	palettes := testColorPalettes()
+	pixels := [][]uint8{{0, 1, 1, 0}}
+	if _, ok := DominantFillColor(pixels, palettes); ok {
+		t.Error("Expected no fill color for outline-only pixels")
+	}
+}
+
+func TestTextBands(t *testing.T) {
+	palettes := testColorPalettes()
+	pixels := [][]uint8{
+		{0, 0, 0},
+		{0, 2, 0},
+		{1, 2, 1},
+		{0, 1, 0},
+		{0, 4, 0},
+	}
+	bands := TextBands(pixels, palettes)
+	if len(bands) != 2 {
+		t.Fatalf("Expected 2 bands, got %d: %v", len(bands), bands)
+	}
+	if bands[0] != [2]int{1, 3} {
+		t.Errorf("Expected first band [1 3], got %v", bands[0])
+	}
+	if bands[1] != [2]int{4, 5} {
+		t.Errorf("Expected second band [4 5], got %v", bands[1])
+	}
+}
+
+func TestLineColors_PerLine(t *testing.T) {
+	palettes := testColorPalettes()
+	bmp := Bitmap{
+		Pixels: [][]uint8{
+			{1, 2, 2, 1},
+			{0, 0, 0, 0},
+			{1, 4, 4, 1},
+		},
+		Palettes: palettes,
+	}
+	colors := bmp.LineColors([]string{"Hello", "There"})
+	if colors[0] != "" {
+		t.Errorf("Expected default color for white line, got %q", colors[0])
+	}
+	if colors[1] != palettes[4].Hex() {
+		t.Errorf("Expected %s for cyan line, got %q", palettes[4].Hex(), colors[1])
+	}
+}
+
+func TestLineColors_FallbackToBitmap(t *testing.T) {
+	palettes := testColorPalettes()
+	bmp := Bitmap{
+		Pixels: [][]uint8{
+			{1, 4, 4, 1},
+			{1, 4, 4, 1},
+		},
+		Palettes: palettes,
+	}
+	// Two lines of text but a single band of pixels
+	colors := bmp.LineColors([]string{"Hello", "", "There"})
+	if colors[0] != palettes[4].Hex() || colors[2] != palettes[4].Hex() {
+		t.Errorf("Expected bitmap color on all lines, got %v", colors)
+	}
+	if colors[1] != "" {
+		t.Errorf("Expected no color on empty line, got %q", colors[1])
+	}
+}
@@ -0,0 +1,210 @@
+package suptext
+
+import (
+    "bufio"
+    _ "embed"
+    "fmt"
+    "io"
+    "os"
+    "regexp"
+    "strconv"
+    "strings"
+    "unicode"
+)
+
+// Correction rule kinds
+const (
+    RuleLiteral = "literal"
+    RuleRegex = "regex"
+    RuleWord = "word"
+)
+
+// Word rule contexts
+const (
+    WordWhole = "whole"
+    WordStart = "start"
+    WordEnd = "end"
+)
+
+//go:embed rules/eng.rules
+var englishRules string
+
+// Rule is a single OCR correction, see rules/eng.rules for the file format
+type Rule struct {
+    Kind string
+    From string
+    To string
+    Context string
+    Line int // Line number in the rules file
+    re *regexp.Regexp
+}
+
+// RuleSet is an ordered list of correction rules
+type RuleSet []Rule
+
+// DefaultRules returns the built-in English correction rules
+func DefaultRules() RuleSet {
+    rules, err := ParseRules(strings.NewReader(englishRules))
+    if err != nil {
+        panic(fmt.Sprintf("Invalid built-in rules: %v", err))
+    }
+    return rules
+}
+
+// CorrectionRules returns the rules selected by opts, nil if corrections are disabled
+func CorrectionRules(opts Options) (RuleSet, error) {
+    if opts.Rules != "" {
+        return LoadRules(opts.Rules)
+    }
+    if opts.Fix {
+        return DefaultRules(), nil
+    }
+    return nil, nil
+}
+
+func LoadRules(fname string) (RuleSet, error) {
+    f, err := os.Open(fname)
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    rules, err := ParseRules(f)
+    if err != nil {
+        return nil, fmt.Errorf("Invalid rules file %s: %v", fname, err)
+    }
+    return rules, nil
+}
+
+func ParseRules(r io.Reader) (RuleSet, error) {
+    var rules RuleSet
+    scanner := bufio.NewScanner(r)
+    for n := 1; scanner.Scan(); n++ {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        rule, err := NewRule(line)
+        if err != nil {
+            return nil, fmt.Errorf("line %d: %v", n, err)
+        }
+        rule.Line = n
+        rules = append(rules, rule)
+    }
+    return rules, scanner.Err()
+}
+
+// NewRule parses a rule line: <kind> <from> <to> [context]
+func NewRule(line string) (Rule, error) {
+    kind, rest, _ := strings.Cut(line, " ")
+    from, rest, err := unquotePrefix(rest)
+    if err != nil {
+        return Rule{}, fmt.Errorf("invalid <from>: %v", err)
+    }
+    to, rest, err := unquotePrefix(rest)
+    if err != nil {
+        return Rule{}, fmt.Errorf("invalid <to>: %v", err)
+    }
+    rule := Rule{Kind: kind, From: from, To: to, Context: strings.TrimSpace(rest)}
+
+    if rule.From == "" {
+        return Rule{}, fmt.Errorf("empty <from>")
+    }
+    switch rule.Kind {
+    case RuleLiteral:
+    case RuleRegex:
+        rule.re, err = regexp.Compile(rule.From)
+        if err != nil {
+            return Rule{}, err
+        }
+    case RuleWord:
+        if rule.Context == "" {
+            rule.Context = WordWhole
+        }
+        if rule.Context != WordWhole && rule.Context != WordStart && rule.Context != WordEnd {
+            return Rule{}, fmt.Errorf("unknown word context '%s'", rule.Context)
+        }
+        return rule, nil
+    default:
+        return Rule{}, fmt.Errorf("unknown rule kind '%s'", rule.Kind)
+    }
+    if rule.Context != "" {
+        return Rule{}, fmt.Errorf("context is only supported by %s rules", RuleWord)
+    }
+    return rule, nil
+}
+
+// unquotePrefix reads a Go quoted string from the start of s and returns it with the remainder
+func unquotePrefix(s string) (string, string, error) {
+    s = strings.TrimLeft(s, " \t")
+    quoted, err := strconv.QuotedPrefix(s)
+    if err != nil {
+        return "", "", err
+    }
+    text, err := strconv.Unquote(quoted)
+    return text, s[len(quoted):], err
+}
+
+func (r *Rule) Apply(line string) string {
+    switch r.Kind {
+    case RuleLiteral:
+        return strings.ReplaceAll(line, r.From, r.To)
+    case RuleRegex:
+        return r.re.ReplaceAllString(line, r.To)
+    }
+
+    words := strings.Split(line, " ")
+    for i, w := range words {
+        // Keep punctuation around the word as is
+        core := strings.TrimFunc(w, isWordPunctuation)
+        if core == "" {
+            continue
+        }
+        lead := strings.Index(w, core)
+        fixed := core
+        switch {
+        case r.Context == WordWhole && core == r.From:
+            fixed = r.To
+        case r.Context == WordStart && strings.HasPrefix(core, r.From):
+            fixed = r.To + core[len(r.From):]
+        case r.Context == WordEnd && strings.HasSuffix(core, r.From):
+            fixed = core[:len(core) - len(r.From)] + r.To
+        }
+        words[i] = w[:lead] + fixed + w[lead + len(core):]
+    }
+    return strings.Join(words, " ")
+}
+
+func isWordPunctuation(r rune) bool {
+    return strings.ContainsRune(".,!?:;\"()[]¿¡-…", r) || unicode.IsSpace(r)
+}
+
+// Apply runs every rule in order over a line of text
+func (rs RuleSet) Apply(line string) string {
+    for i := range rs {
+        line = rs[i].Apply(line)
+    }
+    return line
+}
+
+// ApplyCues corrects the lines of cues in place, dropping lines left empty by the rules.
+// Returns the number of lines changed.
+func (rs RuleSet) ApplyCues(cues []Cue) int {
+    changed := 0
+    for i := range cues {
+        var lines []CueLine
+        for _, l := range cues[i].Lines {
+            fixed := rs.Apply(l.Text)
+            if fixed != l.Text {
+                changed++
+            }
+            if fixed == "" && l.Text != "" {
+                continue
+            }
+            l.Text = fixed
+            lines = append(lines, l)
+        }
+        cues[i].Lines = lines
+    }
+    return changed
+}
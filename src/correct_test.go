@@ -0,0 +1,98 @@
+package suptext
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaultRules(t *testing.T) {
+	rules := DefaultRules()
+	cases := map[string]string{
+		"|'m not sure.":          "I'm not sure.",
+		"l'll be there, wilI you?": "I'll be there, will you?",
+		"\"lt's fine,\" l said.":  "\"It's fine,\" I said.",
+		"0h, that's 0K.":         "Oh, that's OK.",
+		"G0OD M0RNING":           "GOOD MORNING",
+		"J' Singing in the rain": "♪ Singing in the rain",
+		". Stray dot":            "Stray dot",
+		"It's 10:00 at 007":      "It's 10:00 at 007",
+		"...":                    "...",
+		"Lillian":                "Lillian",
+	}
+	for in, expected := range cases {
+		if got := rules.Apply(in); got != expected {
+			t.Errorf("Apply(%q): expected %q, got %q", in, expected, got)
+		}
+	}
+}
+
+func TestNewRule_Word(t *testing.T) {
+	rule, err := NewRule("word \"rn\" `m` start")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if got := rule.Apply("rnore (rnaybe) burn"); got != "more (maybe) burn" {
+		t.Errorf("Unexpected result %q", got)
+	}
+	rule, _ = NewRule("word \"rn\" \"m\" end")
+	if got := rule.Apply("burn rnore"); got != "bum rnore" {
+		t.Errorf("Unexpected result %q", got)
+	}
+}
+
+func TestNewRule_Invalid(t *testing.T) {
+	invalid := []string{
+		`swap "a" "b"`,
+		`literal a b`,
+		`literal "" "b"`,
+		`regex "(" "b"`,
+		`word "a" "b" middle`,
+		`literal "a" "b" start`,
+	}
+	for _, line := range invalid {
+		if _, err := NewRule(line); err == nil {
+			t.Errorf("Expected error for rule %q", line)
+		}
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "show.rules")
+	content := "# Show names\nword \"Kenobl\" \"Kenobi\"\n\nliteral \"--\" \"—\"\n"
+	if err := os.WriteFile(fname, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRules(fname)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(rules) != 2 || rules[1].Line != 4 {
+		t.Fatalf("Expected 2 rules with line numbers, got %+v", rules)
+	}
+	if got := rules.Apply("Kenobl-- wait"); got != "Kenobi— wait" {
+		t.Errorf("Unexpected result %q", got)
+	}
+	if got := rules.Apply("General Kenobl!"); got != "General Kenobi!" {
+		t.Errorf("Unexpected result %q", got)
+	}
+
+	if err := os.WriteFile(fname, []byte("literal \"a\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRules(fname); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("Expected error with line number, got %v", err)
+	}
+}
+
+func TestApplyCues_DropsEmptiedLines(t *testing.T) {
+	cues := []Cue{{Lines: []CueLine{{Text: "'"}, {Text: "|t's me", Color: "#00ffff"}}}}
+	changed := DefaultRules().ApplyCues(cues)
+	if changed != 2 {
+		t.Errorf("Expected 2 changed lines, got %d", changed)
+	}
+	if len(cues[0].Lines) != 1 || cues[0].Lines[0].Text != "It's me" || cues[0].Lines[0].Color != "#00ffff" {
+		t.Errorf("Unexpected lines %+v", cues[0].Lines)
+	}
+}
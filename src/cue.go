@@ -0,0 +1,79 @@
+package suptext
+
+import (
+    "fmt"
+    "io"
+    "strings"
+)
+
+// Cue is a single recognized subtitle with its display interval in milliseconds
+type Cue struct {
+    Index uint
+    Start uint32
+    End uint32
+    Lines []CueLine
+    Set int // Index of the display set in PGS.Sections
+    Forced bool // Contains forced composition objects
+    // Tesseract word confidences (0-100) over all objects of the display set
+    Words int
+    Confidence float64
+    MinConfidence float64
+    Errors int // Objects the OCR engine failed on
+}
+
+// CueLine is a line of recognized text and its fill color ("#rrggbb"), empty for default color
+type CueLine struct {
+    Text string
+    Color string
+}
+
+func (l *CueLine) SRT() string {
+    if l.Color == "" || l.Text == "" {
+        return l.Text
+    }
+    return fmt.Sprintf("<font color=\"%s\">%s</font>", l.Color, l.Text)
+}
+
+func (c *Cue) Text() string {
+    return JoinLines(c.Lines)
+}
+
+func (c *Cue) SRT() string {
+    texts := make([]string, len(c.Lines))
+    for i := range c.Lines {
+        texts[i] = c.Lines[i].SRT()
+    }
+    sts := FormatMilliseconds(c.Start)
+    ets := FormatMilliseconds(c.End)
+    return fmt.Sprintf("%d\n%s --> %s\n%s\n\n", c.Index, sts, ets, strings.Join(texts, "\n"))
+}
+
+// JoinLines returns the plain text of lines, newline separated
+func JoinLines(lines []CueLine) string {
+    texts := make([]string, len(lines))
+    for i, l := range lines {
+        texts[i] = l.Text
+    }
+    return strings.Join(texts, "\n")
+}
+
+// ForcedCues returns the forced cues, numbered from 1
+func ForcedCues(cues []Cue) []Cue {
+    var forced []Cue
+    for _, cue := range cues {
+        if cue.Forced {
+            cue.Index = uint(len(forced) + 1)
+            forced = append(forced, cue)
+        }
+    }
+    return forced
+}
+
+func WriteSRT(w io.Writer, cues []Cue) error {
+    for _, cue := range cues {
+        if _, err := io.WriteString(w, cue.SRT()); err != nil {
+            return fmt.Errorf("Failed to write SRT: %v", err)
+        }
+    }
+    return nil
+}
@@ -0,0 +1,50 @@
+package suptext
+
+import (
+	"testing"
+)
+
+func TestCueSRT(t *testing.T) {
+	cue := Cue{
+		Index: 3,
+		Start: 1500,
+		End:   3250,
+		Lines: []CueLine{
+			{Text: "Hello"},
+			{Text: "There", Color: "#00ffff"},
+		},
+	}
+	expected := "3\n00:00:01,500 --> 00:00:03,250\nHello\n<font color=\"#00ffff\">There</font>\n\n"
+	if got := cue.SRT(); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+	if got := cue.Text(); got != "Hello\nThere" {
+		t.Errorf("Expected plain text without tags, got %q", got)
+	}
+}
+
+func TestCueLineSRT_EmptyText(t *testing.T) {
+	line := CueLine{Color: "#ff0000"}
+	if got := line.SRT(); got != "" {
+		t.Errorf("Expected empty line without tags, got %q", got)
+	}
+}
+
+func TestForcedCues(t *testing.T) {
+	cues := []Cue{
+		{Index: 1, Start: 1000, Lines: []CueLine{{Text: "Hello"}}},
+		{Index: 2, Start: 2000, Forced: true, Lines: []CueLine{{Text: "Bonjour"}}},
+		{Index: 3, Start: 3000, Forced: true, Lines: []CueLine{{Text: "Au revoir"}}},
+	}
+	forced := ForcedCues(cues)
+	if len(forced) != 2 {
+		t.Fatalf("Expected 2 forced cues, got %d", len(forced))
+	}
+	if forced[0].Index != 1 || forced[0].Start != 2000 || forced[1].Index != 2 {
+		t.Errorf("Expected forced cues renumbered from 1, got %+v", forced)
+	}
+	// The full list keeps its numbering
+	if cues[1].Index != 2 {
+		t.Errorf("Expected original cue index 2, got %d", cues[1].Index)
+	}
+}
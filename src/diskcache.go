@@ -0,0 +1,198 @@
+package suptext
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Temp files left by interrupted writes are removed by Prune once older than this
+const DiskCacheStaleTemp = time.Hour
+
+const diskCacheExt = ".json"
+
+// DiskCache persists OCR results across files and runs in a directory shared by suptext processes.
+// Entries are written to a temp file then renamed, so concurrent readers never see partial entries.
+type DiskCache struct {
+    Dir string
+    // Settings fingerprint mixed into every key, results of other OCR settings never match
+    Fingerprint string
+}
+
+func NewDiskCache(dir string, fingerprint string) (*DiskCache, error) {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return nil, fmt.Errorf("Failed to create cache directory: %v", err)
+    }
+    return &DiskCache{Dir: dir, Fingerprint: fingerprint}, nil
+}
+
+// DefaultCacheDir returns the per-user cache directory of suptext
+func DefaultCacheDir() string {
+    dir, err := os.UserCacheDir()
+    if err != nil {
+        dir = os.TempDir()
+    }
+    return filepath.Join(dir, "suptext")
+}
+
+func (c *DiskCache) path(key string) string {
+    sum := sha256.Sum256([]byte(c.Fingerprint + "\x00" + key))
+    name := hex.EncodeToString(sum[:])
+    return filepath.Join(c.Dir, name[:2], name + diskCacheExt)
+}
+
+// Get reads the result of a bitmap hash, refreshing the entry's modification time for pruning
+func (c *DiskCache) Get(key string) (OCRResult, bool) {
+    var result OCRResult
+    fname := c.path(key)
+    data, err := os.ReadFile(fname)
+    if err != nil {
+        return result, false
+    }
+    if err := json.Unmarshal(data, &result); err != nil {
+        return result, false
+    }
+    now := time.Now()
+    os.Chtimes(fname, now, now)
+    return result, true
+}
+
+func (c *DiskCache) Put(key string, result OCRResult) error {
+    fname := c.path(key)
+    data, err := json.Marshal(result)
+    if err != nil {
+        return err
+    }
+    if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+        return err
+    }
+    return writeFileAtomic(fname, data)
+}
+
+// writeFileAtomic replaces fname by data through a temp file, readers never see partial writes
+func writeFileAtomic(fname string, data []byte) error {
+    tmp, err := os.CreateTemp(filepath.Dir(fname), ".tmp-*")
+    if err != nil {
+        return err
+    }
+    if _, err := tmp.Write(data); err != nil {
+        tmp.Close()
+        os.Remove(tmp.Name())
+        return err
+    }
+    if err := tmp.Close(); err != nil {
+        os.Remove(tmp.Name())
+        return err
+    }
+    if err := os.Rename(tmp.Name(), fname); err != nil {
+        os.Remove(tmp.Name())
+        return err
+    }
+    return nil
+}
+
+// PruneResult reports what Prune removed and kept
+type PruneResult struct {
+    Removed int
+    Freed int64
+    Entries int
+    Size int64
+}
+
+// Prune removes the least recently used entries until the cache is at most maxSize bytes,
+// along with stale temp files. A maxSize of 0 only removes stale temp files.
+func (c *DiskCache) Prune(maxSize int64) (PruneResult, error) {
+    return PruneCacheDir(c.Dir, maxSize)
+}
+
+func PruneCacheDir(dir string, maxSize int64) (PruneResult, error) {
+    type entry struct {
+        path string
+        size int64
+        mtime time.Time
+    }
+    var res PruneResult
+    var entries []entry
+
+    err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+        if err != nil {
+            // Entries removed by a concurrent prune
+            if os.IsNotExist(err) {
+                return nil
+            }
+            return err
+        }
+        if d.IsDir() {
+            return nil
+        }
+        info, err := d.Info()
+        if err != nil {
+            return nil
+        }
+        if strings.HasPrefix(d.Name(), ".tmp-") {
+            if time.Since(info.ModTime()) > DiskCacheStaleTemp && os.Remove(path) == nil {
+                res.Removed++
+                res.Freed += info.Size()
+            }
+            return nil
+        }
+        if filepath.Ext(path) == diskCacheExt {
+            entries = append(entries, entry{path, info.Size(), info.ModTime()})
+            res.Size += info.Size()
+        }
+        return nil
+    })
+    if err != nil {
+        return res, err
+    }
+
+    // Oldest entries go first
+    sort.Slice(entries, func(i, j int) bool {
+        return entries[i].mtime.Before(entries[j].mtime)
+    })
+    res.Entries = len(entries)
+    for _, e := range entries {
+        if maxSize <= 0 || res.Size <= maxSize {
+            break
+        }
+        if err := os.Remove(e.path); err != nil && !os.IsNotExist(err) {
+            return res, err
+        }
+        res.Removed++
+        res.Freed += e.size
+        res.Size -= e.size
+        res.Entries--
+    }
+    return res, nil
+}
+
+// ParseSize parses a byte size with an optional K, M or G suffix, e.g. 500M
+func ParseSize(s string) (int64, error) {
+    s = strings.ToUpper(strings.TrimSpace(s))
+    s = strings.TrimSuffix(s, "B")
+    mult := int64(1)
+    switch {
+    case strings.HasSuffix(s, "K"):
+        mult = 1 << 10
+    case strings.HasSuffix(s, "M"):
+        mult = 1 << 20
+    case strings.HasSuffix(s, "G"):
+        mult = 1 << 30
+    }
+    if mult > 1 {
+        s = s[:len(s) - 1]
+    }
+    n, err := strconv.ParseInt(s, 10, 64)
+    if err != nil || n < 0 {
+        return 0, fmt.Errorf("Invalid size '%s'", s)
+    }
+    return n * mult, nil
+}
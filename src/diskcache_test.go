@@ -0,0 +1,123 @@
+package suptext
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDiskCache_PutGet(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewDiskCache(dir, "settings-a")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, ok := cache.Get("bitmap"); ok {
+		t.Error("Expected miss on empty cache")
+	}
+	want := OCRResult{Text: "Hello\nThere", Words: 2, Confidence: 91.5, MinConfidence: 88}
+	if err := cache.Put("bitmap", want); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	got, ok := cache.Get("bitmap")
+	if !ok || got != want {
+		t.Errorf("Expected %+v, got %+v (%v)", want, got, ok)
+	}
+
+	// Another process with other OCR settings doesn't share entries
+	other, _ := NewDiskCache(dir, "settings-b")
+	if _, ok := other.Get("bitmap"); ok {
+		t.Error("Expected miss for other settings fingerprint")
+	}
+}
+
+func TestDiskCache_ConcurrentPut(t *testing.T) {
+	cache, _ := NewDiskCache(t.TempDir(), "")
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := cache.Put("bitmap", OCRResult{Text: "Same"}); err != nil {
+				t.Errorf("Expected no error, got: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got, ok := cache.Get("bitmap"); !ok || got.Text != "Same" {
+		t.Errorf("Expected entry after concurrent writes, got %+v (%v)", got, ok)
+	}
+}
+
+func TestDiskCache_Prune(t *testing.T) {
+	cache, _ := NewDiskCache(t.TempDir(), "")
+	keys := []string{"old", "mid", "new"}
+	now := time.Now()
+	for i, k := range keys {
+		if err := cache.Put(k, OCRResult{Text: "0123456789"}); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(time.Duration(i-3) * time.Hour)
+		os.Chtimes(cache.path(k), mtime, mtime)
+	}
+	info, _ := os.Stat(cache.path("old"))
+	entrySize := info.Size()
+
+	// Stale temp file of an interrupted write
+	tmp := filepath.Join(cache.Dir, ".tmp-1")
+	os.WriteFile(tmp, []byte("partial"), 0644)
+	stale := now.Add(-2 * DiskCacheStaleTemp)
+	os.Chtimes(tmp, stale, stale)
+
+	res, err := cache.Prune(2 * entrySize)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if res.Removed != 2 || res.Entries != 2 || res.Size != 2*entrySize {
+		t.Errorf("Unexpected prune result %+v", res)
+	}
+	if _, ok := cache.Get("old"); ok {
+		t.Error("Expected least recently used entry to be pruned")
+	}
+	if _, ok := cache.Get("new"); !ok {
+		t.Error("Expected most recent entry to be kept")
+	}
+	if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+		t.Error("Expected stale temp file to be removed")
+	}
+}
+
+func TestOCRCache_Disk(t *testing.T) {
+	disk, _ := NewDiskCache(t.TempDir(), "")
+	first := NewOCRCache()
+	first.Disk = disk
+	first.Put("bitmap", OCRResult{Text: "Persisted"})
+
+	// A later run finds the result on disk
+	second := NewOCRCache()
+	second.Disk = disk
+	if got, ok := second.Get("bitmap"); !ok || got.Text != "Persisted" {
+		t.Errorf("Expected persisted result, got %+v (%v)", got, ok)
+	}
+	second.Get("bitmap")
+	if second.Hits != 2 || second.DiskHits != 1 || second.Misses != 0 {
+		t.Errorf("Expected 2 hits with 1 from disk, got %+v", second)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	cases := map[string]int64{"0": 0, "1024": 1024, "2K": 2048, "500M": 500 << 20, "1g": 1 << 30, "3MB": 3 << 20}
+	for in, expected := range cases {
+		got, err := ParseSize(in)
+		if err != nil || got != expected {
+			t.Errorf("ParseSize(%q): expected %d, got %d (%v)", in, expected, got, err)
+		}
+	}
+	for _, in := range []string{"", "M", "-1", "1T"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("Expected error for %q", in)
+		}
+	}
+}
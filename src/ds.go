@@ -1,11 +1,12 @@
 package suptext
 
 import (
+    "context"
     "encoding/json"
     "fmt"
+    "image"
     "log"
-    "os"
-	"github.com/otiai10/gosseract/v2"
+    "strings"
 )
 
 type DisplaySet struct {
@@ -47,6 +48,16 @@ func (d *DisplaySet) GetActiveCompositionObjects() []CompositionObject {
     return pcsData.Comps
 }
 
+// IsForced reports whether any active composition object is forced, i.e. shown even when subtitles are off
+func (d *DisplaySet) IsForced() bool {
+    for _, comp := range d.GetActiveCompositionObjects() {
+        if comp.Forced {
+            return true
+        }
+    }
+    return false
+}
+
 // ValidateWindowCompositionLinkage checks that all composition objects reference valid windows
 func (d *DisplaySet) ValidateWindowCompositionLinkage() error {
     if d.PCS.Data == nil || d.WDS.Data == nil {
@@ -98,27 +109,103 @@ func (d *DisplaySet) GetScreenDimensions() (uint16, uint16) {
     return DefaultScreenWidth, DefaultScreenHeight
 }
 
-func (d *DisplaySet) AppendSRT(ocr *gosseract.Client, f *os.File, i uint, ets string) error {
-    text, err := d.OCR(ocr)
+// Recognize OCRs the active objects of the display set into a cue with its lines and word confidences.
+// Bitmaps already recognized are taken from cache if not nil. Cue index and timing are left for the caller to fill.
+func (d *DisplaySet) Recognize(engine OCREngine, opts Options, cache *OCRCache) (Cue, error) {
+    return d.RecognizeContext(context.Background(), NewContextEngine(engine), opts, cache)
+}
+
+// RecognizeContext is Recognize counting the objects left once ctx is done as OCR errors
+func (d *DisplaySet) RecognizeContext(ctx context.Context, engine ContextEngine, opts Options, cache *OCRCache) (Cue, error) {
+    cue := Cue{Forced: d.IsForced()}
+    var sum float64
+
+    for _, bmp := range d.Bitmaps() {
+        result, err := bmp.OCRContext(ctx, engine, cache)
+        if err != nil {
+            // The caller reports cues cut short
+            if ctx.Err() == nil {
+                log.Printf("Warning: OCR failed for ODS ID %d: %v", bmp.ObjID, err)
+            }
+            cue.Errors++
+            continue
+        }
+        cue.Lines = append(cue.Lines, bmp.Lines(result.Text, opts)...)
+        // Merge word confidences of all objects
+        if result.Words > 0 && (cue.Words == 0 || result.MinConfidence < cue.MinConfidence) {
+            cue.MinConfidence = result.MinConfidence
+        }
+        sum += result.Confidence * float64(result.Words)
+        cue.Words += result.Words
+    }
+    if cue.Words > 0 {
+        cue.Confidence = sum / float64(cue.Words)
+    }
+    return cue, nil
+}
+
+// Bitmap is a decoded object of a display set, ready for recognition
+type Bitmap struct {
+    ObjID uint16
+    X int // Screen position from the composition object
+    Y int
+    Pixels [][]uint8
+    Palettes [256]PaletteDefinition
+    Image *image.RGBA
+}
+
+// OCR recognizes the bitmap with engine, or takes the result of an identical bitmap from cache
+func (b *Bitmap) OCR(engine OCREngine, cache *OCRCache) (OCRResult, error) {
+    return b.OCRContext(context.Background(), NewContextEngine(engine), cache)
+}
+
+// OCRContext is OCR giving up once ctx is done
+func (b *Bitmap) OCRContext(ctx context.Context, engine ContextEngine, cache *OCRCache) (OCRResult, error) {
+    var key string
+    if cache != nil {
+        key = b.Hash()
+        if result, ok := cache.Get(key); ok {
+            return result, nil
+        }
+    }
+    result, err := engine.RecognizeContext(ctx, b)
     if err != nil {
-        return err
+        return OCRResult{}, err
     }
-    sts := d.StartTS()
-    srt := fmt.Sprintf("%d\n%s --> %s\n%s\n\n", i, sts, ets, text)
-    if _, err := f.WriteString(srt); err != nil {
-        log.Fatalf("Failed to write to file: %v", err)
+    if cache != nil {
+        cache.Put(key, result)
     }
-    return nil
+    return result, nil
 }
 
-func (d *DisplaySet) OCR(ocr *gosseract.Client) (string, error) {
-    var text, ocr_result string
+// Lines splits the recognized text of the bitmap into CueLines, attaching fill colors if requested
+func (b *Bitmap) Lines(text string, opts Options) []CueLine {
+    texts := strings.Split(text, "\n")
+    lines := make([]CueLine, len(texts))
+    var colors []string
+    if opts.KeepColors {
+        colors = b.LineColors(texts)
+    }
+    for i, t := range texts {
+        lines[i].Text = t
+        if colors != nil {
+            lines[i].Color = colors[i]
+        }
+    }
+    return lines
+}
+
+// Bitmaps decodes the ODS referenced by the active composition objects into images
+func (d *DisplaySet) Bitmaps() []Bitmap {
+    var bitmaps []Bitmap
 
     // Get active composition objects to filter ODS processing
     activeComps := d.GetActiveCompositionObjects()
     activeObjIDs := make(map[uint16]bool)
+    positions := make(map[uint16]CompositionObject)
     for _, comp := range activeComps {
         activeObjIDs[comp.ObjID] = true
+        positions[comp.ObjID] = comp
     }
 
     // If no active composition objects, log warning but continue processing all ODS
@@ -184,26 +271,16 @@ func (d *DisplaySet) OCR(ocr *gosseract.Client) (string, error) {
             log.Printf("Warning: Failed to create image for ODS ID %d: %v", objData.ID, err)
             continue
         }
-        // Get image bytes
-        img_bytes, err := GetImageBytesJPEG(img)
-        if err != nil {
-            log.Printf("Warning: Failed to encode JPEG for ODS ID %d: %v", objData.ID, err)
-            continue
-        }
-        // OCR Image
-        ocr_result, err = RunOCR(ocr, img_bytes)
-        if err != nil {
-            log.Printf("Warning: OCR failed for ODS ID %d: %v", objData.ID, err)
-            continue
-        }
-        // Concatenate strings
-        if text != "" {
-            text = text + "\n" + ocr_result
-        } else {
-            text = ocr_result
-        }
+        bitmaps = append(bitmaps, Bitmap{
+            ObjID: objData.ID,
+            X: int(positions[objData.ID].Hpos),
+            Y: int(positions[objData.ID].Vpos),
+            Pixels: img_decoded,
+            Palettes: paletteData.Palettes,
+            Image: img,
+        })
     }
-	return text, nil
+    return bitmaps
 }
 
 func (d *DisplaySet) Print() {
@@ -1,8 +1,10 @@
 package suptext
 
 import (
+	"context"
 	"encoding/binary"
 	"testing"
+	"time"
 )
 
 func TestValidateWindowCompositionLinkage_Valid(t *testing.T) {
@@ -400,3 +402,100 @@ func TestGetActiveCompositionObjects_InvalidPCSDataType(t *testing.T) {
 	}
 }
 
+
+// fakeEngine recognizes every bitmap as the same text
+type fakeEngine struct {
+	text  string
+	calls int
+}
+
+func (e *fakeEngine) Recognize(b *Bitmap) (OCRResult, error) {
+	e.calls++
+	return OCRResult{Text: e.text, Words: 1, Confidence: 90, MinConfidence: 90}, nil
+}
+
+func (e *fakeEngine) Close() error {
+	return nil
+}
+
+func TestDisplaySetIsForced(t *testing.T) {
+	ds := createTestDisplaySet(1000)
+	if ds.IsForced() {
+		t.Error("Expected display set without forced objects not to be forced")
+	}
+	pcs := ds.PCS.Data.(PresentationCompositionData)
+	pcs.Comps = []CompositionObject{{ObjID: 1, Forced: true}}
+	ds.PCS.Data = pcs
+	if !ds.IsForced() {
+		t.Error("Expected display set with a forced object to be forced")
+	}
+}
+
+func TestPGSCues_ForcedOnly(t *testing.T) {
+	forced := createTestDisplaySet(5000)
+	pcs := forced.PCS.Data.(PresentationCompositionData)
+	pcs.Comps = []CompositionObject{{ObjID: 1, Forced: true}}
+	forced.PCS.Data = pcs
+	pgs := PGS{Sections: []DisplaySet{createTestDisplaySet(1000), forced}}
+
+	engine := &fakeEngine{text: "Hello"}
+	cues := pgs.Cues(engine, Options{}, nil)
+	if len(cues) != 2 || cues[0].Forced || !cues[1].Forced {
+		t.Fatalf("Expected a regular and a forced cue, got %+v", cues)
+	}
+
+	engine.calls = 0
+	cues = pgs.Cues(engine, Options{ForcedOnly: true}, nil)
+	if len(cues) != 1 || cues[0].Start != 5000 || cues[0].Index != 1 {
+		t.Errorf("Expected only the forced cue numbered 1, got %+v", cues)
+	}
+	if engine.calls != 1 {
+		t.Errorf("Expected regular display set not to be recognized, got %d calls", engine.calls)
+	}
+}
+
+// cancelEngine cancels its context on the given recognition
+type cancelEngine struct {
+	fakeEngine
+	cancel func()
+	at     int
+}
+
+func (e *cancelEngine) Recognize(b *Bitmap) (OCRResult, error) {
+	result, err := e.fakeEngine.Recognize(b)
+	if e.calls == e.at {
+		e.cancel()
+	}
+	return result, err
+}
+
+func TestPGSCuesContext(t *testing.T) {
+	pgs := PGS{Sections: []DisplaySet{createTestDisplaySet(1000), createTestDisplaySet(3000), createTestDisplaySet(5000)}}
+	ctx, cancel := context.WithCancel(context.Background())
+	engine := &cancelEngine{fakeEngine: fakeEngine{text: "Hello"}, cancel: cancel, at: 2}
+	cues, err := pgs.CuesContext(ctx, NewContextEngine(engine), Options{}, nil)
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+	// The cue recognized when cancelled is dropped
+	if len(cues) != 1 || cues[0].Start != 1000 || engine.calls != 2 {
+		t.Errorf("Expected the first cue after 2 calls, got %d calls and %+v", engine.calls, cues)
+	}
+}
+
+func TestPGSCuesContext_CueTimeout(t *testing.T) {
+	pgs := PGS{Sections: []DisplaySet{createTestDisplaySet(1000), createTestDisplaySet(3000)}}
+	blocking := &blockingEngine{release: make(chan struct{})}
+	defer close(blocking.release)
+	start := time.Now()
+	cues, err := pgs.CuesContext(context.Background(), NewContextEngine(blocking), Options{CueTimeout: 0.05}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(cues) != 2 || cues[0].Errors != 1 || cues[1].Errors != 1 || len(cues[0].Lines) != 0 {
+		t.Errorf("Expected 2 cues without text, got %+v", cues)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("Expected cues to time out, took %v", time.Since(start))
+	}
+}
@@ -0,0 +1,312 @@
+package suptext
+
+import (
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "image"
+    "log"
+    "os"
+    "strings"
+    "unicode/utf8"
+)
+
+// OCR engines
+const (
+    EngineTesseract = "tesseract"
+    EngineGlyph = "glyph" // Pure Go matching against a glyph database
+    EngineCommand = "command" // External executable run per image
+)
+
+// Tesseract words below this confidence aren't used to train the glyph database
+const GlyphTrainMinConfidence = 90.0
+
+// ErrNoTesseract is returned by the Tesseract engine of builds without cgo or with the notesseract tag
+var ErrNoTesseract = errors.New("Tesseract OCR support not compiled in, rebuild with CGO_ENABLED=1 and libtesseract installed, or use the glyph engine")
+
+// OCREngine recognizes the text of decoded bitmaps
+type OCREngine interface {
+    Recognize(b *Bitmap) (OCRResult, error)
+    Close() error
+}
+
+// ContextEngine is an OCREngine whose recognition ends when its context is done
+type ContextEngine interface {
+    OCREngine
+    RecognizeContext(ctx context.Context, b *Bitmap) (OCRResult, error)
+}
+
+// NewContextEngine returns engine if it's a ContextEngine, otherwise a wrapper abandoning
+// recognitions once their context is done, e.g. Tesseract calls that can't be interrupted.
+// Abandoned recognitions finish in the background, later ones wait for them.
+func NewContextEngine(engine OCREngine) ContextEngine {
+    if e, ok := engine.(ContextEngine); ok {
+        return e
+    }
+    return &contextEngine{OCREngine: engine, busy: make(chan struct{}, 1)}
+}
+
+// contextEngine runs the recognitions of an engine one at a time, without waiting for those
+// whose context is done
+type contextEngine struct {
+    OCREngine
+    busy chan struct{}
+}
+
+func (e *contextEngine) Recognize(b *Bitmap) (OCRResult, error) {
+    return e.RecognizeContext(context.Background(), b)
+}
+
+func (e *contextEngine) RecognizeContext(ctx context.Context, b *Bitmap) (OCRResult, error) {
+    select {
+    case e.busy <- struct{}{}:
+    case <-ctx.Done():
+        return OCRResult{}, ctx.Err()
+    }
+    type recognized struct {
+        result OCRResult
+        err error
+    }
+    done := make(chan recognized, 1)
+    go func() {
+        result, err := e.OCREngine.Recognize(b)
+        <-e.busy
+        done <- recognized{result, err}
+    }()
+    select {
+    case r := <-done:
+        return r.result, r.err
+    case <-ctx.Done():
+        return OCRResult{}, ctx.Err()
+    }
+}
+
+// Close closes the engine, after the abandoned recognition if one still runs
+func (e *contextEngine) Close() error {
+    select {
+    case e.busy <- struct{}{}:
+        return e.OCREngine.Close()
+    default:
+    }
+    go func() {
+        e.busy <- struct{}{}
+        if err := e.OCREngine.Close(); err != nil {
+            log.Printf("Warning: Failed to close OCR engine: %v", err)
+        }
+    }()
+    return nil
+}
+
+// unwrapEngine returns the engine wrapped by NewContextEngine
+func unwrapEngine(engine OCREngine) OCREngine {
+    if e, ok := engine.(*contextEngine); ok {
+        return e.OCREngine
+    }
+    return engine
+}
+
+// NewOCREngine creates the engine selected by opts
+func NewOCREngine(opts Options) (OCREngine, error) {
+    switch opts.Engine {
+    case "", EngineTesseract:
+        client, err := NewOCRClient(opts)
+        if err != nil {
+            return nil, err
+        }
+        if !opts.TrainGlyphs {
+            return client, nil
+        }
+        trainer, err := NewGlyphTrainer(client, opts.GlyphDB)
+        if err != nil {
+            client.Close()
+            return nil, err
+        }
+        return trainer, nil
+    case EngineGlyph:
+        if opts.TrainGlyphs {
+            return nil, fmt.Errorf("Glyph training requires the %s engine", EngineTesseract)
+        }
+        return NewGlyphEngine(opts.GlyphDB)
+    case EngineCommand:
+        if opts.TrainGlyphs {
+            return nil, fmt.Errorf("Glyph training requires the %s engine", EngineTesseract)
+        }
+        return NewCommandEngine(opts)
+    }
+    return nil, fmt.Errorf("Unknown OCR engine '%s' (expected %s, %s or %s)", opts.Engine, EngineTesseract, EngineGlyph, EngineCommand)
+}
+
+// EngineFingerprint identifies the engine and settings that affect recognized text
+func EngineFingerprint(opts Options) (string, error) {
+    switch opts.Engine {
+    case EngineCommand:
+        return CommandFingerprint(opts)
+    case EngineGlyph:
+    default:
+        return OCRFingerprint(opts)
+    }
+    data, err := os.ReadFile(opts.GlyphDB)
+    if err != nil {
+        return "", err
+    }
+    h := sha256.New()
+    fmt.Fprintf(h, "glyph %x\n", sha256.Sum256(data))
+    return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// GlyphEngine recognizes bitmaps by matching their glyphs against a glyph database
+type GlyphEngine struct {
+    DB *GlyphDB
+    // Glyphs not found in the database
+    Unknown int
+}
+
+func NewGlyphEngine(fname string) (*GlyphEngine, error) {
+    if fname == "" {
+        return nil, fmt.Errorf("The %s engine requires a glyph database", EngineGlyph)
+    }
+    if _, err := os.Stat(fname); err != nil {
+        return nil, fmt.Errorf("Failed to read glyph database: %v", err)
+    }
+    db, err := LoadGlyphDB(fname)
+    if err != nil {
+        return nil, err
+    }
+    return &GlyphEngine{DB: db}, nil
+}
+
+// Recognize matches every glyph of the bitmap, a word's confidence is that of its least confident glyph
+func (e *GlyphEngine) Recognize(b *Bitmap) (OCRResult, error) {
+    var result OCRResult
+    var lines []string
+    var sum float64
+    addWord := func(conf float64) {
+        sum += conf
+        if result.Words == 0 || conf < result.MinConfidence {
+            result.MinConfidence = conf
+        }
+        result.Words++
+    }
+
+    for _, line := range SegmentGlyphs(b.Pixels, b.Palettes) {
+        var text strings.Builder
+        word := -1.0
+        for i := range line.Glyphs {
+            g := &line.Glyphs[i]
+            if g.Space && word >= 0 {
+                text.WriteString(" ")
+                addWord(word)
+                word = -1
+            }
+            t, conf := e.DB.Match(g)
+            if t == GlyphUnknown {
+                e.Unknown++
+            }
+            text.WriteString(t)
+            if word < 0 || conf < word {
+                word = conf
+            }
+        }
+        if word >= 0 {
+            addWord(word)
+        }
+        lines = append(lines, text.String())
+    }
+
+    result.Text = strings.Join(lines, "\n")
+    if result.Words > 0 {
+        result.Confidence = sum / float64(result.Words)
+    }
+    return result, nil
+}
+
+// RecognizeContext is Recognize, which is quick enough to only check ctx before starting
+func (e *GlyphEngine) RecognizeContext(ctx context.Context, b *Bitmap) (OCRResult, error) {
+    if err := ctx.Err(); err != nil {
+        return OCRResult{}, err
+    }
+    return e.Recognize(b)
+}
+
+func (e *GlyphEngine) Close() error {
+    return nil
+}
+
+// GlyphTrainer recognizes bitmaps with Tesseract and learns the glyphs of confidently
+// recognized words, saving the glyph database on Close
+type GlyphTrainer struct {
+    *OCRClient
+    DB *GlyphDB
+    Path string
+    // Glyphs learned during the run
+    Learned int
+}
+
+func NewGlyphTrainer(client *OCRClient, fname string) (*GlyphTrainer, error) {
+    if fname == "" {
+        return nil, fmt.Errorf("Glyph training requires a glyph database")
+    }
+    db, err := LoadGlyphDB(fname)
+    if err != nil {
+        return nil, err
+    }
+    return &GlyphTrainer{OCRClient: client, DB: db, Path: fname}, nil
+}
+
+func (t *GlyphTrainer) Recognize(b *Bitmap) (OCRResult, error) {
+    result, boxes, err := t.RecognizeWords(b)
+    if err != nil {
+        return OCRResult{}, err
+    }
+    t.Learned += TrainGlyphs(t.DB, b, boxes)
+    return result, nil
+}
+
+func (t *GlyphTrainer) Close() error {
+    err := t.DB.Save(t.Path)
+    if cerr := t.OCRClient.Close(); err == nil {
+        err = cerr
+    }
+    return err
+}
+
+// WordBox is a word recognized by Tesseract and its position in the bitmap
+type WordBox struct {
+    Word string
+    Box image.Rectangle
+    Confidence float64
+}
+
+// TrainGlyphs teaches db the glyphs of bitmap b from the confidently recognized words.
+// A word is only learned when its box holds exactly one glyph per character. Returns the glyphs learned.
+func TrainGlyphs(db *GlyphDB, b *Bitmap, words []WordBox) int {
+    learned := 0
+    lines := SegmentGlyphs(b.Pixels, b.Palettes)
+    for _, w := range words {
+        if w.Confidence < GlyphTrainMinConfidence || w.Word == "" {
+            continue
+        }
+        var glyphs []*Glyph
+        for i := range lines {
+            for j := range lines[i].Glyphs {
+                g := &lines[i].Glyphs[j]
+                cx, cy := g.X + g.Width / 2, g.Y + g.Height / 2
+                if cx >= w.Box.Min.X && cx < w.Box.Max.X && cy >= w.Box.Min.Y && cy < w.Box.Max.Y {
+                    glyphs = append(glyphs, g)
+                }
+            }
+        }
+        if len(glyphs) != utf8.RuneCountInString(w.Word) {
+            continue
+        }
+        i := 0
+        for _, r := range w.Word {
+            db.Learn(glyphs[i], string(r))
+            i++
+        }
+        learned += len(glyphs)
+    }
+    return learned
+}
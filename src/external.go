@@ -0,0 +1,260 @@
+package suptext
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "image/png"
+    "os"
+    "os/exec"
+    "runtime"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Output formats of OCR commands
+const (
+    CommandOutputText = "text"
+    CommandOutputJSON = "json"
+)
+
+// Placeholder replaced by the path of the PNG image in OCR command arguments
+const CommandImageArg = "{image}"
+
+const DefaultCommandTimeout = 30.0
+
+// commandJobs limit the number of OCR commands running at once in the process by limit, shared by
+// every engine with the same limit since each recognizes one bitmap at a time
+var (
+    commandJobs = map[int]chan struct{}{}
+    commandJobsMu sync.Mutex
+)
+
+// commandSemaphore returns the semaphore of the engines limited to jobs commands at once
+func commandSemaphore(jobs int) chan struct{} {
+    commandJobsMu.Lock()
+    defer commandJobsMu.Unlock()
+    sem, ok := commandJobs[jobs]
+    if !ok {
+        sem = make(chan struct{}, jobs)
+        commandJobs[jobs] = sem
+    }
+    return sem
+}
+
+// CommandResult is the JSON output of an OCR command. Confidences range 0-100, words are optional
+type CommandResult struct {
+    Text string `json:"text"`
+    Confidence *float64 `json:"confidence"`
+    Words []struct {
+        Text string `json:"text"`
+        Confidence float64 `json:"confidence"`
+    } `json:"words"`
+}
+
+// CommandEngine recognizes bitmaps by running an external executable per image.
+// The PNG image is written to the command's stdin, or to a temp file whose path replaces
+// CommandImageArg in the arguments, and the recognized text is read from its stdout.
+type CommandEngine struct {
+    Args []string
+    Output string
+    Timeout time.Duration
+    // Languages passed to the command as $SUPTEXT_LANGUAGES
+    Languages string
+    // Limits the number of commands running at once, shared by every engine with the same limit
+    jobs chan struct{}
+}
+
+func NewCommandEngine(opts Options) (*CommandEngine, error) {
+    args := strings.Fields(opts.OCRCommand)
+    if len(args) == 0 {
+        return nil, fmt.Errorf("The %s engine requires an OCR command", EngineCommand)
+    }
+    if _, err := exec.LookPath(args[0]); err != nil {
+        return nil, fmt.Errorf("OCR command not found: %v", err)
+    }
+    e := &CommandEngine{Args: args, Output: opts.OCRCommandOutput, Languages: opts.Languages}
+    switch e.Output {
+    case "":
+        e.Output = CommandOutputText
+    case CommandOutputText, CommandOutputJSON:
+    default:
+        return nil, fmt.Errorf("Unknown OCR command output '%s' (expected %s or %s)", e.Output, CommandOutputText, CommandOutputJSON)
+    }
+    timeout := opts.OCRTimeout
+    if timeout == 0 {
+        timeout = DefaultCommandTimeout
+    }
+    if timeout < 0 {
+        return nil, fmt.Errorf("Invalid OCR timeout %g", timeout)
+    }
+    e.Timeout = time.Duration(timeout * float64(time.Second))
+    jobs := opts.OCRJobs
+    if jobs <= 0 {
+        jobs = runtime.NumCPU()
+    }
+    e.jobs = commandSemaphore(jobs)
+    return e, nil
+}
+
+// Recognize runs the OCR command on the bitmap image, safe for concurrent use
+func (e *CommandEngine) Recognize(b *Bitmap) (OCRResult, error) {
+    return e.RecognizeContext(context.Background(), b)
+}
+
+// RecognizeContext is Recognize killing the OCR command once ctx is done
+func (e *CommandEngine) RecognizeContext(parent context.Context, b *Bitmap) (OCRResult, error) {
+    select {
+    case e.jobs <- struct{}{}:
+    case <-parent.Done():
+        return OCRResult{}, parent.Err()
+    }
+    defer func() { <-e.jobs }()
+
+    var img bytes.Buffer
+    if err := png.Encode(&img, b.Image); err != nil {
+        return OCRResult{}, fmt.Errorf("Failed to encode PNG: %v", err)
+    }
+
+    args := make([]string, len(e.Args))
+    copy(args, e.Args)
+    var fname string
+    for i := 1; i < len(args); i++ {
+        if !strings.Contains(args[i], CommandImageArg) {
+            continue
+        }
+        if fname == "" {
+            var err error
+            if fname, err = writeTempImage(img.Bytes()); err != nil {
+                return OCRResult{}, fmt.Errorf("Failed to write OCR image: %v", err)
+            }
+            defer os.Remove(fname)
+        }
+        args[i] = strings.ReplaceAll(args[i], CommandImageArg, fname)
+    }
+
+    ctx, cancel := context.WithTimeout(parent, e.Timeout)
+    defer cancel()
+    cmd := exec.Command(args[0], args[1:]...)
+    setProcessGroup(cmd)
+    cmd.Env = append(os.Environ(), "SUPTEXT_LANGUAGES=" + e.Languages)
+    if fname == "" {
+        cmd.Stdin = &img
+    }
+    var stdout, stderr bytes.Buffer
+    cmd.Stdout, cmd.Stderr = &stdout, &stderr
+    if err := runCommand(ctx, cmd); err != nil {
+        if parent.Err() != nil {
+            return OCRResult{}, parent.Err()
+        }
+        if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+            return OCRResult{}, fmt.Errorf("OCR command %s timed out after %s", args[0], e.Timeout)
+        }
+        msg := strings.TrimSpace(stderr.String())
+        if msg == "" {
+            return OCRResult{}, fmt.Errorf("OCR command %s failed: %v", args[0], err)
+        }
+        return OCRResult{}, fmt.Errorf("OCR command %s failed: %v: %s", args[0], err, msg)
+    }
+
+    if e.Output == CommandOutputJSON {
+        return ParseCommandJSON(stdout.Bytes())
+    }
+    return NewCommandTextResult(stdout.String()), nil
+}
+
+// runCommand runs cmd until it exits or ctx is done. The processes it started are killed too,
+// since they'd keep its output open and the wait going.
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+    if err := cmd.Start(); err != nil {
+        return err
+    }
+    done := make(chan error, 1)
+    go func() {
+        done <- cmd.Wait()
+    }()
+    select {
+    case err := <-done:
+        return err
+    case <-ctx.Done():
+        killProcessGroup(cmd)
+        <-done
+        return ctx.Err()
+    }
+}
+
+func writeTempImage(data []byte) (string, error) {
+    f, err := os.CreateTemp("", "suptext-*.png")
+    if err != nil {
+        return "", err
+    }
+    if _, err := f.Write(data); err != nil {
+        f.Close()
+        os.Remove(f.Name())
+        return "", err
+    }
+    if err := f.Close(); err != nil {
+        os.Remove(f.Name())
+        return "", err
+    }
+    return f.Name(), nil
+}
+
+func (e *CommandEngine) Close() error {
+    return nil
+}
+
+// NewCommandTextResult is the result of plain text output, which has no confidence
+func NewCommandTextResult(out string) OCRResult {
+    text := strings.Trim(strings.ReplaceAll(out, "\r\n", "\n"), "\n")
+    return OCRResult{Text: text, Words: len(strings.Fields(text))}
+}
+
+// ParseCommandJSON reads CommandResult output. Word confidences take precedence over the
+// overall confidence, which applies to every word of the text
+func ParseCommandJSON(out []byte) (OCRResult, error) {
+    var res CommandResult
+    if err := json.Unmarshal(out, &res); err != nil {
+        return OCRResult{}, fmt.Errorf("Invalid OCR command output: %v", err)
+    }
+    result := OCRResult{Text: strings.Trim(res.Text, "\n")}
+    if len(res.Words) > 0 {
+        var sum float64
+        for i, w := range res.Words {
+            sum += w.Confidence
+            if i == 0 || w.Confidence < result.MinConfidence {
+                result.MinConfidence = w.Confidence
+            }
+        }
+        result.Words = len(res.Words)
+        result.Confidence = sum / float64(result.Words)
+        return result, nil
+    }
+    result.Words = len(strings.Fields(result.Text))
+    if res.Confidence != nil {
+        result.Confidence, result.MinConfidence = *res.Confidence, *res.Confidence
+    }
+    return result, nil
+}
+
+// CommandFingerprint identifies the OCR command line, output format and executable
+func CommandFingerprint(opts Options) (string, error) {
+    args := strings.Fields(opts.OCRCommand)
+    if len(args) == 0 {
+        return "", fmt.Errorf("The %s engine requires an OCR command", EngineCommand)
+    }
+    h := sha256.New()
+    fmt.Fprintf(h, "command %q\noutput %s\nlanguages %s\n", args, opts.OCRCommandOutput, opts.Languages)
+    // Updated executables get new fingerprints
+    if path, err := exec.LookPath(args[0]); err == nil {
+        if info, err := os.Stat(path); err == nil {
+            fmt.Fprintf(h, "exec %s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+        }
+    }
+    return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package suptext
+
+import (
+    "os/exec"
+)
+
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+// killProcessGroup kills cmd, the processes it started are left running
+func killProcessGroup(cmd *exec.Cmd) {
+    cmd.Process.Kill()
+}
@@ -0,0 +1,188 @@
+package suptext
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Helper function to write an executable shell script OCR command
+func createTestCommand(t *testing.T, script string) string {
+	if runtime.GOOS == "windows" {
+		t.Skip("Shell scripts not supported")
+	}
+	fname := filepath.Join(t.TempDir(), "ocr.sh")
+	if err := os.WriteFile(fname, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return fname
+}
+
+func createTestCommandBitmap(t *testing.T) *Bitmap {
+	var palettes [256]PaletteDefinition
+	palettes[1] = PaletteDefinition{Y: 235, Cr: 128, Cb: 128, A: 255}
+	img, err := CreateImage([][]uint8{{0, 1}, {1, 0}}, palettes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Bitmap{Image: img}
+}
+
+func TestCommandEngine_Stdin(t *testing.T) {
+	// Checks the PNG signature on stdin
+	cmd := createTestCommand(t, `head -c 4 | grep -q PNG || exit 1
+printf "Hello there\r\n$SUPTEXT_LANGUAGES\n"`)
+	engine, err := NewOCREngine(Options{Engine: EngineCommand, OCRCommand: cmd, Languages: "deu+eng"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	result, err := engine.Recognize(createTestCommandBitmap(t))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if result.Text != "Hello there\ndeu+eng" || result.Words != 3 || result.Confidence != 0 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+}
+
+func TestCommandEngine_ImageArg(t *testing.T) {
+	cmd := createTestCommand(t, `case "$1" in --image=*.png) ;; *) exit 1;; esac
+head -c 4 "${1#--image=}" | grep -q PNG || exit 1
+echo '{"text": "General Kenobi", "words": [{"text": "General", "confidence": 90}, {"text": "Kenobi", "confidence": 60}]}'`)
+	engine, err := NewCommandEngine(Options{OCRCommand: cmd + " --image={image}", OCRCommandOutput: CommandOutputJSON})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	result, err := engine.Recognize(createTestCommandBitmap(t))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if result.Text != "General Kenobi" || result.Words != 2 || result.Confidence != 75 || result.MinConfidence != 60 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+}
+
+func TestCommandEngine_Errors(t *testing.T) {
+	failing := createTestCommand(t, `echo "model not found" >&2
+exit 3`)
+	engine, _ := NewCommandEngine(Options{OCRCommand: failing})
+	_, err := engine.Recognize(createTestCommandBitmap(t))
+	if err == nil || !strings.Contains(err.Error(), "exit status 3: model not found") {
+		t.Errorf("Expected exit status and stderr in error, got: %v", err)
+	}
+
+	slow := createTestCommand(t, `exec sleep 5`)
+	engine, _ = NewCommandEngine(Options{OCRCommand: slow, OCRTimeout: 0.1})
+	_, err = engine.Recognize(createTestCommandBitmap(t))
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected timeout error, got: %v", err)
+	}
+
+	if _, err := NewCommandEngine(Options{}); err == nil {
+		t.Error("Expected error without command")
+	}
+	if _, err := NewCommandEngine(Options{OCRCommand: "suptext-missing-ocr"}); err == nil {
+		t.Error("Expected error for missing executable")
+	}
+	if _, err := NewCommandEngine(Options{OCRCommand: slow, OCRCommandOutput: "xml"}); err == nil {
+		t.Error("Expected error for unknown output")
+	}
+}
+
+func TestParseCommandJSON(t *testing.T) {
+	result, err := ParseCommandJSON([]byte(`{"text": "Hello there\n", "confidence": 88.5}`))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if result.Text != "Hello there" || result.Words != 2 || result.Confidence != 88.5 || result.MinConfidence != 88.5 {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if _, err := ParseCommandJSON([]byte("Hello there")); err == nil {
+		t.Error("Expected error for non JSON output")
+	}
+}
+
+func TestCommandEngine_Context(t *testing.T) {
+	engine, _ := NewCommandEngine(Options{OCRCommand: createTestCommand(t, `exec sleep 5`)})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := engine.RecognizeContext(ctx, createTestCommandBitmap(t)); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got: %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("Expected the command to be killed, took %v", time.Since(start))
+	}
+}
+
+func TestCommandEngine_SharedJobs(t *testing.T) {
+	cmd := createTestCommand(t, "echo Hello")
+	first, err := NewCommandEngine(Options{OCRCommand: cmd, OCRJobs: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewCommandEngine(Options{OCRCommand: cmd, OCRJobs: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewCommandEngine(Options{OCRCommand: cmd, OCRJobs: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Engines of other tracks, inputs and server workers share the limit of the process
+	if first.jobs != second.jobs || cap(first.jobs) != 1 {
+		t.Errorf("Expected engines to share the OCR command limit")
+	}
+	// Another limit is kept rather than ignored
+	if other.jobs == first.jobs || cap(other.jobs) != 8 {
+		t.Errorf("Expected a limit of 8 commands, got %d", cap(other.jobs))
+	}
+}
+
+func TestCommandEngine_TimeoutKillsChildren(t *testing.T) {
+	// The background sleep keeps stdout open after the script is killed
+	engine, _ := NewCommandEngine(Options{OCRCommand: createTestCommand(t, "sleep 60 &\nwait"), OCRTimeout: 0.2})
+	start := time.Now()
+	_, err := engine.Recognize(createTestCommandBitmap(t))
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected timeout error, got: %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Expected the command and its children to be killed, took %v", time.Since(start))
+	}
+}
+
+func TestPGSToSRTContext(t *testing.T) {
+	// Recognizes the first cue, then hangs until killed
+	marker := filepath.Join(t.TempDir(), "marker")
+	cmd := createTestCommand(t, `cat >/dev/null
+if [ -e `+marker+` ]; then sleep 60; fi
+touch `+marker+`
+echo Hello`)
+	// Another luma for the second bitmap, which the OCR cache would recognize otherwise
+	sup := append(createTestSUP(1000), createTestSUP(3000)...)
+	sup[len(sup)/2+48] = 16
+	pgs, err := ReadPGS(bufio.NewReader(bytes.NewReader(sup)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	var out bytes.Buffer
+	cues, err := pgs.ToSRTContext(ctx, &out, Options{Engine: EngineCommand, OCRCommand: cmd})
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline exceeded, got: %v", err)
+	}
+	if len(cues) != 1 || cues[0].Text() != "Hello" {
+		t.Fatalf("Expected the first cue, got %+v", cues)
+	}
+	if !strings.HasPrefix(out.String(), "1\n00:00:01,000 --> ") || strings.Count(out.String(), "Hello") != 1 {
+		t.Errorf("Expected the first cue written, got %q", out.String())
+	}
+}
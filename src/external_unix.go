@@ -0,0 +1,18 @@
+//go:build unix
+
+package suptext
+
+import (
+    "os/exec"
+    "syscall"
+)
+
+// setProcessGroup starts cmd in a process group of its own
+func setProcessGroup(cmd *exec.Cmd) {
+    cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessGroup kills cmd and the processes it started
+func killProcessGroup(cmd *exec.Cmd) {
+    syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,170 @@
+package suptext
+
+import (
+    "fmt"
+    "io"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// Subtitle output formats
+const (
+    FormatSRT = "srt"
+    FormatVTT = "vtt"
+    FormatASS = "ass"
+)
+
+// Formats lists the supported output formats
+var Formats = []string{FormatSRT, FormatVTT, FormatASS}
+
+// ValidateFormat checks an output format name
+func ValidateFormat(format string) error {
+    for _, f := range Formats {
+        if format == f {
+            return nil
+        }
+    }
+    return fmt.Errorf("Unknown output format '%s' (expected %s)", format, strings.Join(Formats, ", "))
+}
+
+// FormatOfFile returns the output format of a file name's extension, empty if it isn't one
+func FormatOfFile(fname string) string {
+    ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(fname), "."))
+    if ValidateFormat(ext) != nil {
+        return ""
+    }
+    return ext
+}
+
+// WriteCues writes cues in format
+func WriteCues(w io.Writer, cues []Cue, format string) error {
+    switch format {
+    case FormatSRT, "":
+        return WriteSRT(w, cues)
+    case FormatVTT:
+        return WriteVTT(w, cues)
+    case FormatASS:
+        return WriteASS(w, cues)
+    }
+    return ValidateFormat(format)
+}
+
+// FormatVTTTimestamp formats milliseconds as HH:MM:SS.mmm
+func FormatVTTTimestamp(ts uint32) string {
+    return strings.Replace(FormatMilliseconds(ts), ",", ".", 1)
+}
+
+// vttColorClass returns the cue class of a "#rrggbb" color, e.g. c00ffff
+func vttColorClass(color string) string {
+    return "c" + strings.ToLower(strings.TrimPrefix(color, "#"))
+}
+
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func (l *CueLine) VTT() string {
+    text := vttEscaper.Replace(l.Text)
+    if l.Color == "" || l.Text == "" {
+        return text
+    }
+    return fmt.Sprintf("<c.%s>%s</c>", vttColorClass(l.Color), text)
+}
+
+func (c *Cue) VTT() string {
+    texts := make([]string, len(c.Lines))
+    for i := range c.Lines {
+        texts[i] = c.Lines[i].VTT()
+    }
+    sts := FormatVTTTimestamp(c.Start)
+    ets := FormatVTTTimestamp(c.End)
+    return fmt.Sprintf("%d\n%s --> %s\n%s\n\n", c.Index, sts, ets, strings.Join(texts, "\n"))
+}
+
+// WriteVTT writes a WebVTT file, text colors are cue classes defined in a STYLE block
+func WriteVTT(w io.Writer, cues []Cue) error {
+    var b strings.Builder
+    b.WriteString("WEBVTT\n\n")
+    colors := map[string]bool{}
+    for _, cue := range cues {
+        for _, l := range cue.Lines {
+            if l.Color != "" && l.Text != "" {
+                colors[strings.ToLower(l.Color)] = true
+            }
+        }
+    }
+    if len(colors) > 0 {
+        var sorted []string
+        for color := range colors {
+            sorted = append(sorted, color)
+        }
+        sort.Strings(sorted)
+        b.WriteString("STYLE\n")
+        for _, color := range sorted {
+            fmt.Fprintf(&b, "::cue(.%s) { color: %s; }\n", vttColorClass(color), color)
+        }
+        b.WriteString("\n")
+    }
+    for _, cue := range cues {
+        b.WriteString(cue.VTT())
+    }
+    if _, err := io.WriteString(w, b.String()); err != nil {
+        return fmt.Errorf("Failed to write VTT: %v", err)
+    }
+    return nil
+}
+
+// FormatASSTimestamp formats milliseconds as H:MM:SS.cc
+func FormatASSTimestamp(ts uint32) string {
+    cs := ts / 10
+    return fmt.Sprintf("%d:%02d:%02d.%02d", cs / 360000, cs / 6000 % 60, cs / 100 % 60, cs % 100)
+}
+
+// assHeader is the script info and the default style of the events
+const assHeader = `[Script Info]
+ScriptType: v4.00+
+PlayResX: 1920
+PlayResY: 1080
+WrapStyle: 0
+ScaledBorderAndShadow: yes
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+Style: Default,Arial,64,&H00FFFFFF,&H000000FF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,3,1,2,60,60,50,1
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+`
+
+func (l *CueLine) ASS() string {
+    // Braces start override blocks
+    text := strings.NewReplacer("{", "(", "}", ")").Replace(l.Text)
+    if l.Color == "" || l.Text == "" || len(l.Color) != 7 {
+        return text
+    }
+    // Colors are &HBBGGRR&
+    rgb := strings.ToUpper(l.Color[1:])
+    return fmt.Sprintf("{\\c&H%s%s%s&}%s{\\r}", rgb[4:6], rgb[2:4], rgb[0:2], text)
+}
+
+func (c *Cue) ASS() string {
+    texts := make([]string, len(c.Lines))
+    for i := range c.Lines {
+        texts[i] = c.Lines[i].ASS()
+    }
+    sts := FormatASSTimestamp(c.Start)
+    ets := FormatASSTimestamp(c.End)
+    return fmt.Sprintf("Dialogue: 0,%s,%s,Default,,0,0,0,,%s\n", sts, ets, strings.Join(texts, "\\N"))
+}
+
+// WriteASS writes an Advanced SubStation Alpha file with a default bottom centered style
+func WriteASS(w io.Writer, cues []Cue) error {
+    var b strings.Builder
+    b.WriteString(assHeader)
+    for _, cue := range cues {
+        b.WriteString(cue.ASS())
+    }
+    if _, err := io.WriteString(w, b.String()); err != nil {
+        return fmt.Errorf("Failed to write ASS: %v", err)
+    }
+    return nil
+}
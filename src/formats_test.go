@@ -0,0 +1,60 @@
+package suptext
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func createTestCues() []Cue {
+	return []Cue{
+		{Index: 1, Start: 1500, End: 3250, Lines: []CueLine{{Text: "Hello <there>"}, {Text: "Sign", Color: "#00ffff"}}},
+		{Index: 2, Start: 3723004, End: 3725000, Lines: []CueLine{{Text: "{Bye}"}}},
+	}
+}
+
+func TestWriteVTT(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteVTT(&buf, createTestCues()); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := "WEBVTT\n\nSTYLE\n::cue(.c00ffff) { color: #00ffff; }\n\n" +
+		"1\n00:00:01.500 --> 00:00:03.250\nHello &lt;there&gt;\n<c.c00ffff>Sign</c>\n\n" +
+		"2\n01:02:03.004 --> 01:02:05.000\n{Bye}\n\n"
+	if got := buf.String(); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestWriteASS(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCues(&buf, createTestCues(), FormatASS); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	got := buf.String()
+	if !strings.HasPrefix(got, "[Script Info]\n") {
+		t.Errorf("Expected script info header, got %q", got)
+	}
+	for _, line := range []string{
+		"Dialogue: 0,0:00:01.50,0:00:03.25,Default,,0,0,0,,Hello <there>\\N{\\c&HFFFF00&}Sign{\\r}\n",
+		"Dialogue: 0,1:02:03.00,1:02:05.00,Default,,0,0,0,,(Bye)\n",
+	} {
+		if !strings.Contains(got, line) {
+			t.Errorf("Expected %q in %q", line, got)
+		}
+	}
+}
+
+func TestFormats(t *testing.T) {
+	if err := ValidateFormat("sub"); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+	if err := WriteCues(&bytes.Buffer{}, nil, "sub"); err == nil {
+		t.Error("Expected error writing unknown format")
+	}
+	for fname, want := range map[string]string{"movie.VTT": FormatVTT, "movie.en.ass": FormatASS, "movie.srt": FormatSRT, "movie.txt": "", "-": ""} {
+		if got := FormatOfFile(fname); got != want {
+			t.Errorf("Expected format %q of %s, got %q", want, fname, got)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package suptext
+
+import (
+    "sort"
+)
+
+// Connected components overlapping horizontally by this share of the narrower one are a
+// single character, e.g. the dot of an i or an accent
+const GlyphMergeOverlap = 0.5
+
+// Gaps between glyphs wider than this share of the line height, and at least
+// GlyphMinSpace pixels, are spaces between words
+const GlyphSpaceRatio = 0.2
+const GlyphMinSpace = 3
+
+// Glyph is a character shape segmented from the fill pixels of a bitmap
+type Glyph struct {
+    X int // Position in the bitmap
+    Y int
+    Width int
+    Height int
+    // Distance from the glyph bottom up to the line baseline, negative for descenders
+    Rise int
+    // Row major pixels, one bit per pixel, most significant bit first
+    Bits []byte
+    // Preceded by a space
+    Space bool
+}
+
+// GlyphLine is a row of glyphs in reading order
+type GlyphLine struct {
+    Top int
+    Bottom int
+    Glyphs []Glyph
+}
+
+func newGlyphBits(width, height int) []byte {
+    return make([]byte, (width * height + 7) / 8)
+}
+
+// At reports whether the pixel at x, y of the glyph is filled, false outside the glyph
+func (g *Glyph) At(x, y int) bool {
+    if x < 0 || y < 0 || x >= g.Width || y >= g.Height {
+        return false
+    }
+    i := y * g.Width + x
+    return g.Bits[i / 8] & (0x80 >> (i % 8)) != 0
+}
+
+func (g *Glyph) set(x, y int) {
+    i := y * g.Width + x
+    g.Bits[i / 8] |= 0x80 >> (i % 8)
+}
+
+// component is a set of 8-connected fill pixels
+type component struct {
+    minX, minY, maxX, maxY int
+    points [][2]int
+}
+
+func (c *component) merge(o *component) {
+    c.minX, c.minY = minInt(c.minX, o.minX), minInt(c.minY, o.minY)
+    c.maxX, c.maxY = maxInt(c.maxX, o.maxX), maxInt(c.maxY, o.maxY)
+    c.points = append(c.points, o.points...)
+}
+
+// SegmentGlyphs splits the fill pixels of a bitmap into lines of glyphs
+func SegmentGlyphs(pixels [][]uint8, palettes [256]PaletteDefinition) []GlyphLine {
+    var lines []GlyphLine
+    for _, band := range glyphBands(pixels, palettes) {
+        comps := components(pixels[band[0]:band[1]], palettes, band[0])
+        if len(comps) == 0 {
+            continue
+        }
+        lines = append(lines, newGlyphLine(band[0], band[1], comps))
+    }
+    return lines
+}
+
+// glyphBands returns the text bands of pixels, joining bands that are only the dots or accents
+// of a line (less than half its height and closer than half its height) into the line
+func glyphBands(pixels [][]uint8, palettes [256]PaletteDefinition) [][2]int {
+    var bands [][2]int
+    for _, b := range TextBands(pixels, palettes) {
+        if len(bands) > 0 {
+            prev := &bands[len(bands) - 1]
+            h1, h2 := prev[1] - prev[0], b[1] - b[0]
+            taller := maxInt(h1, h2)
+            if 2 * minInt(h1, h2) < taller && 2 * (b[0] - prev[1]) < taller {
+                prev[1] = b[1]
+                continue
+            }
+        }
+        bands = append(bands, b)
+    }
+    return bands
+}
+
+// components finds the 8-connected fill components of rows, offset by top in the bitmap
+func components(rows [][]uint8, palettes [256]PaletteDefinition, top int) []*component {
+    seen := make([][]bool, len(rows))
+    for y := range rows {
+        seen[y] = make([]bool, len(rows[y]))
+    }
+    filled := func(x, y int) bool {
+        return y >= 0 && y < len(rows) && x >= 0 && x < len(rows[y]) && !seen[y][x] && palettes[rows[y][x]].IsFill()
+    }
+
+    var comps []*component
+    for y := range rows {
+        for x := range rows[y] {
+            if !filled(x, y) {
+                continue
+            }
+            c := &component{minX: x, minY: y, maxX: x, maxY: y}
+            seen[y][x] = true
+            stack := [][2]int{{x, y}}
+            for len(stack) > 0 {
+                p := stack[len(stack) - 1]
+                stack = stack[:len(stack) - 1]
+                c.points = append(c.points, [2]int{p[0], p[1] + top})
+                c.minX, c.minY = minInt(c.minX, p[0]), minInt(c.minY, p[1])
+                c.maxX, c.maxY = maxInt(c.maxX, p[0]), maxInt(c.maxY, p[1])
+                for dy := -1; dy <= 1; dy++ {
+                    for dx := -1; dx <= 1; dx++ {
+                        if filled(p[0] + dx, p[1] + dy) {
+                            seen[p[1] + dy][p[0] + dx] = true
+                            stack = append(stack, [2]int{p[0] + dx, p[1] + dy})
+                        }
+                    }
+                }
+            }
+            c.minY, c.maxY = c.minY + top, c.maxY + top
+            comps = append(comps, c)
+        }
+    }
+    return mergeComponents(comps)
+}
+
+// mergeComponents joins components stacked on top of each other into single characters
+func mergeComponents(comps []*component) []*component {
+    sort.Slice(comps, func(i, j int) bool { return comps[i].minX < comps[j].minX })
+    var out []*component
+    for _, c := range comps {
+        merged := false
+        for _, o := range out {
+            overlap := minInt(c.maxX, o.maxX) - maxInt(c.minX, o.minX) + 1
+            narrower := minInt(c.maxX - c.minX, o.maxX - o.minX) + 1
+            if overlap > 0 && float64(overlap) >= GlyphMergeOverlap * float64(narrower) {
+                o.merge(c)
+                merged = true
+                break
+            }
+        }
+        if !merged {
+            out = append(out, c)
+        }
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].minX < out[j].minX })
+    return out
+}
+
+func newGlyphLine(top, bottom int, comps []*component) GlyphLine {
+    line := GlyphLine{Top: top, Bottom: bottom}
+    // The baseline is where most glyphs end
+    bottoms := map[int]int{}
+    baseline := 0
+    for _, c := range comps {
+        bottoms[c.maxY]++
+        if bottoms[c.maxY] > bottoms[baseline] || (bottoms[c.maxY] == bottoms[baseline] && c.maxY > baseline) {
+            baseline = c.maxY
+        }
+    }
+
+    space := maxInt(GlyphMinSpace, int(GlyphSpaceRatio * float64(bottom - top) + 0.5))
+    prevEnd := -1
+    for _, c := range comps {
+        g := Glyph{X: c.minX, Y: c.minY, Width: c.maxX - c.minX + 1, Height: c.maxY - c.minY + 1, Rise: baseline - c.maxY}
+        g.Bits = newGlyphBits(g.Width, g.Height)
+        for _, p := range c.points {
+            g.set(p[0] - c.minX, p[1] - c.minY)
+        }
+        g.Space = prevEnd >= 0 && c.minX - prevEnd - 1 >= space
+        prevEnd = maxInt(prevEnd, c.maxX)
+        line.Glyphs = append(line.Glyphs, g)
+    }
+    return line
+}
+
+func minInt(a, b int) int {
+    if a < b {
+        return a
+    }
+    return b
+}
+
+func maxInt(a, b int) int {
+    if a > b {
+        return a
+    }
+    return b
+}
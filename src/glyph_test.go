@@ -0,0 +1,88 @@
+package suptext
+
+import (
+	"strings"
+	"testing"
+)
+
+// Helper function to create a bitmap from rows of '#' (fill) and '.' (background)
+func createGlyphBitmap(rows ...string) Bitmap {
+	var palettes [256]PaletteDefinition
+	palettes[1] = PaletteDefinition{Y: 235, Cr: 128, Cb: 128, A: 255}
+	pixels := make([][]uint8, len(rows))
+	for y, row := range rows {
+		pixels[y] = make([]uint8, len(row))
+		for x, c := range row {
+			if c == '#' {
+				pixels[y][x] = 1
+			}
+		}
+	}
+	return Bitmap{Pixels: pixels, Palettes: palettes}
+}
+
+func glyphString(g *Glyph) string {
+	var b strings.Builder
+	for y := 0; y < g.Height; y++ {
+		for x := 0; x < g.Width; x++ {
+			if g.At(x, y) {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func TestSegmentGlyphs(t *testing.T) {
+	bmp := createGlyphBitmap(
+		"..#...........",
+		"..............",
+		"..#..##......#",
+		"..#..##...##.#",
+		"..#.......##.#",
+		"..........#...",
+		"..............",
+		"#.#...........",
+		"###...........",
+		"#.#...........",
+		"#.#...........",
+	)
+	lines := SegmentGlyphs(bmp.Pixels, bmp.Palettes)
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+
+	first := lines[0].Glyphs
+	if len(first) != 4 {
+		t.Fatalf("Expected 4 glyphs on the first line, got %d", len(first))
+	}
+	// The dot above the stem is part of the same glyph
+	if first[0].X != 2 || first[0].Y != 0 || first[0].Height != 5 {
+		t.Errorf("Expected i glyph at 2,0 of height 5, got %+v", first[0])
+	}
+	if glyphString(&first[0]) != "#\n.\n#\n#\n#\n" {
+		t.Errorf("Unexpected i glyph bits:\n%s", glyphString(&first[0]))
+	}
+	// Baseline is the bottom of the i and the last glyph
+	if first[0].Rise != 0 || first[1].Rise != 1 || first[2].Rise != -1 || first[3].Rise != 0 {
+		t.Errorf("Expected rises 0, 1, -1, 0, got %d, %d, %d, %d", first[0].Rise, first[1].Rise, first[2].Rise, first[3].Rise)
+	}
+	if first[0].Space || first[1].Space || !first[2].Space || first[3].Space {
+		t.Errorf("Expected a space before the third glyph only, got %v %v %v %v", first[0].Space, first[1].Space, first[2].Space, first[3].Space)
+	}
+
+	second := lines[1]
+	if second.Top != 7 || second.Bottom != 11 || len(second.Glyphs) != 1 {
+		t.Errorf("Expected one glyph in rows 7-11, got %+v", second)
+	}
+}
+
+func TestSegmentGlyphs_Empty(t *testing.T) {
+	bmp := createGlyphBitmap("....", "....")
+	if lines := SegmentGlyphs(bmp.Pixels, bmp.Palettes); len(lines) != 0 {
+		t.Errorf("Expected no lines, got %d", len(lines))
+	}
+}
@@ -0,0 +1,259 @@
+package suptext
+
+import (
+    "bufio"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// Glyphs matching a database shape below this share of common pixels are unknown
+const GlyphMinSimilarity = 0.8
+
+// Text of glyphs not found in the glyph database
+const GlyphUnknown = "�"
+
+const glyphDBHeader = `# suptext glyph database
+# <count> <text> <width> <height> <rise> <bits>
+# count: times the shape was seen as text, text: Go quoted string,
+# bits: row major pixels as hex, one bit per pixel, most significant bit first
+`
+
+// GlyphEntry is a character shape of the glyph database and its text
+type GlyphEntry struct {
+    Count int
+    Text string
+    Width int
+    Height int
+    Rise int
+    Bits []byte
+}
+
+// GlyphDB maps glyph shapes to text, see glyphDBHeader for the file format
+type GlyphDB struct {
+    Entries []*GlyphEntry
+}
+
+func (e *GlyphEntry) glyph() *Glyph {
+    return &Glyph{Width: e.Width, Height: e.Height, Rise: e.Rise, Bits: e.Bits}
+}
+
+func (e *GlyphEntry) key() string {
+    return fmt.Sprintf("%dx%d %x", e.Width, e.Height, e.Bits)
+}
+
+func glyphKey(g *Glyph) string {
+    return fmt.Sprintf("%dx%d %x", g.Width, g.Height, g.Bits)
+}
+
+// LoadGlyphDB reads a glyph database file, a missing file is an empty database
+func LoadGlyphDB(fname string) (*GlyphDB, error) {
+    f, err := os.Open(fname)
+    if os.IsNotExist(err) {
+        return &GlyphDB{}, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    defer f.Close()
+
+    db, err := ReadGlyphDB(f)
+    if err != nil {
+        return nil, fmt.Errorf("Invalid glyph database %s: %v", fname, err)
+    }
+    return db, nil
+}
+
+func ReadGlyphDB(r io.Reader) (*GlyphDB, error) {
+    db := &GlyphDB{}
+    scanner := bufio.NewScanner(r)
+    scanner.Buffer(nil, 1 << 20)
+    for n := 1; scanner.Scan(); n++ {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+        e, err := parseGlyphEntry(line)
+        if err != nil {
+            return nil, fmt.Errorf("line %d: %v", n, err)
+        }
+        db.add(e)
+    }
+    return db, scanner.Err()
+}
+
+func parseGlyphEntry(line string) (*GlyphEntry, error) {
+    count, rest, _ := strings.Cut(line, " ")
+    text, rest, err := unquotePrefix(rest)
+    if err != nil {
+        return nil, fmt.Errorf("invalid <text>: %v", err)
+    }
+    fields := strings.Fields(rest)
+    if len(fields) != 4 {
+        return nil, fmt.Errorf("expected <count> <text> <width> <height> <rise> <bits>")
+    }
+    e := &GlyphEntry{Text: text}
+    for i, p := range []*int{&e.Count, &e.Width, &e.Height, &e.Rise} {
+        s := count
+        if i > 0 {
+            s = fields[i - 1]
+        }
+        if *p, err = strconv.Atoi(s); err != nil {
+            return nil, err
+        }
+    }
+    if e.Count < 1 || e.Width < 1 || e.Height < 1 {
+        return nil, fmt.Errorf("count, width and height must be positive")
+    }
+    if e.Bits, err = hex.DecodeString(fields[3]); err != nil {
+        return nil, fmt.Errorf("invalid <bits>: %v", err)
+    }
+    if len(e.Bits) != len(newGlyphBits(e.Width, e.Height)) {
+        return nil, fmt.Errorf("expected %d bytes of bits for %dx%d, got %d", len(newGlyphBits(e.Width, e.Height)), e.Width, e.Height, len(e.Bits))
+    }
+    return e, nil
+}
+
+// add merges an entry into the database, adding up the counts of the same shape and text
+func (db *GlyphDB) add(e *GlyphEntry) {
+    for _, o := range db.Entries {
+        if o.Text == e.Text && o.key() == e.key() && absInt(o.Rise - e.Rise) <= riseTolerance(e.Height) {
+            o.Count += e.Count
+            return
+        }
+    }
+    db.Entries = append(db.Entries, e)
+}
+
+// Learn records that glyph g reads as text
+func (db *GlyphDB) Learn(g *Glyph, text string) {
+    db.add(&GlyphEntry{Count: 1, Text: text, Width: g.Width, Height: g.Height, Rise: g.Rise, Bits: g.Bits})
+}
+
+// Merge adds the entries of another database
+func (db *GlyphDB) Merge(o *GlyphDB) {
+    for _, e := range o.Entries {
+        c := *e
+        db.add(&c)
+    }
+}
+
+// Write stores the entries seen at least minCount times, most frequent first
+func (db *GlyphDB) Write(w io.Writer, minCount int) error {
+    entries := make([]*GlyphEntry, 0, len(db.Entries))
+    for _, e := range db.Entries {
+        if e.Count >= minCount {
+            entries = append(entries, e)
+        }
+    }
+    sort.SliceStable(entries, func(i, j int) bool {
+        if entries[i].Count != entries[j].Count {
+            return entries[i].Count > entries[j].Count
+        }
+        return entries[i].Text < entries[j].Text
+    })
+
+    bw := bufio.NewWriter(w)
+    bw.WriteString(glyphDBHeader)
+    for _, e := range entries {
+        fmt.Fprintf(bw, "%d %q %d %d %d %x\n", e.Count, e.Text, e.Width, e.Height, e.Rise, e.Bits)
+    }
+    return bw.Flush()
+}
+
+// Save writes the whole database to fname, replacing it atomically
+func (db *GlyphDB) Save(fname string) error {
+    f, err := os.CreateTemp(filepath.Dir(fname), ".tmp-glyphs-*")
+    if err != nil {
+        return err
+    }
+    if err := db.Write(f, 1); err != nil {
+        f.Close()
+        os.Remove(f.Name())
+        return err
+    }
+    if err := f.Close(); err != nil {
+        os.Remove(f.Name())
+        return err
+    }
+    if err := os.Rename(f.Name(), fname); err != nil {
+        os.Remove(f.Name())
+        return err
+    }
+    return nil
+}
+
+// Match returns the text of the database shape most similar to g and the match confidence (0-100).
+// Shapes read as several texts, like l and I in many fonts, pick the most frequent one with a
+// confidence lowered to its share of the count.
+func (db *GlyphDB) Match(g *Glyph) (string, float64) {
+    key := glyphKey(g)
+    var best *GlyphEntry
+    bestSim := 0.0
+    var total int
+    for _, e := range db.Entries {
+        if absInt(e.Width - g.Width) > 1 || absInt(e.Height - g.Height) > 1 || absInt(e.Rise - g.Rise) > riseTolerance(g.Height) {
+            continue
+        }
+        sim := 1.0
+        if e.key() != key {
+            sim = glyphSimilarity(e.glyph(), g)
+        }
+        switch {
+        case sim > bestSim:
+            best, bestSim, total = e, sim, e.Count
+        case sim == bestSim && best != nil:
+            total += e.Count
+            if e.Count > best.Count {
+                best = e
+            }
+        }
+    }
+    if best == nil || bestSim < GlyphMinSimilarity {
+        return GlyphUnknown, 0
+    }
+    return best.Text, 100 * bestSim * float64(best.Count) / float64(total)
+}
+
+// glyphSimilarity is the highest share of common pixels (intersection over union) of a and b,
+// shifting b by up to a pixel in every direction
+func glyphSimilarity(a, b *Glyph) float64 {
+    best := 0.0
+    for dy := -1; dy <= 1; dy++ {
+        for dx := -1; dx <= 1; dx++ {
+            inter, union := 0, 0
+            for y := minInt(0, dy); y < maxInt(a.Height, b.Height + dy); y++ {
+                for x := minInt(0, dx); x < maxInt(a.Width, b.Width + dx); x++ {
+                    pa, pb := a.At(x, y), b.At(x - dx, y - dy)
+                    if pa && pb {
+                        inter++
+                    }
+                    if pa || pb {
+                        union++
+                    }
+                }
+            }
+            if union > 0 && float64(inter) / float64(union) > best {
+                best = float64(inter) / float64(union)
+            }
+        }
+    }
+    return best
+}
+
+// riseTolerance is how far from the baseline a glyph of the given height may move and still match
+func riseTolerance(height int) int {
+    return maxInt(2, height / 3)
+}
+
+func absInt(a int) int {
+    if a < 0 {
+        return -a
+    }
+    return a
+}
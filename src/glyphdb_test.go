@@ -0,0 +1,228 @@
+package suptext
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Helper function to segment the single glyph of a bitmap
+func createTestGlyph(t *testing.T, rows ...string) *Glyph {
+	bmp := createGlyphBitmap(rows...)
+	lines := SegmentGlyphs(bmp.Pixels, bmp.Palettes)
+	if len(lines) != 1 || len(lines[0].Glyphs) != 1 {
+		t.Fatalf("Expected a single glyph, got %+v", lines)
+	}
+	return &lines[0].Glyphs[0]
+}
+
+func TestGlyphDBMatch(t *testing.T) {
+	o := createTestGlyph(t, "###", "#.#", "#.#", "###")
+	db := &GlyphDB{}
+	db.Learn(o, "o")
+
+	if text, conf := db.Match(o); text != "o" || conf != 100 {
+		t.Errorf("Expected exact match o 100, got %s %.1f", text, conf)
+	}
+	// A missing pixel still matches
+	broken := createTestGlyph(t, "###", "#.#", "#.#", "##.")
+	if text, conf := db.Match(broken); text != "o" || conf < GlyphMinSimilarity * 100 || conf >= 100 {
+		t.Errorf("Expected fuzzy match o, got %s %.1f", text, conf)
+	}
+	bar := createTestGlyph(t, "#", "#", "#", "#")
+	if text, conf := db.Match(bar); text != GlyphUnknown || conf != 0 {
+		t.Errorf("Expected unknown glyph, got %s %.1f", text, conf)
+	}
+}
+
+func TestGlyphDBMatch_Ambiguous(t *testing.T) {
+	bar := createTestGlyph(t, "#", "#", "#", "#")
+	db := &GlyphDB{}
+	for i := 0; i < 3; i++ {
+		db.Learn(bar, "l")
+	}
+	db.Learn(bar, "I")
+	if len(db.Entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(db.Entries))
+	}
+	if text, conf := db.Match(bar); text != "l" || conf != 75 {
+		t.Errorf("Expected l with confidence 75, got %s %.1f", text, conf)
+	}
+}
+
+func TestGlyphDBMatch_Rise(t *testing.T) {
+	bmp := createGlyphBitmap(
+		"#.##....##..",
+		"#.##....##..",
+		"#..#.....#..",
+		"#...........",
+		"#..........#",
+		"#..........#",
+		"#....##....#",
+		"#....##....#",
+		"#.....#....#",
+	)
+	lines := SegmentGlyphs(bmp.Pixels, bmp.Palettes)
+	glyphs := lines[0].Glyphs
+	if len(glyphs) != 5 {
+		t.Fatalf("Expected 5 glyphs, got %d", len(glyphs))
+	}
+	db := &GlyphDB{}
+	db.Learn(&glyphs[1], "'")
+	// The comma has the apostrophe's shape but sits on the baseline
+	if text, _ := db.Match(&glyphs[2]); text != GlyphUnknown {
+		t.Errorf("Expected comma not to match the apostrophe, got %s", text)
+	}
+	if text, _ := db.Match(&glyphs[3]); text != "'" {
+		t.Errorf("Expected raised glyph to match the apostrophe, got %s", text)
+	}
+}
+
+func TestGlyphDBWriteRead(t *testing.T) {
+	db := &GlyphDB{}
+	db.Learn(createTestGlyph(t, "###", "#.#", "#.#", "###"), "o")
+	db.Learn(createTestGlyph(t, "#", "#", "#", "#"), "l")
+	db.Learn(createTestGlyph(t, "#", "#", "#", "#"), "l")
+	db.Learn(createTestGlyph(t, "#", "#", "#"), "\"")
+
+	var buf bytes.Buffer
+	if err := db.Write(&buf, 1); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !strings.Contains(buf.String(), "2 \"l\" 1 4 0 f0\n") {
+		t.Errorf("Expected most frequent entry first, got:\n%s", buf.String())
+	}
+	read, err := ReadGlyphDB(&buf)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(read.Entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(read.Entries))
+	}
+	for i, want := range []string{"l", "\"", "o"} {
+		if read.Entries[i].Text != want {
+			t.Errorf("Expected entry %d to be %q, got %q", i, want, read.Entries[i].Text)
+		}
+	}
+
+	buf.Reset()
+	db.Write(&buf, 2)
+	if strings.Contains(buf.String(), "\"o\"") {
+		t.Errorf("Expected entries seen once to be filtered, got:\n%s", buf.String())
+	}
+}
+
+func TestReadGlyphDB_Invalid(t *testing.T) {
+	cases := []string{
+		"1 \"a\" 2 2 0",
+		"1 a 2 2 0 f0",
+		"0 \"a\" 2 2 0 f0",
+		"1 \"a\" 2 2 0 zz",
+		"1 \"a\" 4 4 0 f0",
+	}
+	for _, c := range cases {
+		if _, err := ReadGlyphDB(strings.NewReader(c)); err == nil {
+			t.Errorf("Expected error for %q", c)
+		}
+	}
+}
+
+func TestGlyphDBMergeSave(t *testing.T) {
+	bar := createTestGlyph(t, "#", "#", "#", "#")
+	a, b := &GlyphDB{}, &GlyphDB{}
+	a.Learn(bar, "l")
+	b.Learn(bar, "l")
+	b.Learn(bar, "I")
+	a.Merge(b)
+	if len(a.Entries) != 2 || a.Entries[0].Count != 2 {
+		t.Errorf("Expected counts of the same glyph to add up, got %+v", a.Entries)
+	}
+
+	fname := filepath.Join(t.TempDir(), "glyphs.db")
+	if err := a.Save(fname); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	loaded, err := LoadGlyphDB(fname)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(loaded.Entries) != 2 {
+		t.Errorf("Expected 2 entries, got %d", len(loaded.Entries))
+	}
+	entries, _ := os.ReadDir(filepath.Dir(fname))
+	if len(entries) != 1 {
+		t.Errorf("Expected no temp files left, got %d files", len(entries))
+	}
+
+	missing, err := LoadGlyphDB(filepath.Join(t.TempDir(), "missing.db"))
+	if err != nil || len(missing.Entries) != 0 {
+		t.Errorf("Expected missing database to be empty, got %v, %v", missing, err)
+	}
+}
+
+func TestGlyphEngine(t *testing.T) {
+	bmp := createGlyphBitmap(
+		"###.#.....#",
+		"#.#.#.....#",
+		"#.#.#.....#",
+		"###.#.....#",
+		"...........",
+		"#.###......",
+		"..#.#......",
+	)
+	db := &GlyphDB{}
+	// Train from a word box around "ol" and a low confidence one around "l"
+	learned := TrainGlyphs(db, &bmp, []WordBox{
+		{Word: "ol", Box: image.Rect(0, 0, 5, 4), Confidence: 95},
+		{Word: "I", Box: image.Rect(10, 0, 11, 4), Confidence: 50},
+	})
+	if learned != 2 {
+		t.Fatalf("Expected 2 glyphs learned, got %d", learned)
+	}
+
+	engine := &GlyphEngine{DB: db}
+	result, err := engine.Recognize(&bmp)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	want := "ol l\n" + GlyphUnknown + GlyphUnknown
+	if result.Text != want {
+		t.Errorf("Expected %q, got %q", want, result.Text)
+	}
+	if result.Words != 3 || result.MinConfidence != 0 || result.Confidence != 200.0 / 3 {
+		t.Errorf("Expected 3 words with min confidence 0, got %+v", result)
+	}
+	if engine.Unknown != 2 {
+		t.Errorf("Expected 2 unknown glyphs, got %d", engine.Unknown)
+	}
+}
+
+func TestNewOCREngine_Glyph(t *testing.T) {
+	if _, err := NewOCREngine(Options{Engine: EngineGlyph}); err == nil {
+		t.Error("Expected error without glyph database")
+	}
+	if _, err := NewOCREngine(Options{Engine: EngineGlyph, GlyphDB: filepath.Join(t.TempDir(), "missing.db")}); err == nil {
+		t.Error("Expected error for missing glyph database")
+	}
+	if _, err := NewOCREngine(Options{Engine: "paddle"}); err == nil {
+		t.Error("Expected error for unknown engine")
+	}
+
+	fname := filepath.Join(t.TempDir(), "glyphs.db")
+	if err := (&GlyphDB{}).Save(fname); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, err := NewOCREngine(Options{Engine: EngineGlyph, GlyphDB: fname, TrainGlyphs: true}); err == nil {
+		t.Error("Expected error training the glyph engine")
+	}
+	engine, err := NewOCREngine(Options{Engine: EngineGlyph, GlyphDB: fname})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, ok := engine.(*GlyphEngine); !ok {
+		t.Errorf("Expected glyph engine, got %T", engine)
+	}
+}
@@ -0,0 +1,311 @@
+package suptext
+
+import (
+    "encoding/binary"
+    "encoding/json"
+    "fmt"
+    "io"
+    "strconv"
+    "strings"
+)
+
+// Composition states of a PCS
+const (
+    CompositionNormal = 0x00
+    CompositionAcquisitionPoint = 0x40
+    CompositionEpochStart = 0x80
+)
+
+// segmentTypes names the segment types by lower case name
+var segmentTypes = map[string]uint8{"pcs": PCS, "wds": WDS, "pds": PDS, "ods": ODS, "end": END}
+
+// SegmentTypeName returns the name of a segment type, e.g. PCS, or its hex value if unknown
+func SegmentTypeName(typ uint8) string {
+    for name, t := range segmentTypes {
+        if t == typ {
+            return strings.ToUpper(name)
+        }
+    }
+    return fmt.Sprintf("0x%02x", typ)
+}
+
+// ParseSegmentType returns the segment type of a name like pcs or ODS
+func ParseSegmentType(name string) (uint8, error) {
+    typ, ok := segmentTypes[strings.ToLower(name)]
+    if !ok {
+        return 0, fmt.Errorf("Unknown segment type '%s' (expected pcs, wds, pds, ods or end)", name)
+    }
+    return typ, nil
+}
+
+// SegmentField is a decoded field of a segment
+type SegmentField struct {
+    Name string
+    Value interface{}
+}
+
+// SegmentFields are the key fields of a segment in header order, a JSON object
+type SegmentFields []SegmentField
+
+func (f SegmentFields) MarshalJSON() ([]byte, error) {
+    var b strings.Builder
+    b.WriteString("{")
+    for i, field := range f {
+        name, _ := json.Marshal(field.Name)
+        value, err := json.Marshal(field.Value)
+        if err != nil {
+            return nil, err
+        }
+        if i > 0 {
+            b.WriteString(",")
+        }
+        fmt.Fprintf(&b, "%s:%s", name, value)
+    }
+    b.WriteString("}")
+    return []byte(b.String()), nil
+}
+
+// String joins the fields as name=value, lists as values separated by '; '
+func (f SegmentFields) String() string {
+    parts := make([]string, len(f))
+    for i, field := range f {
+        value := fmt.Sprint(field.Value)
+        if list, ok := field.Value.([]string); ok {
+            value = strings.Join(list, "; ")
+        }
+        parts[i] = fmt.Sprintf("%s=%s", field.Name, value)
+    }
+    return strings.Join(parts, " ")
+}
+
+// SegmentInfo describes a segment as stored in the stream
+type SegmentInfo struct {
+    // Byte offset of the segment header in SUP files, -1 in containers
+    Offset int64 `json:"offset"`
+    Type string `json:"type"`
+    // Bytes of segment data after the header
+    Size int `json:"size"`
+    // Timestamps in 90 kHz ticks, containers only keep milliseconds
+    PTS uint32 `json:"pts"`
+    DTS uint32 `json:"dts"`
+    PTSTime string `json:"pts_time"`
+    DTSTime string `json:"dts_time"`
+    // Display sets and epochs numbered from 0 in stream order
+    DisplaySet int `json:"display_set"`
+    Epoch int `json:"epoch"`
+    Fields SegmentFields `json:"fields"`
+}
+
+// SegmentInspector describes segments in stream order, numbering their display sets and epochs
+type SegmentInspector struct {
+    display_set int
+    epoch int
+    seen_pcs bool
+}
+
+// Inspect describes a segment at offset, -1 if unknown, whose timestamps are in 90 kHz ticks
+func (s *SegmentInspector) Inspect(offset int64, pts uint32, dts uint32, typ uint8, data []byte) SegmentInfo {
+    fields := segmentFields(typ, data)
+    if typ == PCS && len(data) >= PresentationCompositionSize && data[7] == CompositionEpochStart {
+        if s.seen_pcs {
+            s.epoch++
+        }
+    }
+    s.seen_pcs = s.seen_pcs || typ == PCS
+    info := SegmentInfo{
+        Offset: offset,
+        Type: SegmentTypeName(typ),
+        Size: len(data),
+        PTS: pts,
+        DTS: dts,
+        PTSTime: FormatVTTTimestamp(pts / TimestampAccuracy),
+        DTSTime: FormatVTTTimestamp(dts / TimestampAccuracy),
+        DisplaySet: s.display_set,
+        Epoch: s.epoch,
+        Fields: fields,
+    }
+    if typ == END {
+        s.display_set++
+    }
+    return info
+}
+
+// InspectSection is Inspect of a segment read from a container, whose timestamps are in
+// milliseconds
+func (s *SegmentInspector) InspectSection(section Section, data []byte) SegmentInfo {
+    return s.Inspect(-1, section.PTS * TimestampAccuracy, section.DTS * TimestampAccuracy, section.Type, data)
+}
+
+// InspectSUP describes the segments of a SUP file in stream order without decoding display sets,
+// calling fn with each until it returns an error
+func InspectSUP(r io.Reader, fn func(SegmentInfo) error) error {
+    var s SegmentInspector
+    var offset int64
+    header := make([]byte, SegmentHeaderSize)
+    for {
+        if _, err := io.ReadFull(r, header); err == io.EOF {
+            return nil
+        } else if err != nil {
+            return fmt.Errorf("Truncated segment header at offset %d", offset)
+        }
+        if string(header[:2]) != MagicBytes {
+            return fmt.Errorf("Invalid header magic '%s' at offset %d", string(header[:2]), offset)
+        }
+        data := make([]byte, binary.BigEndian.Uint16(header[11:13]))
+        if _, err := io.ReadFull(r, data); err != nil {
+            return fmt.Errorf("Truncated segment at offset %d", offset)
+        }
+        info := s.Inspect(offset, binary.BigEndian.Uint32(header[2:6]), binary.BigEndian.Uint32(header[6:10]), header[10], data)
+        if err := fn(info); err != nil {
+            return err
+        }
+        offset += int64(len(header) + len(data))
+    }
+}
+
+// compositionStateName names the composition state of a PCS
+func compositionStateName(state uint8) string {
+    switch state {
+    case CompositionNormal:
+        return "normal"
+    case CompositionAcquisitionPoint:
+        return "acquisition point"
+    case CompositionEpochStart:
+        return "epoch start"
+    }
+    return fmt.Sprintf("0x%02x", state)
+}
+
+// segmentFields decodes the key fields of a segment, with an error field if it fails to decode
+func segmentFields(typ uint8, data []byte) SegmentFields {
+    var fields SegmentFields
+    add := func(name string, value interface{}) {
+        fields = append(fields, SegmentField{Name: name, Value: value})
+    }
+    var err error
+    switch typ {
+    case PCS:
+        var pcs PresentationCompositionData
+        if pcs, err = NewPresentationData(data); err != nil {
+            break
+        }
+        add("video", fmt.Sprintf("%dx%d", pcs.Width, pcs.Height))
+        add("number", pcs.Num)
+        add("state", compositionStateName(pcs.State))
+        add("palette_update", pcs.PaletteUpdate != 0)
+        add("palette", pcs.PaletteID)
+        objects := []string{}
+        for _, c := range pcs.Comps {
+            obj := fmt.Sprintf("object %d window %d at %d,%d", c.ObjID, c.WinID, c.Hpos, c.Vpos)
+            if c.Forced {
+                obj += " forced"
+            }
+            if c.Cropped {
+                obj += fmt.Sprintf(" cropped %dx%d at %d,%d", c.CropWidth, c.CropHeight, c.HCropPos, c.VCropPos)
+            }
+            objects = append(objects, obj)
+        }
+        add("objects", objects)
+    case WDS:
+        var wds WindowsData
+        if wds, err = NewWindowsData(data); err != nil {
+            break
+        }
+        windows := []string{}
+        for _, w := range wds.Windows {
+            windows = append(windows, fmt.Sprintf("window %d %dx%d at %d,%d", w.WinID, w.Width, w.Height, w.Hpos, w.Vpos))
+        }
+        add("windows", windows)
+    case PDS:
+        var pds PaletteData
+        if pds, err = NewPaletteData(data); err != nil {
+            break
+        }
+        add("palette", pds.ID)
+        add("version", pds.Version)
+        add("entries", pds.NumPalettes)
+        // Entries in stream order, the IDs only kept in the data
+        colors := []string{}
+        for i := 0; i < int(pds.NumPalettes); i++ {
+            id := data[2 + i * PaletteSize]
+            c := pds.Palettes[id]
+            colors = append(colors, fmt.Sprintf("%d: Y=%d Cr=%d Cb=%d A=%d", id, c.Y, c.Cr, c.Cb, c.A))
+        }
+        add("colors", colors)
+    case ODS:
+        var ods ObjectData
+        if ods, err = NewObjectData(data); err != nil {
+            break
+        }
+        add("object", ods.ID)
+        add("version", ods.Version)
+        var sequence []string
+        if ods.IsFirstSequence() {
+            sequence = append(sequence, "first")
+        }
+        if ods.IsLastSequence() {
+            sequence = append(sequence, "last")
+        }
+        if len(sequence) == 0 {
+            sequence = append(sequence, "middle")
+        }
+        add("fragment", strings.Join(sequence, "+"))
+        add("fragment_bytes", len(ods.Data))
+        if ods.IsFirstSequence() {
+            add("object_bytes", ods.Length)
+            add("size", fmt.Sprintf("%dx%d", ods.Width, ods.Height))
+        }
+    case END:
+    default:
+        err = fmt.Errorf("Segment type not supported")
+    }
+    if err != nil {
+        add("error", err.Error())
+    }
+    return fields
+}
+
+// SegmentFilter keeps the segments of some types within a time range
+type SegmentFilter struct {
+    // Range of PTS in milliseconds, no end if End is 0
+    Start uint32
+    End uint32
+    // Segment types kept, all if empty
+    Types []uint8
+}
+
+// Match reports whether the filter keeps a segment
+func (f *SegmentFilter) Match(info SegmentInfo) bool {
+    ms := info.PTS / TimestampAccuracy
+    if ms < f.Start || (f.End > 0 && ms >= f.End) {
+        return false
+    }
+    if len(f.Types) == 0 {
+        return true
+    }
+    for _, typ := range f.Types {
+        if SegmentTypeName(typ) == info.Type {
+            return true
+        }
+    }
+    return false
+}
+
+// ParseTimecode returns the milliseconds of a timecode like 1:02:03.5, 02:03, 00:01:02,500 or
+// 62.5 seconds
+func ParseTimecode(s string) (uint32, error) {
+    parts := strings.Split(strings.Replace(s, ",", ".", 1), ":")
+    if len(parts) > 3 || s == "" {
+        return 0, fmt.Errorf("Invalid timecode '%s' (expected [[HH:]MM:]SS[.mmm])", s)
+    }
+    var seconds float64
+    for i, part := range parts {
+        v, err := strconv.ParseFloat(part, 64)
+        // Only the seconds may have a fraction
+        if err != nil || v < 0 || (i < len(parts) - 1 && strings.Contains(part, ".")) {
+            return 0, fmt.Errorf("Invalid timecode '%s' (expected [[HH:]MM:]SS[.mmm])", s)
+        }
+        seconds = seconds * 60 + v
+    }
+    return uint32(seconds * 1000 + 0.5), nil
+}
@@ -0,0 +1,142 @@
+package suptext
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestInspectSUP(t *testing.T) {
+	var infos []SegmentInfo
+	err := InspectSUP(bytes.NewReader(createTestSUP(1000, 3000)), func(info SegmentInfo) error {
+		infos = append(infos, info)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(infos) != 8 {
+		t.Fatalf("Expected 8 segments, got %d", len(infos))
+	}
+	pcs, ods, next := infos[0], infos[2], infos[4]
+	if pcs.Offset != 0 || pcs.Type != "PCS" || pcs.Size != 19 || pcs.PTS != 90000 || pcs.PTSTime != "00:00:01.000" {
+		t.Errorf("Unexpected PCS %+v", pcs)
+	}
+	if !strings.Contains(pcs.Fields.String(), "state=epoch start") || !strings.Contains(pcs.Fields.String(), "objects=object 1 window 0 at 10,20") {
+		t.Errorf("Unexpected PCS fields %s", pcs.Fields)
+	}
+	if pds := infos[1]; pds.Fields.String() != "palette=0 version=0 entries=1 colors=1: Y=235 Cr=128 Cb=128 A=255" {
+		t.Errorf("Unexpected PDS fields %s", pds.Fields)
+	}
+	// Header and data of the PCS and PDS come before the ODS
+	if ods.Offset != 13+19+13+7 || ods.Fields.String() != "object=1 version=0 fragment=first+last fragment_bytes=8 object_bytes=12 size=2x2" {
+		t.Errorf("Unexpected ODS %+v", ods)
+	}
+	if next.DisplaySet != 1 || next.Epoch != 1 || infos[3].DisplaySet != 0 || infos[3].Type != "END" {
+		t.Errorf("Expected the second display set to start the second epoch, got %+v", next)
+	}
+
+	out, err := json.Marshal(ods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `"fields":{"object":1,"version":0,"fragment":"first+last"`) {
+		t.Errorf("Expected fields in header order, got %s", out)
+	}
+	out, err = json.Marshal(infos[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `"colors":["1: Y=235 Cr=128 Cb=128 A=255"]`) {
+		t.Errorf("Expected palette entries, got %s", out)
+	}
+
+	// Truncated files keep the segments before
+	sup := createTestSUP(1000)
+	infos = nil
+	err = InspectSUP(bytes.NewReader(sup[:len(sup)-5]), func(info SegmentInfo) error {
+		infos = append(infos, info)
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "offset 84") || len(infos) != 3 {
+		t.Errorf("Expected truncated END at offset 84 after 3 segments, got %d: %v", len(infos), err)
+	}
+}
+
+func TestSegmentFilter(t *testing.T) {
+	f := SegmentFilter{Start: 1000, End: 3000, Types: []uint8{PCS, END}}
+	for _, c := range []struct {
+		info SegmentInfo
+		want bool
+	}{
+		{SegmentInfo{Type: "PCS", PTS: 1000 * TimestampAccuracy}, true},
+		{SegmentInfo{Type: "END", PTS: 2999 * TimestampAccuracy}, true},
+		{SegmentInfo{Type: "ODS", PTS: 2000 * TimestampAccuracy}, false},
+		{SegmentInfo{Type: "PCS", PTS: 999 * TimestampAccuracy}, false},
+		{SegmentInfo{Type: "PCS", PTS: 3000 * TimestampAccuracy}, false},
+	} {
+		if got := f.Match(c.info); got != c.want {
+			t.Errorf("Expected match of %s at %d to be %v", c.info.Type, c.info.PTS, c.want)
+		}
+	}
+	if _, err := ParseSegmentType("xyz"); err == nil {
+		t.Errorf("Expected unknown segment type error")
+	}
+	if typ, err := ParseSegmentType("ODS"); err != nil || typ != ODS {
+		t.Errorf("Expected ODS, got 0x%x: %v", typ, err)
+	}
+}
+
+func TestParseTimecode(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want uint32
+	}{
+		{"90.5", 90500},
+		{"01:30", 90000},
+		{"1:02:03.5", 3723500},
+		{"00:00:01,250", 1250},
+	} {
+		got, err := ParseTimecode(c.in)
+		if err != nil || got != c.want {
+			t.Errorf("Expected %s to be %dms, got %d: %v", c.in, c.want, got, err)
+		}
+	}
+	for _, in := range []string{"", "abc", "1:2:3:4", "1.5:00", "-3"} {
+		if _, err := ParseTimecode(in); err == nil {
+			t.Errorf("Expected %q to be invalid", in)
+		}
+	}
+}
+
+func TestSetSegmentHook(t *testing.T) {
+	m, err := OpenMKV(bytes.NewReader(createTestMKV(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inspectors := map[uint64]*SegmentInspector{}
+	segments := map[uint64][]SegmentInfo{}
+	err = SetSegmentHook(m, func(track uint64, section Section, data []byte) {
+		if inspectors[track] == nil {
+			inspectors[track] = &SegmentInspector{}
+		}
+		segments[track] = append(segments[track], inspectors[track].InspectSection(section, data))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ReadTracks([]uint64{2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	if len(segments[2]) != 4 || len(segments[3]) != 2 {
+		t.Fatalf("Expected 4 and 2 segments, got %d and %d", len(segments[2]), len(segments[3]))
+	}
+	last := segments[2][2]
+	if last.Offset != -1 || last.PTS != 59*TimestampAccuracy || last.DisplaySet != 1 || last.Epoch != 1 {
+		t.Errorf("Unexpected segment of the second display set %+v", last)
+	}
+	if err := SetSegmentHook(&BDMV{}, nil); err == nil {
+		t.Error("Expected Blu-ray folders to be refused")
+	}
+}
@@ -0,0 +1,376 @@
+package suptext
+
+import (
+    "bufio"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+)
+
+// Transport stream packet sizes, M2TS packets have a 4 byte arrival timestamp prefix
+const TSPacketSize = 188
+const M2TSPacketSize = 192
+const tsSyncByte = 0x47
+
+// PIDs of the program association table and the Blu-ray PGS streams
+const tsPATPID = 0x0000
+const TSPGSFirstPID = 0x1200
+const TSPGSLastPID = 0x121F
+
+// PMT stream type and descriptor tag of PGS subtitles and ISO 639 languages
+const TSStreamTypePGS = 0x90
+const tsLanguageDescriptor = 0x0A
+
+// Packets read looking for the program tables before falling back to the PGS PID range
+const tsProbePackets = 20000
+
+// TSStream describes an elementary stream of a transport stream program
+type TSStream struct {
+    PID uint16
+    Type uint8
+    Language string
+}
+
+// IsPGS reports whether the stream holds PGS subtitles
+func (s *TSStream) IsPGS() bool {
+    return s.Type == TSStreamTypePGS
+}
+
+// tsPES reassembles the PES packet of a PID from transport stream packets
+type tsPES struct {
+    data []byte
+    cc int
+    started bool
+}
+
+// TSReader reads (M2)TS files as a stream, so no seeking is needed
+type TSReader struct {
+    r *bufio.Reader
+    PacketSize int
+    Streams []TSStream
+    offset int64
+    // Packets read while probing the program tables
+    pending [][]byte
+    // Counts the segments and display sets of the streams read if not nil
+    Progress *ProgressTracker
+    // Called with each segment of the streams read, by PID, if not nil
+    OnSegment func(pid uint64, section Section, data []byte)
+}
+
+// IsTransportStream reports whether the file starts with two TS or M2TS packets
+func IsTransportStream(magic []byte) bool {
+    for _, size := range []int{TSPacketSize, M2TSPacketSize} {
+        start := size - TSPacketSize
+        if len(magic) > start + size && magic[start] == tsSyncByte && magic[start + size] == tsSyncByte {
+            return true
+        }
+    }
+    return false
+}
+
+// OpenTS detects the packet size and reads the PAT and PMTs, leaving r at the first packet
+// following them. Streams fall back to the PIDs seen in the PGS range without tables.
+func OpenTS(r io.Reader) (*TSReader, error) {
+    t := &TSReader{r: bufio.NewReaderSize(r, 64 * 1024)}
+    magic, _ := t.r.Peek(2 * M2TSPacketSize + 1)
+    if !IsTransportStream(magic) {
+        return nil, fmt.Errorf("Not a transport stream: missing sync bytes")
+    }
+    t.PacketSize = TSPacketSize
+    if magic[0] != tsSyncByte || magic[TSPacketSize] != tsSyncByte {
+        t.PacketSize = M2TSPacketSize
+    }
+
+    pmts := map[uint16]bool{}
+    parsed := map[uint16]bool{}
+    seen := map[uint16]bool{}
+    pat := false
+    for len(t.pending) < tsProbePackets && (!pat || len(parsed) < len(pmts)) {
+        packet, err := t.packet()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+        t.pending = append(t.pending, packet)
+        pid, start, payload := tsPayload(packet)
+        if pid >= TSPGSFirstPID && pid <= TSPGSLastPID {
+            seen[pid] = true
+        }
+        if !start || payload == nil {
+            continue
+        }
+        if pid == tsPATPID && !pat {
+            programs, err := parsePAT(psiSection(payload))
+            if err != nil {
+                return nil, err
+            }
+            for _, pid := range programs {
+                pmts[pid] = true
+            }
+            pat = true
+        } else if pmts[pid] && !parsed[pid] {
+            streams, err := parsePMT(psiSection(payload))
+            if err != nil {
+                return nil, err
+            }
+            t.Streams = append(t.Streams, streams...)
+            parsed[pid] = true
+        }
+    }
+
+    if !pat || len(parsed) == 0 {
+        log.Printf("Warning: No program tables found, using the PGS PID range")
+        for pid := uint16(TSPGSFirstPID); pid <= TSPGSLastPID; pid++ {
+            if seen[pid] {
+                t.Streams = append(t.Streams, TSStream{PID: pid, Type: TSStreamTypePGS})
+            }
+        }
+    }
+    return t, nil
+}
+
+// PGSStreams returns the PGS subtitle streams
+func (t *TSReader) PGSStreams() []TSStream {
+    var streams []TSStream
+    for _, s := range t.Streams {
+        if s.IsPGS() {
+            streams = append(streams, s)
+        }
+    }
+    return streams
+}
+
+func (t *TSReader) stream(pid uint16) *TSStream {
+    for i := range t.Streams {
+        if t.Streams[i].PID == pid {
+            return &t.Streams[i]
+        }
+    }
+    return nil
+}
+
+// ReadPGSStreams decodes the given PGS streams in a single pass over the packets
+func (t *TSReader) ReadPGSStreams(pids []uint16) (map[uint16]PGS, error) {
+    builders := map[uint16]*PGSBuilder{}
+    pes := map[uint16]*tsPES{}
+    for _, pid := range pids {
+        s := t.stream(pid)
+        if s == nil || !s.IsPGS() {
+            return nil, fmt.Errorf("PID 0x%04X is not a PGS subtitle stream", pid)
+        }
+        builders[pid] = &PGSBuilder{Progress: t.Progress, OnSegment: trackSegmentHook(t.OnSegment, uint64(pid))}
+        pes[pid] = &tsPES{cc: -1}
+    }
+
+    for {
+        var packet []byte
+        var err error
+        if len(t.pending) > 0 {
+            packet, t.pending = t.pending[0], t.pending[1:]
+        } else if packet, err = t.packet(); err != nil {
+            if err == io.EOF {
+                break
+            }
+            if errors.Is(err, io.ErrUnexpectedEOF) {
+                log.Printf("Warning: Truncated transport stream at offset %d", t.offset)
+                break
+            }
+            return nil, err
+        }
+
+        pid, start, payload := tsPayload(packet)
+        p, ok := pes[pid]
+        if !ok || payload == nil {
+            continue
+        }
+        cc := int(packet[3] & 0x0F)
+        // Duplicate packets repeat the counter and payload of the previous one
+        if p.cc >= 0 && cc == p.cc {
+            continue
+        }
+        if p.started && p.cc >= 0 && cc != (p.cc + 1) & 0x0F {
+            log.Printf("Warning: Lost packets of PID 0x%04X at offset %d, dropping PES packet", pid, t.offset)
+            p.started, p.data = false, nil
+        }
+        p.cc = cc
+        if start {
+            if p.started {
+                if err := addPES(builders[pid], p.data); err != nil {
+                    return nil, err
+                }
+            }
+            p.started, p.data = true, append([]byte{}, payload...)
+        } else if p.started {
+            p.data = append(p.data, payload...)
+        }
+    }
+
+    streams := map[uint16]PGS{}
+    for pid, b := range builders {
+        if p := pes[pid]; p.started {
+            if err := addPES(b, p.data); err != nil {
+                return nil, err
+            }
+        }
+        streams[pid] = b.Finish()
+    }
+    return streams, nil
+}
+
+// ReadPGS decodes a single PGS stream
+func (t *TSReader) ReadPGS(pid uint16) (PGS, error) {
+    streams, err := t.ReadPGSStreams([]uint16{pid})
+    if err != nil {
+        return PGS{}, err
+    }
+    return streams[pid], nil
+}
+
+// packet reads the next TS packet without the M2TS arrival timestamp
+func (t *TSReader) packet() ([]byte, error) {
+    packet := make([]byte, t.PacketSize)
+    n, err := io.ReadFull(t.r, packet)
+    t.offset += int64(n)
+    if err != nil {
+        return nil, err
+    }
+    packet = packet[t.PacketSize - TSPacketSize:]
+    if packet[0] != tsSyncByte {
+        return nil, fmt.Errorf("Lost transport stream sync at offset %d", t.offset - int64(t.PacketSize))
+    }
+    return packet, nil
+}
+
+// tsPayload returns the PID, payload unit start indicator and payload of a packet,
+// the payload is nil for packets with errors or without one
+func tsPayload(packet []byte) (uint16, bool, []byte) {
+    pid := binary.BigEndian.Uint16(packet[1:3]) & 0x1FFF
+    start := packet[1] & 0x40 != 0
+    if packet[1] & 0x80 != 0 {
+        return pid, start, nil
+    }
+    control := (packet[3] >> 4) & 3
+    if control & 1 == 0 {
+        return pid, start, nil
+    }
+    payload := packet[4:]
+    if control & 2 != 0 {
+        if len(payload) == 0 || int(payload[0]) >= len(payload) {
+            return pid, start, nil
+        }
+        payload = payload[1 + int(payload[0]):]
+    }
+    return pid, start, payload
+}
+
+// psiSection skips the pointer field of a PSI payload
+func psiSection(payload []byte) []byte {
+    if len(payload) == 0 || int(payload[0]) >= len(payload) {
+        return nil
+    }
+    return payload[1 + int(payload[0]):]
+}
+
+// psiTable returns the table ID and the data of a section between its header and CRC
+func psiTable(section []byte) (uint8, []byte, error) {
+    if len(section) < 12 {
+        return 0, nil, fmt.Errorf("Truncated PSI section")
+    }
+    length := int(binary.BigEndian.Uint16(section[1:3]) & 0x0FFF)
+    if length < 9 || 3 + length > len(section) {
+        return 0, nil, fmt.Errorf("Invalid PSI section length %d", length)
+    }
+    return section[0], section[8:3 + length - 4], nil
+}
+
+// parsePAT returns the PMT PIDs of the programs
+func parsePAT(section []byte) ([]uint16, error) {
+    table, data, err := psiTable(section)
+    if err != nil {
+        return nil, err
+    }
+    if table != 0x00 {
+        return nil, fmt.Errorf("Invalid PAT table ID 0x%02X", table)
+    }
+    var pids []uint16
+    for ; len(data) >= 4; data = data[4:] {
+        // Program 0 is the network information table
+        if binary.BigEndian.Uint16(data[0:2]) != 0 {
+            pids = append(pids, binary.BigEndian.Uint16(data[2:4]) & 0x1FFF)
+        }
+    }
+    return pids, nil
+}
+
+// parsePMT returns the elementary streams of a program
+func parsePMT(section []byte) ([]TSStream, error) {
+    table, data, err := psiTable(section)
+    if err != nil {
+        return nil, err
+    }
+    if table != 0x02 {
+        return nil, fmt.Errorf("Invalid PMT table ID 0x%02X", table)
+    }
+    if len(data) < 4 {
+        return nil, fmt.Errorf("Truncated PMT")
+    }
+    info := int(binary.BigEndian.Uint16(data[2:4]) & 0x0FFF)
+    if 4 + info > len(data) {
+        return nil, fmt.Errorf("Invalid PMT program info length %d", info)
+    }
+    data = data[4 + info:]
+
+    var streams []TSStream
+    for len(data) >= 5 {
+        s := TSStream{Type: data[0], PID: binary.BigEndian.Uint16(data[1:3]) & 0x1FFF}
+        length := int(binary.BigEndian.Uint16(data[3:5]) & 0x0FFF)
+        if 5 + length > len(data) {
+            return nil, fmt.Errorf("Invalid PMT stream info length %d", length)
+        }
+        for desc := data[5:5 + length]; len(desc) >= 2 && 2 + int(desc[1]) <= len(desc); desc = desc[2 + int(desc[1]):] {
+            if desc[0] == tsLanguageDescriptor && desc[1] >= 3 {
+                s.Language = string(desc[2:5])
+            }
+        }
+        streams = append(streams, s)
+        data = data[5 + length:]
+    }
+    return streams, nil
+}
+
+// addPES adds the segments of a PES packet with its timestamps in milliseconds
+func addPES(b *PGSBuilder, pes []byte) error {
+    if len(pes) < 9 || pes[0] != 0 || pes[1] != 0 || pes[2] != 1 {
+        log.Printf("Warning: Skipping PES packet without start code")
+        return nil
+    }
+    end := len(pes)
+    if length := int(binary.BigEndian.Uint16(pes[4:6])); length > 0 && 6 + length < end {
+        end = 6 + length
+    }
+    header := 9 + int(pes[8])
+    if header > end {
+        log.Printf("Warning: Skipping truncated PES packet")
+        return nil
+    }
+    var pts, dts uint32
+    flags := pes[7] >> 6
+    if flags & 2 != 0 && header >= 14 {
+        pts = pesTimestamp(pes[9:14]) / TimestampAccuracy
+        dts = pts
+    }
+    if flags == 3 && header >= 19 {
+        dts = pesTimestamp(pes[14:19]) / TimestampAccuracy
+    }
+    return b.AddPacket(pes[header:end], pts, dts)
+}
+
+// pesTimestamp decodes a 33 bit 90kHz PES timestamp, truncated to 32 bits like SUP headers
+func pesTimestamp(b []byte) uint32 {
+    ts := uint64(b[0] >> 1 & 0x07) << 30 | uint64(binary.BigEndian.Uint16(b[1:3]) >> 1) << 15 | uint64(binary.BigEndian.Uint16(b[3:5]) >> 1)
+    return uint32(ts)
+}
@@ -0,0 +1,195 @@
+package suptext
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// Helper function to create a TS packet, stuffing the adaptation field to fill it
+func createTSPacket(pid uint16, start bool, cc uint8, payload []byte) []byte {
+	packet := []byte{tsSyncByte, byte(pid >> 8), byte(pid), 0x10 | cc&0x0F}
+	if start {
+		packet[1] |= 0x40
+	}
+	if stuffing := TSPacketSize - 4 - len(payload); stuffing > 0 {
+		packet[3] |= 0x20
+		adaptation := make([]byte, stuffing)
+		adaptation[0] = byte(stuffing - 1)
+		for i := 2; i < stuffing; i++ {
+			adaptation[i] = 0xFF
+		}
+		packet = append(packet, adaptation...)
+	}
+	return append(packet, payload...)
+}
+
+// Helper function to create a PSI section with a zero CRC
+func createPSISection(table uint8, data []byte) []byte {
+	section := []byte{0, table, 0xB0, 0, 0, 1, 0xC1, 0, 0}
+	binary.BigEndian.PutUint16(section[2:4], 0xB000|uint16(5+len(data)+4))
+	section = append(section, data...)
+	return append(section, 0, 0, 0, 0)
+}
+
+// Helper function to create a PES packet with a PTS, and a DTS if not zero
+func createPESPacket(pts, dts uint32, payload []byte) []byte {
+	encode := func(prefix uint8, ts uint32) []byte {
+		ts64 := uint64(ts) * TimestampAccuracy
+		return []byte{
+			prefix<<4 | byte(ts64>>29)&0x0E | 1,
+			byte(ts64 >> 22), byte(ts64>>14) | 1,
+			byte(ts64 >> 7), byte(ts64<<1) | 1,
+		}
+	}
+	header := []byte{0, 0, 1, 0xBD, 0, 0, 0x81, 0x80, 5}
+	timestamps := encode(2, pts)
+	if dts != 0 {
+		header[7], header[8] = 0xC0, 10
+		timestamps = append(encode(3, pts), encode(1, dts)...)
+	}
+	binary.BigEndian.PutUint16(header[4:6], uint16(3+len(timestamps)+len(payload)))
+	return append(append(header, timestamps...), payload...)
+}
+
+func createTestTS(m2ts bool) []byte {
+	pat := createPSISection(0x00, []byte{0, 1, 0xE1, 0x00})
+	streams := []byte{
+		0x1B, 0xF0, 0x11, 0xF0, 0x00,
+		TSStreamTypePGS, 0xF2, 0x00, 0xF0, 0x05, tsLanguageDescriptor, 3, 'd', 'e', 'u',
+		TSStreamTypePGS, 0xF2, 0x01, 0xF0, 0x00,
+	}
+	pmt := createPSISection(0x02, append([]byte{0xF0, 0x11, 0xF0, 0x00}, streams...))
+
+	first := createPESPacket(1000, 900, createPacketDisplaySet())
+	second := createPESPacket(4000, 0, createPacketDisplaySet())
+	packets := [][]byte{
+		createTSPacket(tsPATPID, true, 0, pat),
+		createTSPacket(0x100, true, 0, pmt),
+		createTSPacket(0x1011, true, 0, []byte{0, 0, 1, 0xE0}),
+		// The first PES packet is split over two TS packets
+		createTSPacket(0x1200, true, 0, first[:10]),
+		createTSPacket(0x1201, true, 0, createPESPacket(2000, 0, createPacketDisplaySet())),
+		createTSPacket(0x1200, false, 1, first[10:]),
+		createTSPacket(0x1200, true, 2, second),
+	}
+	var buf bytes.Buffer
+	for i, p := range packets {
+		if m2ts {
+			var arrival [4]byte
+			binary.BigEndian.PutUint32(arrival[:], uint32(i*1000))
+			buf.Write(arrival[:])
+		}
+		buf.Write(p)
+	}
+	return buf.Bytes()
+}
+
+func TestOpenTS(t *testing.T) {
+	for _, m2ts := range []bool{false, true} {
+		file := createTestTS(m2ts)
+		if !IsTransportStream(file) {
+			t.Fatalf("Expected transport stream magic (m2ts %v)", m2ts)
+		}
+		r, err := OpenTS(bytes.NewReader(file))
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if m2ts && r.PacketSize != M2TSPacketSize || !m2ts && r.PacketSize != TSPacketSize {
+			t.Errorf("Unexpected packet size %d (m2ts %v)", r.PacketSize, m2ts)
+		}
+		streams := r.PGSStreams()
+		if len(r.Streams) != 3 || len(streams) != 2 {
+			t.Fatalf("Expected 3 streams with 2 PGS, got %+v", r.Streams)
+		}
+		if streams[0].PID != 0x1200 || streams[0].Language != "deu" || streams[1].Language != "" {
+			t.Errorf("Unexpected PGS streams %+v", streams)
+		}
+
+		pgs, err := r.ReadPGSStreams([]uint16{0x1200, 0x1201})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		sets := pgs[0x1200].Sections
+		if len(sets) != 2 || len(pgs[0x1201].Sections) != 1 {
+			t.Fatalf("Expected 2 and 1 display sets, got %d and %d", len(sets), len(pgs[0x1201].Sections))
+		}
+		if sets[0].PCS.PTS != 1000 || sets[0].PCS.DTS != 900 || sets[1].PCS.PTS != 4000 || sets[1].PCS.DTS != 4000 {
+			t.Errorf("Unexpected timestamps %d/%d and %d/%d", sets[0].PCS.PTS, sets[0].PCS.DTS, sets[1].PCS.PTS, sets[1].PCS.DTS)
+		}
+	}
+}
+
+func TestOpenTS_NoTables(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write(createTSPacket(0x1011, true, 0, []byte{0, 0, 1, 0xE0}))
+	buf.Write(createTSPacket(0x1202, true, 0, createPESPacket(2000, 0, createPacketDisplaySet())))
+	r, err := OpenTS(&buf)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(r.Streams) != 1 || r.Streams[0].PID != 0x1202 {
+		t.Fatalf("Expected PGS stream from the PID range, got %+v", r.Streams)
+	}
+	pgs, err := r.ReadPGS(0x1202)
+	if err != nil || len(pgs.Sections) != 1 {
+		t.Errorf("Expected 1 display set, got %d, %v", len(pgs.Sections), err)
+	}
+	if _, err := r.ReadPGS(0x1011); err == nil {
+		t.Error("Expected error reading video PID")
+	}
+}
+
+func TestTSReadPGS_LostPackets(t *testing.T) {
+	first := createPESPacket(1000, 0, createPacketDisplaySet())
+	var buf bytes.Buffer
+	buf.Write(createTSPacket(0x1200, true, 0, first[:10]))
+	// Continuity counter 2 follows 0, the rest of the first PES packet is dropped
+	buf.Write(createTSPacket(0x1200, false, 2, first[10:]))
+	buf.Write(createTSPacket(0x1200, true, 3, createPESPacket(2000, 0, createPacketDisplaySet())))
+	r, err := OpenTS(&buf)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	pgs, err := r.ReadPGS(0x1200)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(pgs.Sections) != 1 || pgs.Sections[0].PCS.PTS != 2000 {
+		t.Errorf("Expected only the second display set, got %+v", pgs.Sections)
+	}
+}
+
+func TestTSReadPGS_DuplicatePackets(t *testing.T) {
+	first := createPESPacket(1000, 0, createPacketDisplaySet())
+	var buf bytes.Buffer
+	buf.Write(createTSPacket(0x1200, true, 0, first[:20]))
+	// The duplicate of the second packet has the same counter and payload, in the middle of the PCS
+	buf.Write(createTSPacket(0x1200, false, 1, first[20:26]))
+	buf.Write(createTSPacket(0x1200, false, 1, first[20:26]))
+	buf.Write(createTSPacket(0x1200, false, 2, first[26:]))
+	buf.Write(createTSPacket(0x1200, true, 3, createPESPacket(2000, 0, createPacketDisplaySet())))
+	r, err := OpenTS(&buf)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	pgs, err := r.ReadPGS(0x1200)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(pgs.Sections) != 2 || pgs.Sections[0].PCS.PTS != 1000 || pgs.Sections[1].PCS.PTS != 2000 {
+		t.Fatalf("Expected 2 display sets, got %+v", pgs.Sections)
+	}
+	if problems := pgs.Validate(); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+}
+
+func TestIsTransportStream(t *testing.T) {
+	if IsTransportStream([]byte{tsSyncByte}) {
+		t.Error("Expected a single sync byte not to be a transport stream")
+	}
+	if IsTransportStream(make([]byte, 2*M2TSPacketSize)) {
+		t.Error("Expected zeros not to be a transport stream")
+	}
+}
@@ -0,0 +1,617 @@
+package suptext
+
+import (
+    "bufio"
+    "bytes"
+    "compress/zlib"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "math/bits"
+    "sort"
+)
+
+// Matroska element IDs
+const (
+    mkvEBML = 0x1A45DFA3
+    mkvDocType = 0x4282
+    mkvSegment = 0x18538067
+    mkvInfo = 0x1549A966
+    mkvTimestampScale = 0x2AD7B1
+    mkvTracks = 0x1654AE6B
+    mkvTrackEntry = 0xAE
+    mkvTrackNumber = 0xD7
+    mkvTrackType = 0x83
+    mkvCodecID = 0x86
+    mkvName = 0x536E
+    mkvLanguage = 0x22B59C
+    mkvLanguageIETF = 0x22B59D
+    mkvFlagEnabled = 0xB9
+    mkvFlagDefault = 0x88
+    mkvFlagForced = 0x55AA
+    mkvFlagHearingImpaired = 0x55AB
+    mkvContentEncodings = 0x6D80
+    mkvContentEncoding = 0x6240
+    mkvContentEncodingOrder = 0x5031
+    mkvContentEncodingScope = 0x5032
+    mkvContentEncodingType = 0x5033
+    mkvContentCompression = 0x5034
+    mkvContentCompAlgo = 0x4254
+    mkvContentCompSettings = 0x4255
+    mkvCluster = 0x1F43B675
+    mkvTimestamp = 0xE7
+    mkvSimpleBlock = 0xA3
+    mkvBlockGroup = 0xA0
+    mkvBlock = 0xA1
+)
+
+// Matroska track type of subtitles and codec ID of PGS subtitles
+const MKVTrackSubtitle = 0x11
+const MKVCodecPGS = "S_HDMV/PGS"
+
+// Default nanoseconds per Matroska timestamp tick
+const MKVDefaultTimestampScale = 1000000
+
+// Largest element read into memory, anything larger is treated as corrupt
+const mkvMaxElementSize = 64 << 20
+
+// Content compression algorithms
+const (
+    mkvCompZlib = 0
+    mkvCompHeaderStripping = 3
+)
+
+// MKVTrack describes a Matroska track
+type MKVTrack struct {
+    Number uint64
+    Type uint8
+    Codec string
+    // ISO 639-2 language, "eng" if unset, and the BCP 47 language if set
+    Language string
+    LanguageIETF string
+    Name string
+    Enabled bool
+    Default bool
+    Forced bool
+    HearingImpaired bool
+    encodings []mkvEncoding
+}
+
+type mkvEncoding struct {
+    order uint64
+    scope uint64
+    kind uint64
+    algo uint64
+    settings []byte
+}
+
+// IsPGS reports whether the track holds PGS subtitles
+func (t *MKVTrack) IsPGS() bool {
+    return t.Type == MKVTrackSubtitle && t.Codec == MKVCodecPGS
+}
+
+// MKVBlock is a block of a track with its frames and timestamp in milliseconds
+type MKVBlock struct {
+    Track uint64
+    Timestamp int64
+    Frames [][]byte
+}
+
+// MKVReader reads Matroska files as a stream, so no seeking is needed
+type MKVReader struct {
+    r *bufio.Reader
+    offset int64
+    TimestampScale uint64
+    Tracks []MKVTrack
+    clusterTime int64
+    // Counts the segments and display sets of the tracks read if not nil
+    Progress *ProgressTracker
+    // Called with each segment of the tracks read if not nil
+    OnSegment func(track uint64, section Section, data []byte)
+}
+
+// IsMatroska reports whether the file starts with an EBML header
+func IsMatroska(magic []byte) bool {
+    return len(magic) >= 4 && binary.BigEndian.Uint32(magic) == mkvEBML
+}
+
+// OpenMKV reads the Matroska header and tracks, leaving r at the first cluster
+func OpenMKV(r io.Reader) (*MKVReader, error) {
+    m := &MKVReader{r: bufio.NewReader(r), TimestampScale: MKVDefaultTimestampScale}
+    id, size, _, err := m.element()
+    if err != nil {
+        return nil, err
+    }
+    if id != mkvEBML {
+        return nil, fmt.Errorf("Not a Matroska file: missing EBML header")
+    }
+    header, err := m.read(size)
+    if err != nil {
+        return nil, err
+    }
+    var doctype string
+    parseElements(header, func(id uint64, data []byte) error {
+        if id == mkvDocType {
+            doctype = string(data)
+        }
+        return nil
+    })
+    if doctype != "matroska" && doctype != "webm" {
+        return nil, fmt.Errorf("Unsupported EBML document type '%s'", doctype)
+    }
+
+    // Segment children up to the first cluster
+    for {
+        id, size, unknown, err := m.element()
+        if err == io.EOF {
+            return nil, fmt.Errorf("Matroska file has no clusters")
+        }
+        if err != nil {
+            return nil, err
+        }
+        switch id {
+        case mkvSegment:
+            // Children follow
+        case mkvCluster:
+            if m.Tracks == nil {
+                return nil, fmt.Errorf("Matroska cluster before tracks at offset %d", m.offset)
+            }
+            return m, nil
+        case mkvInfo, mkvTracks:
+            if unknown {
+                return nil, fmt.Errorf("Matroska element 0x%X of unknown size", id)
+            }
+            data, err := m.read(size)
+            if err != nil {
+                return nil, err
+            }
+            if id == mkvInfo {
+                err = m.parseInfo(data)
+            } else {
+                err = m.parseTracks(data)
+            }
+            if err != nil {
+                return nil, err
+            }
+        default:
+            if err := m.skip(id, size, unknown); err != nil {
+                return nil, err
+            }
+        }
+    }
+}
+
+func (m *MKVReader) parseInfo(data []byte) error {
+    return parseElements(data, func(id uint64, data []byte) error {
+        if id == mkvTimestampScale {
+            m.TimestampScale = readUint(data)
+            if m.TimestampScale == 0 {
+                return fmt.Errorf("Invalid Matroska timestamp scale 0")
+            }
+        }
+        return nil
+    })
+}
+
+func (m *MKVReader) parseTracks(data []byte) error {
+    m.Tracks = []MKVTrack{}
+    return parseElements(data, func(id uint64, data []byte) error {
+        if id != mkvTrackEntry {
+            return nil
+        }
+        t := MKVTrack{Language: "eng", Enabled: true, Default: true}
+        err := parseElements(data, func(id uint64, data []byte) error {
+            switch id {
+            case mkvTrackNumber:
+                t.Number = readUint(data)
+            case mkvTrackType:
+                t.Type = uint8(readUint(data))
+            case mkvCodecID:
+                t.Codec = readString(data)
+            case mkvName:
+                t.Name = readString(data)
+            case mkvLanguage:
+                t.Language = readString(data)
+            case mkvLanguageIETF:
+                t.LanguageIETF = readString(data)
+            case mkvFlagEnabled:
+                t.Enabled = readUint(data) != 0
+            case mkvFlagDefault:
+                t.Default = readUint(data) != 0
+            case mkvFlagForced:
+                t.Forced = readUint(data) != 0
+            case mkvFlagHearingImpaired:
+                t.HearingImpaired = readUint(data) != 0
+            case mkvContentEncodings:
+                return parseElements(data, func(id uint64, data []byte) error {
+                    if id != mkvContentEncoding {
+                        return nil
+                    }
+                    enc, err := parseEncoding(data)
+                    t.encodings = append(t.encodings, enc)
+                    return err
+                })
+            }
+            return nil
+        })
+        if err != nil {
+            return err
+        }
+        // Decoding undoes the encodings from the highest order down
+        sort.Slice(t.encodings, func(i, j int) bool { return t.encodings[i].order > t.encodings[j].order })
+        m.Tracks = append(m.Tracks, t)
+        return nil
+    })
+}
+
+func parseEncoding(data []byte) (mkvEncoding, error) {
+    enc := mkvEncoding{scope: 1}
+    err := parseElements(data, func(id uint64, data []byte) error {
+        switch id {
+        case mkvContentEncodingOrder:
+            enc.order = readUint(data)
+        case mkvContentEncodingScope:
+            enc.scope = readUint(data)
+        case mkvContentEncodingType:
+            enc.kind = readUint(data)
+        case mkvContentCompression:
+            return parseElements(data, func(id uint64, data []byte) error {
+                switch id {
+                case mkvContentCompAlgo:
+                    enc.algo = readUint(data)
+                case mkvContentCompSettings:
+                    enc.settings = data
+                }
+                return nil
+            })
+        }
+        return nil
+    })
+    return enc, err
+}
+
+// PGSTracks returns the PGS subtitle tracks
+func (m *MKVReader) PGSTracks() []MKVTrack {
+    var tracks []MKVTrack
+    for _, t := range m.Tracks {
+        if t.IsPGS() {
+            tracks = append(tracks, t)
+        }
+    }
+    return tracks
+}
+
+func (m *MKVReader) track(number uint64) *MKVTrack {
+    for i := range m.Tracks {
+        if m.Tracks[i].Number == number {
+            return &m.Tracks[i]
+        }
+    }
+    return nil
+}
+
+// NextBlock returns the next block of any track, io.EOF after the last cluster
+func (m *MKVReader) NextBlock() (MKVBlock, error) {
+    return m.nextBlock(nil)
+}
+
+// nextBlock returns the next block of the wanted tracks, any track if nil. The blocks of other
+// tracks are skipped without unlacing or decoding them.
+func (m *MKVReader) nextBlock(wanted map[uint64]bool) (MKVBlock, error) {
+    for {
+        id, size, unknown, err := m.element()
+        if err != nil {
+            return MKVBlock{}, err
+        }
+        switch id {
+        case mkvSegment, mkvCluster, mkvBlockGroup:
+            // Children follow
+        case mkvTimestamp:
+            if unknown {
+                return MKVBlock{}, fmt.Errorf("Matroska element 0x%X of unknown size", id)
+            }
+            data, err := m.read(size)
+            if err != nil {
+                return MKVBlock{}, err
+            }
+            m.clusterTime = int64(readUint(data))
+        case mkvSimpleBlock, mkvBlock:
+            if unknown {
+                return MKVBlock{}, fmt.Errorf("Matroska element 0x%X of unknown size", id)
+            }
+            track, n, err := readVint(m.r, false)
+            if err == io.EOF {
+                return MKVBlock{}, io.ErrUnexpectedEOF
+            }
+            if err != nil || uint64(n) > size {
+                return MKVBlock{}, fmt.Errorf("Invalid Matroska block at offset %d", m.offset)
+            }
+            m.offset += int64(n)
+            if wanted != nil && !wanted[track] {
+                if err := m.skip(id, size - uint64(n), false); err != nil {
+                    return MKVBlock{}, err
+                }
+                continue
+            }
+            data, err := m.read(size - uint64(n))
+            if err != nil {
+                return MKVBlock{}, err
+            }
+            return m.parseBlock(track, data)
+        default:
+            if err := m.skip(id, size, unknown); err != nil {
+                return MKVBlock{}, err
+            }
+        }
+    }
+}
+
+// parseBlock reads the timestamp and laced frames of a (Simple)Block of track, data follows the
+// track number
+func (m *MKVReader) parseBlock(track uint64, data []byte) (MKVBlock, error) {
+    r := bytes.NewReader(data)
+    var header [3]byte
+    if _, err := io.ReadFull(r, header[:]); err != nil {
+        return MKVBlock{}, fmt.Errorf("Invalid Matroska block: truncated header")
+    }
+    ticks := m.clusterTime + int64(int16(binary.BigEndian.Uint16(header[:2])))
+    block := MKVBlock{Track: track, Timestamp: ticks * int64(m.TimestampScale) / 1000000}
+
+    frames, err := unlace(data[len(data) - r.Len():], (header[2] >> 1) & 3)
+    if err != nil {
+        return MKVBlock{}, fmt.Errorf("Invalid Matroska block lacing: %v", err)
+    }
+    if t := m.track(track); t != nil {
+        for i := range frames {
+            if frames[i], err = t.decode(frames[i]); err != nil {
+                return MKVBlock{}, fmt.Errorf("Failed to decode track %d block: %v", track, err)
+            }
+        }
+    }
+    block.Frames = frames
+    return block, nil
+}
+
+// unlace splits block data into frames, lacing is 0 none, 1 Xiph, 2 fixed size or 3 EBML
+func unlace(data []byte, lacing byte) ([][]byte, error) {
+    if lacing == 0 {
+        return [][]byte{data}, nil
+    }
+    if len(data) == 0 {
+        return nil, fmt.Errorf("missing frame count")
+    }
+    count := int(data[0]) + 1
+    r := bytes.NewReader(data[1:])
+    sizes := make([]int, count - 1)
+    switch lacing {
+    case 1:
+        for i := range sizes {
+            for {
+                b, err := r.ReadByte()
+                if err != nil {
+                    return nil, fmt.Errorf("truncated sizes")
+                }
+                sizes[i] += int(b)
+                if b != 0xFF {
+                    break
+                }
+            }
+        }
+    case 2:
+        if r.Len() % count != 0 {
+            return nil, fmt.Errorf("%d bytes can't be split into %d frames", r.Len(), count)
+        }
+        for i := range sizes {
+            sizes[i] = r.Len() / count
+        }
+    case 3:
+        for i := range sizes {
+            v, n, err := readVint(r, false)
+            if err != nil {
+                return nil, err
+            }
+            if i == 0 {
+                sizes[i] = int(v)
+            } else {
+                // Signed difference to the previous size
+                sizes[i] = sizes[i - 1] + int(int64(v) - (int64(1) << (7 * n - 1) - 1))
+            }
+        }
+    }
+
+    rest := data[len(data) - r.Len():]
+    frames := make([][]byte, 0, count)
+    for _, size := range sizes {
+        if size < 0 || size > len(rest) {
+            return nil, fmt.Errorf("frame size %d exceeds block", size)
+        }
+        frames = append(frames, rest[:size])
+        rest = rest[size:]
+    }
+    return append(frames, rest), nil
+}
+
+// decode undoes the track's content compression of a frame
+func (t *MKVTrack) decode(frame []byte) ([]byte, error) {
+    for _, enc := range t.encodings {
+        if enc.scope & 1 == 0 {
+            continue
+        }
+        if enc.kind != 0 {
+            return nil, fmt.Errorf("encrypted tracks are not supported")
+        }
+        switch enc.algo {
+        case mkvCompZlib:
+            zr, err := zlib.NewReader(bytes.NewReader(frame))
+            if err != nil {
+                return nil, err
+            }
+            if frame, err = io.ReadAll(zr); err != nil {
+                return nil, err
+            }
+        case mkvCompHeaderStripping:
+            frame = append(append([]byte{}, enc.settings...), frame...)
+        default:
+            return nil, fmt.Errorf("unsupported compression algorithm %d", enc.algo)
+        }
+    }
+    return frame, nil
+}
+
+// ReadPGSTracks decodes the given PGS tracks in a single pass over the clusters
+func (m *MKVReader) ReadPGSTracks(numbers []uint64) (map[uint64]PGS, error) {
+    builders := map[uint64]*PGSBuilder{}
+    for _, n := range numbers {
+        t := m.track(n)
+        if t == nil || !t.IsPGS() {
+            return nil, fmt.Errorf("Track %d is not a PGS subtitle track", n)
+        }
+        builders[n] = &PGSBuilder{Progress: m.Progress, OnSegment: trackSegmentHook(m.OnSegment, n)}
+    }
+
+    wanted := map[uint64]bool{}
+    for n := range builders {
+        wanted[n] = true
+    }
+    for {
+        block, err := m.nextBlock(wanted)
+        if err == io.EOF {
+            break
+        }
+        if errors.Is(err, io.ErrUnexpectedEOF) {
+            log.Printf("Warning: Truncated Matroska file at offset %d", m.offset)
+            break
+        }
+        if err != nil {
+            return nil, err
+        }
+        b := builders[block.Track]
+        ts := uint32(0)
+        if block.Timestamp > 0 {
+            ts = uint32(block.Timestamp)
+        }
+        for _, frame := range block.Frames {
+            if err := b.AddPacket(frame, ts, ts); err != nil {
+                return nil, err
+            }
+        }
+    }
+
+    tracks := map[uint64]PGS{}
+    for n, b := range builders {
+        tracks[n] = b.Finish()
+    }
+    return tracks, nil
+}
+
+// ReadPGS decodes a single PGS track
+func (m *MKVReader) ReadPGS(number uint64) (PGS, error) {
+    tracks, err := m.ReadPGSTracks([]uint64{number})
+    if err != nil {
+        return PGS{}, err
+    }
+    return tracks[number], nil
+}
+
+// element reads the next element header, unknown is set for masters of unknown size
+func (m *MKVReader) element() (uint64, uint64, bool, error) {
+    id, n, err := readVint(m.r, true)
+    if err != nil {
+        return 0, 0, false, err
+    }
+    m.offset += int64(n)
+    size, n, err := readVint(m.r, false)
+    if err != nil {
+        if err == io.EOF {
+            err = io.ErrUnexpectedEOF
+        }
+        return 0, 0, false, err
+    }
+    m.offset += int64(n)
+    unknown := size == uint64(1) << (7 * n) - 1
+    return id, size, unknown, nil
+}
+
+func (m *MKVReader) read(size uint64) ([]byte, error) {
+    if size > mkvMaxElementSize {
+        return nil, fmt.Errorf("Matroska element of %d bytes at offset %d is too large", size, m.offset)
+    }
+    data := make([]byte, size)
+    n, err := io.ReadFull(m.r, data)
+    m.offset += int64(n)
+    if err == io.EOF {
+        err = io.ErrUnexpectedEOF
+    }
+    return data, err
+}
+
+func (m *MKVReader) skip(id uint64, size uint64, unknown bool) error {
+    if unknown {
+        return fmt.Errorf("Matroska element 0x%X of unknown size", id)
+    }
+    n, err := io.CopyN(io.Discard, m.r, int64(size))
+    m.offset += n
+    if err == io.EOF {
+        err = io.ErrUnexpectedEOF
+    }
+    return err
+}
+
+// readVint reads an EBML variable size integer and its length, keeping the length marker for IDs
+func readVint(r io.ByteReader, keepMarker bool) (uint64, int, error) {
+    b, err := r.ReadByte()
+    if err != nil {
+        return 0, 0, err
+    }
+    n := bits.LeadingZeros8(b) + 1
+    if n > 8 {
+        return 0, 0, fmt.Errorf("Invalid EBML variable size integer")
+    }
+    v := uint64(b)
+    if !keepMarker {
+        v &= 0xFF >> n
+    }
+    for i := 1; i < n; i++ {
+        c, err := r.ReadByte()
+        if err != nil {
+            return 0, 0, io.ErrUnexpectedEOF
+        }
+        v = v << 8 | uint64(c)
+    }
+    return v, n, nil
+}
+
+// parseElements calls fn with the ID and data of every child element in data
+func parseElements(data []byte, fn func(id uint64, data []byte) error) error {
+    r := bytes.NewReader(data)
+    for r.Len() > 0 {
+        id, _, err := readVint(r, true)
+        if err != nil {
+            return fmt.Errorf("Invalid Matroska element: %v", err)
+        }
+        size, _, err := readVint(r, false)
+        if err != nil || size > uint64(r.Len()) {
+            return fmt.Errorf("Invalid Matroska element 0x%X size", id)
+        }
+        start := len(data) - r.Len()
+        if err := fn(id, data[start:start + int(size)]); err != nil {
+            return err
+        }
+        r.Seek(int64(size), io.SeekCurrent)
+    }
+    return nil
+}
+
+func readUint(data []byte) uint64 {
+    var v uint64
+    for _, b := range data {
+        v = v << 8 | uint64(b)
+    }
+    return v
+}
+
+func readString(data []byte) string {
+    return string(bytes.TrimRight(data, "\x00"))
+}
@@ -0,0 +1,233 @@
+package suptext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// Helper function to encode an EBML element with a minimal size
+func ebmlElement(id uint64, children ...[]byte) []byte {
+	var data []byte
+	for _, c := range children {
+		data = append(data, c...)
+	}
+	var out []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(out) > 0 {
+			out = append(out, b)
+		}
+	}
+	n := 1
+	for uint64(len(data)) >= uint64(1)<<(7*n)-1 {
+		n++
+	}
+	size := uint64(len(data)) | uint64(1)<<(7*n)
+	for i := n - 1; i >= 0; i-- {
+		out = append(out, byte(size>>(8*i)))
+	}
+	return append(out, data...)
+}
+
+// Helper function to encode a master element of unknown size
+func ebmlUnknownSize(id uint64) []byte {
+	out := ebmlElement(id)
+	return append(out[:len(out)-1], 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+}
+
+func ebmlUint(id uint64, v uint64) []byte {
+	return ebmlElement(id, []byte{byte(v >> 8), byte(v)})
+}
+
+// Helper function to create a SimpleBlock or Block without lacing
+func createMKVBlock(id uint64, track uint8, rel int16, frame []byte) []byte {
+	header := []byte{0x80 | track, 0, 0, 0}
+	binary.BigEndian.PutUint16(header[1:3], uint16(rel))
+	return ebmlElement(id, header, frame)
+}
+
+// Helper function to create the segments of an empty display set as stored in container packets
+func createPacketDisplaySet() []byte {
+	pcs := make([]byte, 11)
+	binary.BigEndian.PutUint16(pcs[0:2], 1920)
+	binary.BigEndian.PutUint16(pcs[2:4], 1080)
+	pcs[4] = 0x10
+	pcs[7] = 0x80
+	frame := []byte{PCS, 0, 11}
+	frame = append(frame, pcs...)
+	return append(frame, END, 0, 0)
+}
+
+func createTestMKV(t *testing.T) []byte {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(createPacketDisplaySet())
+	zw.Close()
+
+	var file []byte
+	file = append(file, ebmlElement(mkvEBML, ebmlElement(mkvDocType, []byte("matroska")))...)
+	file = append(file, ebmlUnknownSize(mkvSegment)...)
+	file = append(file, ebmlElement(mkvInfo, ebmlUint(mkvTimestampScale, 1000))...)
+	file = append(file, ebmlElement(mkvTracks,
+		ebmlElement(mkvTrackEntry,
+			ebmlUint(mkvTrackNumber, 1),
+			ebmlUint(mkvTrackType, 1),
+			ebmlElement(mkvCodecID, []byte("V_MPEG4/ISO/AVC")),
+		),
+		ebmlElement(mkvTrackEntry,
+			ebmlUint(mkvTrackNumber, 2),
+			ebmlUint(mkvTrackType, MKVTrackSubtitle),
+			ebmlElement(mkvCodecID, []byte(MKVCodecPGS)),
+			ebmlElement(mkvLanguage, []byte("ger")),
+			ebmlElement(mkvName, []byte("Forced")),
+			ebmlUint(mkvFlagDefault, 0),
+			ebmlUint(mkvFlagForced, 1),
+		),
+		ebmlElement(mkvTrackEntry,
+			ebmlUint(mkvTrackNumber, 3),
+			ebmlUint(mkvTrackType, MKVTrackSubtitle),
+			ebmlElement(mkvCodecID, []byte(MKVCodecPGS)),
+			ebmlElement(mkvContentEncodings, ebmlElement(mkvContentEncoding,
+				ebmlElement(mkvContentCompression, ebmlUint(mkvContentCompAlgo, mkvCompZlib)),
+			)),
+		),
+	)...)
+	// Timestamps are in microseconds
+	file = append(file, ebmlUnknownSize(mkvCluster)...)
+	file = append(file, ebmlUint(mkvTimestamp, 1000)...)
+	file = append(file, createMKVBlock(mkvSimpleBlock, 2, 500, createPacketDisplaySet())...)
+	file = append(file, createMKVBlock(mkvSimpleBlock, 1, 0, []byte{1, 2, 3})...)
+	file = append(file, createMKVBlock(mkvSimpleBlock, 3, 0, compressed.Bytes())...)
+	file = append(file, ebmlElement(0xEC, make([]byte, 4))...)
+	file = append(file, ebmlElement(mkvCluster,
+		ebmlUint(mkvTimestamp, 60000),
+		ebmlElement(mkvBlockGroup, createMKVBlock(mkvBlock, 2, -1000, createPacketDisplaySet())),
+	)...)
+	return file
+}
+
+func TestOpenMKV(t *testing.T) {
+	file := createTestMKV(t)
+	if !IsMatroska(file) {
+		t.Error("Expected Matroska magic")
+	}
+	m, err := OpenMKV(bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if m.TimestampScale != 1000 || len(m.Tracks) != 3 {
+		t.Fatalf("Expected scale 1000 and 3 tracks, got %d and %d", m.TimestampScale, len(m.Tracks))
+	}
+	tracks := m.PGSTracks()
+	if len(tracks) != 2 {
+		t.Fatalf("Expected 2 PGS tracks, got %d", len(tracks))
+	}
+	forced := tracks[0]
+	if forced.Number != 2 || forced.Language != "ger" || forced.Name != "Forced" || !forced.Forced || forced.Default {
+		t.Errorf("Unexpected forced track %+v", forced)
+	}
+	if tracks[1].Language != "eng" || !tracks[1].Default || tracks[1].Forced {
+		t.Errorf("Expected default flags and language, got %+v", tracks[1])
+	}
+
+	pgs, err := m.ReadPGSTracks([]uint64{2, 3})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(pgs[2].Sections) != 2 || len(pgs[3].Sections) != 1 {
+		t.Fatalf("Expected 2 and 1 display sets, got %d and %d", len(pgs[2].Sections), len(pgs[3].Sections))
+	}
+	if pgs[2].Sections[0].PCS.PTS != 1 || pgs[2].Sections[1].PCS.PTS != 59 {
+		t.Errorf("Expected PTS 1 and 59, got %d and %d", pgs[2].Sections[0].PCS.PTS, pgs[2].Sections[1].PCS.PTS)
+	}
+	if pgs[3].Sections[0].END.Type != END {
+		t.Error("Expected compressed display set to end")
+	}
+}
+
+func TestOpenMKV_Invalid(t *testing.T) {
+	if _, err := OpenMKV(bytes.NewReader([]byte("PG\x00\x00"))); err == nil {
+		t.Error("Expected error for SUP file")
+	}
+	webm := ebmlElement(mkvEBML, ebmlElement(mkvDocType, []byte("avi")))
+	if _, err := OpenMKV(bytes.NewReader(webm)); err == nil {
+		t.Error("Expected error for unknown document type")
+	}
+
+	m, err := OpenMKV(bytes.NewReader(createTestMKV(t)))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if _, err := m.ReadPGS(1); err == nil {
+		t.Error("Expected error reading video track")
+	}
+}
+
+func TestMKVReadPGS_Truncated(t *testing.T) {
+	file := createTestMKV(t)
+	m, err := OpenMKV(bytes.NewReader(file[:len(file)-5]))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	pgs, err := m.ReadPGS(2)
+	if err != nil {
+		t.Fatalf("Expected truncated file to be read, got: %v", err)
+	}
+	if len(pgs.Sections) != 1 {
+		t.Errorf("Expected 1 display set before the truncated block, got %d", len(pgs.Sections))
+	}
+}
+
+func TestMKVReadPGS_SkipsOtherTracks(t *testing.T) {
+	// Blocks of tracks not read are neither unlaced nor decompressed
+	file := append(createTestMKV(t), ebmlElement(mkvCluster,
+		ebmlUint(mkvTimestamp, 90000),
+		ebmlElement(mkvSimpleBlock, []byte{0x81, 0, 0, 0x06}),
+		createMKVBlock(mkvSimpleBlock, 3, 0, []byte{1, 2, 3}),
+	)...)
+	m, err := OpenMKV(bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	pgs, err := m.ReadPGS(2)
+	if err != nil {
+		t.Fatalf("Expected invalid blocks of other tracks to be skipped, got: %v", err)
+	}
+	if len(pgs.Sections) != 2 {
+		t.Errorf("Expected 2 display sets, got %d", len(pgs.Sections))
+	}
+
+	m, _ = OpenMKV(bytes.NewReader(file))
+	if _, err := m.ReadPGS(3); err == nil || !strings.Contains(err.Error(), "track 3") {
+		t.Errorf("Expected decode error of the track read, got: %v", err)
+	}
+}
+
+func TestUnlace(t *testing.T) {
+	cases := []struct {
+		name   string
+		lacing byte
+		data   []byte
+	}{
+		{"xiph", 1, []byte{2, 1, 2, 'a', 'b', 'b', 'c', 'c', 'c'}},
+		{"ebml", 3, []byte{2, 0x81, 0xC0, 'a', 'b', 'b', 'c', 'c', 'c'}},
+	}
+	for _, c := range cases {
+		frames, err := unlace(c.data, c.lacing)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got: %v", c.name, err)
+		}
+		if len(frames) != 3 || string(frames[0]) != "a" || string(frames[1]) != "bb" || string(frames[2]) != "ccc" {
+			t.Errorf("%s: unexpected frames %q", c.name, frames)
+		}
+	}
+	frames, err := unlace([]byte{1, 'a', 'a', 'b', 'b'}, 2)
+	if err != nil || len(frames) != 2 || string(frames[1]) != "bb" {
+		t.Errorf("Expected fixed size frames, got %q, %v", frames, err)
+	}
+	if _, err := unlace([]byte{1, 'a', 'b', 'c'}, 2); err == nil {
+		t.Error("Expected error for uneven fixed size lacing")
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !cgo || notesseract
+
+package suptext
+
+// Tesseract is only available in cgo builds without the notesseract tag
+const TesseractSupported = false
+
+// OCRClient stands in for the Tesseract client, it can't be created
+type OCRClient struct{}
+
+func NewOCRClient(opts Options) (*OCRClient, error) {
+    return nil, ErrNoTesseract
+}
+
+func (c *OCRClient) Recognize(b *Bitmap) (OCRResult, error) {
+    return OCRResult{}, ErrNoTesseract
+}
+
+func (c *OCRClient) RecognizeWords(b *Bitmap) (OCRResult, []WordBox, error) {
+    return OCRResult{}, nil, ErrNoTesseract
+}
+
+func (c *OCRClient) Close() error {
+    return nil
+}
+
+func OCRFingerprint(opts Options) (string, error) {
+    return "", ErrNoTesseract
+}
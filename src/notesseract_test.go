@@ -0,0 +1,22 @@
+//go:build !cgo || notesseract
+
+package suptext
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewOCREngine_NoTesseract(t *testing.T) {
+	if TesseractSupported {
+		t.Fatal("Expected Tesseract to be unsupported")
+	}
+	for _, opts := range []Options{{}, {Engine: EngineTesseract}, {TrainGlyphs: true, GlyphDB: "glyphs.db"}} {
+		if _, err := NewOCREngine(opts); !errors.Is(err, ErrNoTesseract) {
+			t.Errorf("Expected ErrNoTesseract for %+v, got: %v", opts, err)
+		}
+	}
+	if _, err := EngineFingerprint(Options{}); !errors.Is(err, ErrNoTesseract) {
+		t.Errorf("Expected ErrNoTesseract fingerprint, got: %v", err)
+	}
+}
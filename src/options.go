@@ -0,0 +1,76 @@
+package suptext
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+)
+
+// Options controls how display sets are recognized and written
+type Options struct {
+    // Wrap lines whose fill color isn't the default white/yellow in font tags
+    KeepColors bool `json:"keep_colors"`
+    // Only output cues containing forced objects, e.g. for foreign language dialogue
+    ForcedOnly bool `json:"forced_only"`
+    // Tesseract languages joined by '+', e.g. "deu+eng". Defaults to eng
+    Languages string `json:"languages"`
+    // Directory containing the traineddata files, defaults to $TESSDATA_PREFIX or Tesseract's default
+    TessdataPrefix string `json:"tessdata"`
+    // Tesseract model variant: fast, best or legacy. Empty for the installed default
+    Model string `json:"model"`
+    // Tesseract page segmentation mode (1-13), 0 for Tesseract's default
+    PageSegMode int `json:"psm"`
+    // Characters Tesseract is restricted to, or never recognizes
+    Whitelist string `json:"whitelist"`
+    Blacklist string `json:"blacklist"`
+    // Tesseract user words (character names, show vocabulary) and user patterns files
+    UserWords string `json:"user_words"`
+    UserPatterns string `json:"user_patterns"`
+    // Arbitrary Tesseract variables, set when the engine initializes
+    Variables map[string]string `json:"variables"`
+    // Correct common OCR mistakes with the built-in English rules, or the rules file if set
+    Fix bool `json:"fix"`
+    Rules string `json:"rules"`
+    // Hunspell dictionary path (without .dic/.aff) used to correct unknown words
+    Dictionary string `json:"dictionary"`
+    // OCR engine: tesseract (default), glyph or command
+    Engine string `json:"engine"`
+    // Glyph database file of the glyph engine, or trained from Tesseract results if TrainGlyphs
+    GlyphDB string `json:"glyph_db"`
+    TrainGlyphs bool `json:"train_glyphs"`
+    // Executable and arguments of the command engine, split on whitespace
+    OCRCommand string `json:"ocr_command"`
+    // Output of the OCR command: text (default) or json
+    OCRCommandOutput string `json:"ocr_output"`
+    // Seconds before an OCR command is killed, 0 for DefaultCommandTimeout
+    OCRTimeout float64 `json:"ocr_timeout"`
+    // Seconds before the recognition of a cue is abandoned, its remaining objects count as OCR
+    // errors. 0 for no limit
+    CueTimeout float64 `json:"cue_timeout"`
+    // Maximum number of OCR commands running at once in the process, 0 for the number of CPUs.
+    // Command engines with the same limit share it.
+    OCRJobs int `json:"ocr_jobs"`
+    // Persistent OCR cache directory shared across files and runs, disabled if empty
+    CacheDir string `json:"cache_dir"`
+    // Least recently used cache entries are pruned after a run above this size in bytes, 0 for no limit
+    CacheMaxSize int64 `json:"cache_max_size"`
+    // Counts the cues recognized if not nil
+    Progress *ProgressTracker `json:"-"`
+}
+
+// LoadOptions reads Options from a JSON config file
+func LoadOptions(fname string) (Options, error) {
+    var opts Options
+    f, err := os.Open(fname)
+    if err != nil {
+        return opts, err
+    }
+    defer f.Close()
+
+    dec := json.NewDecoder(f)
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(&opts); err != nil {
+        return opts, fmt.Errorf("Invalid config file %s: %v", fname, err)
+    }
+    return opts, nil
+}
@@ -0,0 +1,35 @@
+package suptext
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOptions(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "suptext.json")
+	config := `{"languages": "deu+eng", "psm": 6, "whitelist": "abc", "variables": {"textord_heavy_nr": "1"}}`
+	if err := os.WriteFile(fname, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts, err := LoadOptions(fname)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if opts.Languages != "deu+eng" || opts.PageSegMode != 6 || opts.Whitelist != "abc" {
+		t.Errorf("Unexpected options %+v", opts)
+	}
+	if opts.Variables["textord_heavy_nr"] != "1" {
+		t.Errorf("Expected variable textord_heavy_nr, got %v", opts.Variables)
+	}
+}
+
+func TestLoadOptions_UnknownField(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "suptext.json")
+	if err := os.WriteFile(fname, []byte(`{"langs": "eng"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadOptions(fname); err == nil {
+		t.Error("Expected error for unknown config field")
+	}
+}
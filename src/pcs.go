@@ -10,6 +10,12 @@ const CompositionObjectSize = 8
 const CompositionObjectExtendedSize = 16
 const PresentationCompositionSize = 11
 
+// Composition object flags
+const (
+    CompositionCropped = 0x80 // Followed by the cropping rectangle
+    CompositionForced = 0x40  // Displayed even when subtitles are off
+)
+
 type PresentationCompositionData struct {
     Width uint16
     Height uint16
@@ -25,7 +31,9 @@ type PresentationCompositionData struct {
 type CompositionObject struct {
     ObjID uint16
     WinID uint8
-    Cropped uint8
+    Flags uint8
+    Cropped bool
+    Forced bool
     Hpos uint16
     Vpos uint16
     HCropPos uint16
@@ -71,10 +79,10 @@ func NewPresentationData(bytes []byte) (PresentationCompositionData, error) {
         }
         section.Comps = append(section.Comps, comp)
         // Advance to the beginning of next object
-        if 0 == comp.Cropped {
-            offset += CompositionObjectSize
-        } else {
+        if comp.Cropped {
             offset += CompositionObjectExtendedSize
+        } else {
+            offset += CompositionObjectSize
         }
     }
 
@@ -91,12 +99,14 @@ func NewCompositionObject(bytes []byte) (CompositionObject, error) {
     composition := CompositionObject{
         ObjID:      binary.BigEndian.Uint16(bytes[:2]),
         WinID:      uint8(bytes[2]),
-        Cropped:    uint8(bytes[3]),
+        Flags:      uint8(bytes[3]),
+        Cropped:    bytes[3] & CompositionCropped != 0,
+        Forced:     bytes[3] & CompositionForced != 0,
         Hpos:       binary.BigEndian.Uint16(bytes[4:6]),
         Vpos:       binary.BigEndian.Uint16(bytes[6:8]),
     }
     // Not cropped so no extension
-    if 0 == composition.Cropped {
+    if !composition.Cropped {
         return composition, nil
     }
     // Not enough bytes for extension
@@ -96,8 +96,8 @@ func TestNewCompositionObject_Valid(t *testing.T) {
 	if comp.ObjID != 0x1234 {
 		t.Errorf("Expected ObjID 0x1234, got 0x%04X", comp.ObjID)
 	}
-	if comp.Cropped != 0 {
-		t.Error("Expected Cropped to be 0")
+	if comp.Cropped || comp.Forced {
+		t.Error("Expected Cropped and Forced to be false")
 	}
 }
 
@@ -105,7 +105,7 @@ func TestNewCompositionObject_WithExtension(t *testing.T) {
 	bytes := make([]byte, 16)
 	binary.BigEndian.PutUint16(bytes[0:2], 0x1234) // ObjID
 	bytes[2] = 0x01                                  // WinID
-	bytes[3] = 0x01                                  // Cropped (yes)
+	bytes[3] = 0x80                                  // Cropped (yes)
 	binary.BigEndian.PutUint16(bytes[4:6], 100)     // Hpos
 	binary.BigEndian.PutUint16(bytes[6:8], 200)     // Vpos
 	binary.BigEndian.PutUint16(bytes[8:10], 10)     // HCropPos
@@ -117,8 +117,8 @@ func TestNewCompositionObject_WithExtension(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Expected no error, got: %v", err)
 	}
-	if comp.Cropped != 1 {
-		t.Error("Expected Cropped to be 1")
+	if !comp.Cropped {
+		t.Error("Expected Cropped to be true")
 	}
 	if comp.HCropPos != 10 {
 		t.Errorf("Expected HCropPos 10, got %d", comp.HCropPos)
@@ -128,6 +128,25 @@ func TestNewCompositionObject_WithExtension(t *testing.T) {
 	}
 }
 
+func TestNewCompositionObject_Forced(t *testing.T) {
+	bytes := make([]byte, 8)
+	binary.BigEndian.PutUint16(bytes[0:2], 0x1234)
+	bytes[3] = 0x40 // Forced, not cropped
+	binary.BigEndian.PutUint16(bytes[4:6], 100)
+	binary.BigEndian.PutUint16(bytes[6:8], 200)
+
+	comp, err := NewCompositionObject(bytes)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !comp.Forced || comp.Cropped {
+		t.Errorf("Expected forced and not cropped, got %+v", comp)
+	}
+	if comp.Flags != 0x40 {
+		t.Errorf("Expected flags 0x40, got 0x%02X", comp.Flags)
+	}
+}
+
 func TestNewCompositionObject_Truncated(t *testing.T) {
 	// Too short for basic object
 	bytes := make([]byte, 6)
@@ -142,7 +161,7 @@ func TestNewCompositionObject_TruncatedExtension(t *testing.T) {
 	bytes := make([]byte, 12)
 	binary.BigEndian.PutUint16(bytes[0:2], 0x1234)
 	bytes[2] = 0x01
-	bytes[3] = 0x01 // Cropped (yes)
+	bytes[3] = 0x80 // Cropped (yes)
 	binary.BigEndian.PutUint16(bytes[4:6], 100)
 	binary.BigEndian.PutUint16(bytes[6:8], 200)
 	// Extension incomplete (only 4 bytes instead of 8)
@@ -154,8 +173,8 @@ func TestNewCompositionObject_TruncatedExtension(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Should handle truncated extension gracefully, got error: %v", err)
 	}
-	if comp.Cropped != 1 {
-		t.Error("Expected Cropped to be 1")
+	if !comp.Cropped {
+		t.Error("Expected Cropped to be true")
 	}
 	// Extension fields should be zero
 	if comp.HCropPos != 0 {
@@ -199,3 +218,30 @@ func TestNewPresentationData_MultipleCompositionObjects(t *testing.T) {
 	}
 }
 
+func TestNewPresentationData_ForcedObjectNotCropped(t *testing.T) {
+	// A forced object has no cropping rectangle, the next object follows 8 bytes later
+	bytes := make([]byte, 11+8+16)
+	binary.BigEndian.PutUint16(bytes[0:2], 1920)
+	binary.BigEndian.PutUint16(bytes[2:4], 1080)
+	bytes[7] = 0x80
+	bytes[10] = 2
+	binary.BigEndian.PutUint16(bytes[11:13], 1)
+	bytes[14] = 0x40 // Forced
+	binary.BigEndian.PutUint16(bytes[19:21], 2)
+	bytes[22] = 0xC0 // Cropped and forced
+	binary.BigEndian.PutUint16(bytes[31:33], 300) // CropWidth
+
+	pcs, err := NewPresentationData(bytes)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(pcs.Comps) != 2 {
+		t.Fatalf("Expected 2 composition objects, got %d", len(pcs.Comps))
+	}
+	if pcs.Comps[1].ObjID != 2 || !pcs.Comps[1].Cropped || !pcs.Comps[1].Forced {
+		t.Errorf("Expected cropped forced object 2, got %+v", pcs.Comps[1])
+	}
+	if pcs.Comps[1].CropWidth != 300 {
+		t.Errorf("Expected CropWidth 300, got %d", pcs.Comps[1].CropWidth)
+	}
+}
@@ -1,11 +1,13 @@
 package suptext
 
 import (
+    "context"
     "fmt"
     "encoding/json"
+    "io"
     "log"
     "os"
-    "github.com/otiai10/gosseract/v2"
+    "time"
 )
 
 type PGS struct {
@@ -25,37 +27,210 @@ func (p *PGS) PrintDisplaySet(i uint) {
     p.Sections[i].Print()
 }
 
+// Size returns the bytes of object data, the subtitle images
+func (p *PGS) Size() int {
+    size := 0
+    for _, ds := range p.Sections {
+        for _, ods := range ds.ODS {
+            if data, ok := ods.Data.(ObjectData); ok {
+                size += len(data.Data)
+            }
+        }
+    }
+    return size
+}
+
 func (p *PGS) GetSectionEndTimestamp(startSection int) string {
+    return FormatMilliseconds(p.GetSectionEnd(startSection))
+}
+
+// GetSectionEnd returns the end time in milliseconds of the display set at startSection
+func (p *PGS) GetSectionEnd(startSection int) uint32 {
     currentPTS := p.Sections[startSection].PCS.PTS
 
     // Search for the next epoch start or end
     for i := startSection + 1; i < len(p.Sections); i++ {
         nextPCS := p.Sections[i].PCS.Data.(PresentationCompositionData)
         if p.Sections[i].IsEpochStart() || p.Sections[i].IsEpochEnd() || nextPCS.State != p.Sections[startSection].PCS.Data.(PresentationCompositionData).State {
-            return FormatMilliseconds(p.Sections[i].PCS.PTS)
+            return p.Sections[i].PCS.PTS
         }
     }
 
     // No future epoch/end found, fallback: last known PTS + safe buffer (e.g., 5s)
     safeEnd := currentPTS + 5000 // milliseconds
-    return FormatMilliseconds(safeEnd)
+    return safeEnd
 }
 
+// Cues recognizes the text of every epoch start display set, identical bitmaps are recognized once if cache isn't nil.
+// Only forced display sets are recognized if opts.ForcedOnly.
+func (p *PGS) Cues(engine OCREngine, opts Options, cache *OCRCache) []Cue {
+    cues, _ := p.CuesContext(context.Background(), NewContextEngine(engine), opts, cache)
+    return cues
+}
 
-func (p *PGS) ToSRT(fout *os.File) error {
-    client := gosseract.NewClient()
-    defer client.Close()
+// CuesContext is Cues returning the cues recognized so far and ctx.Err() once ctx is done.
+// Cues taking longer than opts.CueTimeout lose the text of their remaining objects, which count as OCR errors.
+func (p *PGS) CuesContext(ctx context.Context, engine ContextEngine, opts Options, cache *OCRCache) ([]Cue, error) {
+    recognized := func(ds DisplaySet) bool {
+        return ds.IsEpochStart() && (!opts.ForcedOnly || ds.IsForced())
+    }
+    total := 0
+    for _, ds := range p.Sections {
+        if recognized(ds) {
+            total++
+        }
+    }
+    opts.Progress.AddCues(total)
 
-    var srt_section_id uint
-    srt_section_id = 1
+    var cues []Cue
+    var index uint = 1
     for i, ds := range p.Sections {
-        if !ds.IsEpochStart() {
+        if !recognized(ds) {
+            continue
+        }
+        if err := ctx.Err(); err != nil {
+            return cues, err
+        }
+        cue_ctx, cancel := ctx, context.CancelFunc(func() {})
+        if opts.CueTimeout > 0 {
+            cue_ctx, cancel = context.WithTimeout(ctx, time.Duration(opts.CueTimeout * float64(time.Second)))
+        }
+        cue, err := ds.RecognizeContext(cue_ctx, engine, opts, cache)
+        timed_out := cue_ctx.Err() != nil
+        cancel()
+        if err := ctx.Err(); err != nil {
+            return cues, err
+        }
+        opts.Progress.Cue()
+        if err != nil {
+            log.Printf("Warning: Failed to recognize DisplaySet at PTS %d: %v", ds.PCS.PTS, err)
+            index++
             continue
         }
-        ets := p.GetSectionEndTimestamp(i)
-        ds.AppendSRT(client, fout, srt_section_id, ets)
-        srt_section_id++
+        if timed_out {
+            log.Printf("Warning: OCR of DisplaySet at PTS %d timed out after %gs", ds.PCS.PTS, opts.CueTimeout)
+        }
+        cue.Index = index
+        cue.Start = ds.PCS.PTS
+        cue.End = p.GetSectionEnd(i)
+        cue.Set = i
+        cues = append(cues, cue)
+        index++
+    }
+    return cues, nil
+}
+
+func (p *PGS) ToSRT(fout *os.File) error {
+    _, err := p.ToSRTContext(context.Background(), fout, Options{})
+    return err
+}
+
+func (p *PGS) ToSRTWithOptions(fout *os.File, opts Options) error {
+    _, err := p.ToSRTContext(context.Background(), fout, opts)
+    return err
+}
+
+// ToSRTContext recognizes the cues with a new OCR engine configured from opts and writes them as
+// SRT to w. Once ctx is done it writes the cues recognized so far and returns them with ctx.Err().
+func (p *PGS) ToSRTContext(ctx context.Context, w io.Writer, opts Options) ([]Cue, error) {
+    cues, _, err := p.OCRCuesContext(ctx, opts)
+    if err != nil && ctx.Err() == nil {
+        return nil, err
+    }
+    if err := WriteSRT(w, cues); err != nil {
+        return cues, err
+    }
+    return cues, ctx.Err()
+}
+
+// OCRCues recognizes all cues with a new OCR engine configured from opts,
+// then applies the selected correction rules and spell checking
+func (p *PGS) OCRCues(opts Options) ([]Cue, Summary, error) {
+    return p.OCRCuesContext(context.Background(), opts)
+}
+
+// OCRCuesContext is OCRCues returning the cues recognized so far, corrected, and ctx.Err() once
+// ctx is done
+func (p *PGS) OCRCuesContext(ctx context.Context, opts Options) ([]Cue, Summary, error) {
+    engine, err := NewOCREngine(opts)
+    if err != nil {
+        return nil, Summary{}, err
+    }
+    wrapped := NewContextEngine(engine)
+    defer func() {
+        if err := wrapped.Close(); err != nil {
+            log.Printf("Warning: Failed to close OCR engine: %v", err)
+        }
+    }()
+    return p.RecognizeCuesContext(ctx, wrapped, opts)
+}
+
+// RecognizeCues is OCRCues with an engine created from opts beforehand, e.g. one reused by
+// several files
+func (p *PGS) RecognizeCues(engine OCREngine, opts Options) ([]Cue, Summary, error) {
+    return p.RecognizeCuesContext(context.Background(), engine, opts)
+}
+
+// RecognizeCuesContext is OCRCuesContext with an engine created from opts beforehand. Engines
+// reused after cancelled recognitions must come from NewContextEngine, which waits for them.
+func (p *PGS) RecognizeCuesContext(ctx context.Context, engine OCREngine, opts Options) ([]Cue, Summary, error) {
+    var summary Summary
+    rules, err := CorrectionRules(opts)
+    if err != nil {
+        return nil, summary, err
+    }
+    var dict *Dictionary
+    if opts.Dictionary != "" {
+        if dict, err = LoadDictionary(opts.Dictionary); err != nil {
+            return nil, summary, fmt.Errorf("Failed to load dictionary: %v", err)
+        }
+    }
+    // Reused engines count the glyphs of every file
+    var unknown, learned int
+    switch e := unwrapEngine(engine).(type) {
+    case *GlyphEngine:
+        unknown = e.Unknown
+    case *GlyphTrainer:
+        learned = e.Learned
     }
 
-    return nil
+    cache := NewOCRCache()
+    // Training needs the word boxes of fresh Tesseract results
+    if opts.CacheDir != "" && !opts.TrainGlyphs {
+        fingerprint, err := EngineFingerprint(opts)
+        if err != nil {
+            return nil, summary, err
+        }
+        if cache.Disk, err = NewDiskCache(opts.CacheDir, fingerprint); err != nil {
+            return nil, summary, err
+        }
+    }
+    cues, err := p.CuesContext(ctx, NewContextEngine(engine), opts, cache)
+    summary.Cues, summary.Cancelled = len(cues), err != nil
+    for _, cue := range cues {
+        if cue.Forced {
+            summary.ForcedCues++
+        }
+        summary.OCRErrors += cue.Errors
+    }
+    summary.CacheHits, summary.CacheDiskHits, summary.CacheMisses = cache.Hits, cache.DiskHits, cache.Misses
+    switch e := unwrapEngine(engine).(type) {
+    case *GlyphEngine:
+        summary.UnknownGlyphs = e.Unknown - unknown
+    case *GlyphTrainer:
+        summary.LearnedGlyphs = e.Learned - learned
+    }
+    if cache.Disk != nil && opts.CacheMaxSize > 0 {
+        if _, err := cache.Disk.Prune(opts.CacheMaxSize); err != nil {
+            log.Printf("Warning: Failed to prune OCR cache: %v", err)
+        }
+    }
+    if rules != nil {
+        summary.CorrectedLines = rules.ApplyCues(cues)
+    }
+    if dict != nil {
+        report := dict.CorrectCues(cues)
+        summary.Spelling = &report
+    }
+    return cues, summary, err
 }
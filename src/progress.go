@@ -0,0 +1,114 @@
+package suptext
+
+import (
+    "fmt"
+    "sync"
+    "time"
+)
+
+// Progress stages
+const (
+    StageReading = "reading"
+    StageRecognizing = "recognizing"
+)
+
+// Progress is a snapshot of the work done by a conversion
+type Progress struct {
+    Stage string `json:"stage"`
+    Segments int `json:"segments"`
+    DisplaySets int `json:"display_sets"`
+    // Cues recognized out of those to recognize
+    Cues int `json:"cues"`
+    TotalCues int `json:"total_cues"`
+    Elapsed time.Duration `json:"elapsed"`
+    // Estimated time left recognizing cues, zero until the first cue is done
+    ETA time.Duration `json:"eta"`
+}
+
+func (p Progress) String() string {
+    elapsed := p.Elapsed.Round(time.Second)
+    if p.Stage != StageRecognizing {
+        return fmt.Sprintf("Read %d segments, %d display sets, %v elapsed", p.Segments, p.DisplaySets, elapsed)
+    }
+    out := fmt.Sprintf("Recognized %d/%d cues, %v elapsed", p.Cues, p.TotalCues, elapsed)
+    if p.ETA > 0 {
+        out += fmt.Sprintf(", %v left", p.ETA.Round(time.Second))
+    }
+    return out
+}
+
+// ProgressTracker counts the segments read and cues recognized by a conversion and reports every
+// change. Its methods are safe for concurrent use and do nothing on a nil tracker.
+type ProgressTracker struct {
+    mu sync.Mutex
+    report func(Progress)
+    start time.Time
+    ocr_start time.Time
+    p Progress
+}
+
+// NewProgressTracker returns a tracker calling report with each change, from the goroutine doing
+// the work, so report must be quick
+func NewProgressTracker(report func(Progress)) *ProgressTracker {
+    return &ProgressTracker{report: report, start: time.Now(), p: Progress{Stage: StageReading}}
+}
+
+// Progress returns the current snapshot
+func (t *ProgressTracker) Progress() Progress {
+    if t == nil {
+        return Progress{}
+    }
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    return t.snapshot()
+}
+
+// Segment counts a segment read
+func (t *ProgressTracker) Segment() {
+    t.update(func(p *Progress) { p.Segments++ })
+}
+
+// DisplaySet counts a display set decoded
+func (t *ProgressTracker) DisplaySet() {
+    t.update(func(p *Progress) { p.DisplaySets++ })
+}
+
+// AddCues starts recognizing n more cues, e.g. those of another track
+func (t *ProgressTracker) AddCues(n int) {
+    t.update(func(p *Progress) {
+        if p.Stage != StageRecognizing {
+            p.Stage = StageRecognizing
+            t.ocr_start = time.Now()
+        }
+        p.TotalCues += n
+    })
+}
+
+// Cue counts a cue recognized, or given up on
+func (t *ProgressTracker) Cue() {
+    t.update(func(p *Progress) { p.Cues++ })
+}
+
+func (t *ProgressTracker) update(change func(p *Progress)) {
+    if t == nil {
+        return
+    }
+    t.mu.Lock()
+    change(&t.p)
+    p := t.snapshot()
+    t.mu.Unlock()
+    if t.report != nil {
+        t.report(p)
+    }
+}
+
+// snapshot returns the progress with its times, t.mu must be held
+func (t *ProgressTracker) snapshot() Progress {
+    p := t.p
+    p.Elapsed = time.Since(t.start)
+    if p.Stage == StageRecognizing && p.Cues > 0 && p.Cues < p.TotalCues {
+        per_cue := time.Since(t.ocr_start) / time.Duration(p.Cues)
+        p.ETA = per_cue * time.Duration(p.TotalCues - p.Cues)
+    }
+    return p
+}
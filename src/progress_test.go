@@ -0,0 +1,67 @@
+package suptext
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressTracker(t *testing.T) {
+	var reports []Progress
+	progress := NewProgressTracker(func(p Progress) {
+		reports = append(reports, p)
+	})
+	pgs, err := ReadPGSProgress(context.Background(), bufio.NewReader(bytes.NewReader(createTestSUP(1000, 3000, 5000))), progress)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	p := progress.Progress()
+	if p.Stage != StageReading || p.Segments != 12 || p.DisplaySets != 3 {
+		t.Errorf("Expected 12 segments and 3 display sets read, got %+v", p)
+	}
+
+	opts := Options{Progress: progress}
+	cues, err := pgs.CuesContext(context.Background(), NewContextEngine(&fakeEngine{text: "Hello"}), opts, nil)
+	if err != nil || len(cues) != 3 {
+		t.Fatalf("Expected 3 cues, got %d: %v", len(cues), err)
+	}
+	p = progress.Progress()
+	if p.Stage != StageRecognizing || p.Cues != 3 || p.TotalCues != 3 || p.ETA != 0 {
+		t.Errorf("Expected 3 of 3 cues recognized, got %+v", p)
+	}
+	if len(reports) != 12+3+1+3 {
+		t.Errorf("Expected a report per change, got %d", len(reports))
+	}
+	if last := reports[len(reports)-2]; last.Cues != 2 || last.TotalCues != 3 {
+		t.Errorf("Expected 2 of 3 cues before the last report, got %+v", last)
+	}
+	if !strings.HasPrefix(p.String(), "Recognized 3/3 cues") {
+		t.Errorf("Unexpected progress line %q", p.String())
+	}
+
+	// Nil trackers count nothing
+	var none *ProgressTracker
+	none.Segment()
+	none.AddCues(1)
+	if none.Progress() != (Progress{}) {
+		t.Errorf("Expected empty progress of nil tracker")
+	}
+}
+
+func TestProgressETA(t *testing.T) {
+	progress := NewProgressTracker(nil)
+	progress.AddCues(4)
+	time.Sleep(20 * time.Millisecond)
+	progress.Cue()
+	p := progress.Progress()
+	// 3 cues left at 20ms or more each
+	if p.ETA < 60*time.Millisecond || p.ETA > 10*time.Second {
+		t.Errorf("Expected an ETA of 3 cues, got %v", p.ETA)
+	}
+	if !strings.Contains(p.String(), "1/4 cues") || !strings.Contains(p.String(), "left") {
+		t.Errorf("Unexpected progress line %q", p.String())
+	}
+}
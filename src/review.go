@@ -0,0 +1,96 @@
+package suptext
+
+import (
+    "fmt"
+    "image/png"
+    "io"
+    "os"
+    "path/filepath"
+)
+
+// Cues with any word recognized below this confidence are listed for review by default
+const DefaultReviewThreshold = 80.0
+
+// NeedsReview reports whether a word of the cue was recognized below threshold, or nothing was recognized
+func (c *Cue) NeedsReview(threshold float64) bool {
+    return c.Words == 0 || c.MinConfidence < threshold
+}
+
+// WriteReview lists the cues that need review along with their bitmap, saved as PNG into imageDir.
+// Returns the number of cues listed.
+func (p *PGS) WriteReview(w io.Writer, cues []Cue, threshold float64, imageDir string) (int, error) {
+    if err := os.MkdirAll(imageDir, 0755); err != nil {
+        return 0, fmt.Errorf("Failed to create review image directory: %v", err)
+    }
+
+    count := 0
+    for _, cue := range cues {
+        if !cue.NeedsReview(threshold) {
+            continue
+        }
+        img_path, err := p.saveCueImage(cue, imageDir)
+        if err != nil {
+            return count, err
+        }
+        entry := fmt.Sprintf("#%d %s --> %s confidence %.1f (min %.1f)\n%s\n%s\n\n",
+            cue.Index, FormatMilliseconds(cue.Start), FormatMilliseconds(cue.End),
+            cue.Confidence, cue.MinConfidence, img_path, cue.Text())
+        if _, err := io.WriteString(w, entry); err != nil {
+            return count, fmt.Errorf("Failed to write review: %v", err)
+        }
+        count++
+    }
+    return count, nil
+}
+
+func (p *PGS) saveCueImage(cue Cue, imageDir string) (string, error) {
+    return p.saveSetImage(cue.Set, cue.Index, imageDir)
+}
+
+// saveSetImage saves the composed bitmaps of a display set as <index>.png, returns an empty path
+// for display sets without decodable objects
+func (p *PGS) saveSetImage(set int, index uint, imageDir string) (string, error) {
+    // Nothing to save for display sets without decodable objects
+    bitmaps := p.Sections[set].Bitmaps()
+    if len(bitmaps) == 0 {
+        return "", nil
+    }
+    img, err := ComposeImage(bitmaps)
+    if err != nil {
+        return "", err
+    }
+    img_path := filepath.Join(imageDir, fmt.Sprintf("%04d.png", index))
+    f, err := os.Create(img_path)
+    if err != nil {
+        return "", fmt.Errorf("Failed to create image: %v", err)
+    }
+    defer f.Close()
+    if err := png.Encode(f, img); err != nil {
+        return "", fmt.Errorf("Failed to write image: %v", err)
+    }
+    return img_path, nil
+}
+
+// ExportImages saves the subtitle of every epoch start display set as a PNG into imageDir, numbered
+// like the cues. Only forced display sets are saved if forcedOnly. Returns the number of images saved.
+func (p *PGS) ExportImages(imageDir string, forcedOnly bool) (int, error) {
+    if err := os.MkdirAll(imageDir, 0755); err != nil {
+        return 0, fmt.Errorf("Failed to create image directory: %v", err)
+    }
+    count := 0
+    var index uint = 1
+    for i, ds := range p.Sections {
+        if !ds.IsEpochStart() || (forcedOnly && !ds.IsForced()) {
+            continue
+        }
+        img_path, err := p.saveSetImage(i, index, imageDir)
+        if err != nil {
+            return count, err
+        }
+        if img_path != "" {
+            count++
+        }
+        index++
+    }
+    return count, nil
+}
@@ -0,0 +1,91 @@
+package suptext
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Helper function to create a display set with a single 2x2 object
+func createTestDisplaySet(pts uint32) DisplaySet {
+	var palettes [256]PaletteDefinition
+	palettes[1] = PaletteDefinition{Y: 235, Cr: 128, Cb: 128, A: 255}
+	return DisplaySet{
+		PCS: Section{PTS: pts, Type: PCS, Data: PresentationCompositionData{
+			Width: 1920, Height: 1080, State: 0x80, NumComps: 1,
+			Comps: []CompositionObject{{ObjID: 1, Hpos: 10, Vpos: 20}},
+		}},
+		PDS: Section{PTS: pts, Type: PDS, Data: PaletteData{Palettes: palettes}},
+		ODS: []Section{{PTS: pts, Type: ODS, Data: ObjectData{
+			ID: 1, Width: 2, Height: 2, Ended: true,
+			Data: []byte{0x01, 0x01, 0x00, 0x00, 0x01, 0x01, 0x00, 0x00},
+		}}},
+	}
+}
+
+func TestCueNeedsReview(t *testing.T) {
+	cue := Cue{Words: 3, Confidence: 90, MinConfidence: 85}
+	if cue.NeedsReview(80) {
+		t.Error("Expected confident cue not to need review")
+	}
+	cue.MinConfidence = 40
+	if !cue.NeedsReview(80) {
+		t.Error("Expected cue with a low confidence word to need review")
+	}
+	empty := Cue{}
+	if !empty.NeedsReview(80) {
+		t.Error("Expected cue without words to need review")
+	}
+}
+
+func TestWriteReview(t *testing.T) {
+	pgs := PGS{Sections: []DisplaySet{createTestDisplaySet(1000), createTestDisplaySet(5000)}}
+	cues := []Cue{
+		{Index: 1, Start: 1000, End: 2000, Set: 0, Words: 1, Confidence: 95, MinConfidence: 95, Lines: []CueLine{{Text: "Fine"}}},
+		{Index: 2, Start: 5000, End: 6000, Set: 1, Words: 1, Confidence: 30, MinConfidence: 30, Lines: []CueLine{{Text: "Hrnm"}}},
+	}
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	count, err := pgs.WriteReview(&buf, cues, DefaultReviewThreshold, dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 cue listed, got %d", count)
+	}
+	out := buf.String()
+	if strings.Contains(out, "Fine") {
+		t.Error("Expected confident cue to be omitted")
+	}
+	img_path := filepath.Join(dir, "0002.png")
+	if !strings.Contains(out, "#2 00:00:05,000 --> 00:00:06,000") || !strings.Contains(out, img_path) || !strings.Contains(out, "Hrnm") {
+		t.Errorf("Unexpected review entry: %q", out)
+	}
+	if _, err := os.Stat(img_path); err != nil {
+		t.Errorf("Expected review image to be saved: %v", err)
+	}
+}
+
+func TestExportImages(t *testing.T) {
+	forced := createTestDisplaySet(5000)
+	pcs := forced.PCS.Data.(PresentationCompositionData)
+	pcs.Comps = []CompositionObject{{ObjID: 1, Forced: true}}
+	forced.PCS.Data = pcs
+	pgs := PGS{Sections: []DisplaySet{createTestDisplaySet(1000), forced}}
+
+	dir := filepath.Join(t.TempDir(), "images")
+	count, err := pgs.ExportImages(dir, false)
+	if err != nil || count != 2 {
+		t.Fatalf("Expected 2 images, got %d: %v", count, err)
+	}
+	dir = filepath.Join(t.TempDir(), "forced")
+	if count, err = pgs.ExportImages(dir, true); err != nil || count != 1 {
+		t.Fatalf("Expected 1 forced image, got %d: %v", count, err)
+	}
+	// Images are numbered like the cues of --forced-only output
+	if _, err := os.Stat(filepath.Join(dir, "0001.png")); err != nil {
+		t.Errorf("Expected forced image 0001.png: %v", err)
+	}
+}
@@ -5,8 +5,8 @@ import (
     "fmt"
     "image"
 	"image/color"
+	"image/draw"
 	"image/jpeg"
-	"github.com/otiai10/gosseract/v2"
 )
 
 func CreateImage(pixels [][]uint8, palettes [256]PaletteDefinition) (*image.RGBA, error) {
@@ -41,6 +41,30 @@ func CreateImage(pixels [][]uint8, palettes [256]PaletteDefinition) (*image.RGBA
 	return img, nil
 }
 
+// ComposeImage draws the bitmaps at their screen positions, cropped to the area they cover
+func ComposeImage(bitmaps []Bitmap) (*image.RGBA, error) {
+    if len(bitmaps) == 0 {
+        return nil, fmt.Errorf("Failed composing image: no bitmaps")
+    }
+
+    var rect image.Rectangle
+    for i, b := range bitmaps {
+        r := b.Image.Bounds().Add(image.Pt(b.X, b.Y))
+        if i == 0 {
+            rect = r
+        } else {
+            rect = rect.Union(r)
+        }
+    }
+
+    img := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+    for _, b := range bitmaps {
+        dst := b.Image.Bounds().Add(image.Pt(b.X, b.Y).Sub(rect.Min))
+        draw.Draw(img, dst, b.Image, image.Point{}, draw.Over)
+    }
+    return img, nil
+}
+
 func GetImageBytesJPEG(img *image.RGBA) ([]byte, error) {
     var b bytes.Buffer
 	err := jpeg.Encode(&b, img, &jpeg.Options{Quality: 100})
@@ -50,9 +74,12 @@ func GetImageBytesJPEG(img *image.RGBA) ([]byte, error) {
 	return b.Bytes(), err
 }
 
-func RunOCR(ocr *gosseract.Client, img []byte) (string, error) {
-    ocr.SetImageFromBytes(img)
-    return ocr.Text()
+// OCRResult is the recognized text of an image and its word confidences (0-100)
+type OCRResult struct {
+    Text string
+    Words int
+    Confidence float64
+    MinConfidence float64
 }
 
 func RLEDecode(bytes []byte) ([][]uint8, error) {
@@ -188,3 +188,33 @@ func TestRLEDecode_Complex(t *testing.T) {
 	}
 }
 
+
+func TestComposeImage(t *testing.T) {
+	var palettes [256]PaletteDefinition
+	palettes[1] = PaletteDefinition{Y: 235, Cr: 128, Cb: 128, A: 255}
+	top, _ := CreateImage([][]uint8{{1, 1, 1, 1}}, palettes)
+	bottom, _ := CreateImage([][]uint8{{1, 1}, {1, 1}}, palettes)
+	bitmaps := []Bitmap{
+		{X: 100, Y: 900, Image: top},
+		{X: 102, Y: 910, Image: bottom},
+	}
+	img, err := ComposeImage(bitmaps)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if img.Bounds().Dx() != 4 || img.Bounds().Dy() != 12 {
+		t.Errorf("Expected 4x12 image, got %dx%d", img.Bounds().Dx(), img.Bounds().Dy())
+	}
+	if _, _, _, a := img.At(3, 11).RGBA(); a == 0 {
+		t.Error("Expected bottom bitmap drawn at its offset")
+	}
+	if _, _, _, a := img.At(0, 11).RGBA(); a != 0 {
+		t.Error("Expected transparent pixel outside bitmaps")
+	}
+}
+
+func TestComposeImage_Empty(t *testing.T) {
+	if _, err := ComposeImage(nil); err == nil {
+		t.Error("Expected error for no bitmaps")
+	}
+}
@@ -0,0 +1,614 @@
+package suptext
+
+import (
+    "bufio"
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "mime"
+    "net/http"
+    "net/url"
+    "path/filepath"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Server job states
+const (
+    JobQueued = "queued"
+    JobRunning = "running"
+    JobDone = "done"
+    JobFailed = "failed"
+    JobCancelled = "cancelled"
+)
+
+// Server limits used when unset
+const (
+    DefaultMaxUploadSize = 256 << 20
+    DefaultMaxQueued = 64
+    DefaultJobTTL = time.Hour
+    // OCR engines a worker keeps for other languages
+    DefaultMaxEngines = 4
+)
+
+// languageCode matches a traineddata name like chi_sim
+var languageCode = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// Content types of the output formats
+var formatTypes = map[string]string{
+    FormatSRT: "application/x-subrip; charset=utf-8",
+    FormatVTT: "text/vtt; charset=utf-8",
+    FormatASS: "text/x-ssa; charset=utf-8",
+}
+
+// Job is the conversion of an uploaded SUP file
+type Job struct {
+    ID string `json:"id"`
+    // File name of the upload, if given
+    Name string `json:"name,omitempty"`
+    Status string `json:"status"`
+    Languages string `json:"languages"`
+    DisplaySets int `json:"display_sets"`
+    Cues int `json:"cues"`
+    OCRErrors int `json:"ocr_errors"`
+    Warnings []string `json:"warnings,omitempty"`
+    Error string `json:"error,omitempty"`
+    Created time.Time `json:"created"`
+    Started *time.Time `json:"started,omitempty"`
+    Finished *time.Time `json:"finished,omitempty"`
+    pgs *PGS
+    opts Options
+    cues []Cue
+    cancel context.CancelFunc
+}
+
+// Server converts SUP files uploaded over HTTP on a pool of workers, each reusing its OCR engines.
+//
+//   POST   /jobs             Upload a SUP file as the request body or the "file" field of a form.
+//                            The lang, forced_only, colors and fix query parameters override Opts
+//   GET    /jobs             List the jobs
+//   GET    /jobs/<id>        Job status
+//   GET    /jobs/<id>/result Subtitles of a done or cancelled job, in the format query parameter (default srt)
+//   DELETE /jobs/<id>        Cancel a queued or running job, or forget a finished one.
+//                            Jobs cancelled while running keep the results recognized so far
+type Server struct {
+    // Options of every job
+    Opts Options
+    // Jobs recognized at once, 1 if unset
+    Workers int
+    // Largest accepted upload in bytes
+    MaxUploadSize int64
+    // Jobs waiting for a worker before uploads are refused
+    MaxQueued int
+    // Finished jobs are forgotten after this long
+    JobTTL time.Duration
+    // Running jobs are cancelled after this long, keeping their partial results. No limit if unset
+    JobTimeout time.Duration
+    // Languages the lang parameter may ask for besides Opts.Languages, any installed one if empty
+    Languages []string
+    // OCR engines kept by each worker, the least recently used one is closed above
+    MaxEngines int
+    // Creates the OCR engines of the workers, NewOCREngine if nil
+    NewEngine func(opts Options) (OCREngine, error)
+
+    start sync.Once
+    mu sync.Mutex
+    jobs map[string]*Job
+    // Jobs waiting for a worker in order, cancelled ones are taken out at once
+    queue []*Job
+    queued *sync.Cond
+    wg sync.WaitGroup
+    closed bool
+}
+
+// init starts the workers
+func (s *Server) init() {
+    if s.Workers <= 0 {
+        s.Workers = 1
+    }
+    if s.MaxUploadSize <= 0 {
+        s.MaxUploadSize = DefaultMaxUploadSize
+    }
+    if s.MaxQueued <= 0 {
+        s.MaxQueued = DefaultMaxQueued
+    }
+    if s.JobTTL <= 0 {
+        s.JobTTL = DefaultJobTTL
+    }
+    if s.MaxEngines <= 0 {
+        s.MaxEngines = DefaultMaxEngines
+    }
+    if s.NewEngine == nil {
+        s.NewEngine = NewOCREngine
+    }
+    s.jobs = map[string]*Job{}
+    s.queued = sync.NewCond(&s.mu)
+    for i := 0; i < s.Workers; i++ {
+        s.wg.Add(1)
+        go s.work()
+    }
+}
+
+// Close refuses new jobs, cancels the queued ones and waits for the running ones
+func (s *Server) Close() {
+    s.start.Do(s.init)
+    s.mu.Lock()
+    if s.closed {
+        s.mu.Unlock()
+        return
+    }
+    s.closed = true
+    now := time.Now()
+    for _, job := range s.queue {
+        job.Status, job.Finished, job.pgs = JobCancelled, &now, nil
+    }
+    s.queue = nil
+    s.queued.Broadcast()
+    s.mu.Unlock()
+    s.wg.Wait()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    s.start.Do(s.init)
+    parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+    switch {
+    case len(parts) == 1 && parts[0] == "jobs":
+        switch r.Method {
+        case http.MethodGet:
+            s.list(w)
+        case http.MethodPost:
+            s.submit(w, r)
+        default:
+            methodNotAllowed(w, "GET, POST")
+        }
+    case len(parts) == 2 && parts[0] == "jobs":
+        switch r.Method {
+        case http.MethodGet:
+            s.status(w, parts[1])
+        case http.MethodDelete:
+            s.cancel(w, parts[1])
+        default:
+            methodNotAllowed(w, "GET, DELETE")
+        }
+    case len(parts) == 3 && parts[0] == "jobs" && parts[2] == "result":
+        if r.Method != http.MethodGet {
+            methodNotAllowed(w, "GET")
+            return
+        }
+        s.result(w, parts[1], r.URL.Query().Get("format"))
+    default:
+        writeError(w, http.StatusNotFound, "Not found: %s", r.URL.Path)
+    }
+}
+
+// submit reads the uploaded SUP file and queues its job
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) {
+    opts, err := s.jobOptions(r.URL.Query())
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "%v", err)
+        return
+    }
+    body := &errorReader{r: http.MaxBytesReader(w, r.Body, s.MaxUploadSize)}
+    r.Body = body
+    job := &Job{Name: r.URL.Query().Get("name"), Status: JobQueued, Languages: opts.Languages, opts: opts}
+
+    // Forms are read as a stream too, up to the file field
+    var src io.Reader = body
+    if media, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); media == "multipart/form-data" {
+        mr, err := r.MultipartReader()
+        if err != nil {
+            writeError(w, http.StatusBadRequest, "Invalid form: %v", err)
+            return
+        }
+        for {
+            part, err := mr.NextPart()
+            if err != nil {
+                if body.tooLarge() {
+                    writeError(w, http.StatusRequestEntityTooLarge, "Upload larger than %d bytes", s.MaxUploadSize)
+                } else {
+                    writeError(w, http.StatusBadRequest, "Missing file field: %v", err)
+                }
+                return
+            }
+            if part.FormName() == "file" {
+                if job.Name == "" {
+                    job.Name = part.FileName()
+                }
+                src = part
+                break
+            }
+        }
+    }
+    pgs, err := ReadPGSContext(r.Context(), bufio.NewReader(src))
+    if body.tooLarge() {
+        writeError(w, http.StatusRequestEntityTooLarge, "Upload larger than %d bytes", s.MaxUploadSize)
+        return
+    }
+    if err != nil {
+        writeError(w, http.StatusBadRequest, "Invalid SUP file: %v", err)
+        return
+    }
+    if len(pgs.Sections) == 0 {
+        writeError(w, http.StatusBadRequest, "No display sets in the upload")
+        return
+    }
+    job.pgs, job.DisplaySets = &pgs, len(pgs.Sections)
+    for _, p := range pgs.Validate() {
+        job.Warnings = append(job.Warnings, p.String())
+    }
+    if job.ID, err = newJobID(); err != nil {
+        writeError(w, http.StatusInternalServerError, "%v", err)
+        return
+    }
+
+    s.mu.Lock()
+    if s.closed {
+        s.mu.Unlock()
+        writeError(w, http.StatusServiceUnavailable, "Server is shutting down")
+        return
+    }
+    job.Created = time.Now()
+    s.expire(job.Created)
+    if len(s.queue) >= s.MaxQueued {
+        s.mu.Unlock()
+        writeError(w, http.StatusServiceUnavailable, "Job queue is full")
+        return
+    }
+    s.queue = append(s.queue, job)
+    s.jobs[job.ID] = job
+    s.queued.Signal()
+    status := *job
+    s.mu.Unlock()
+    log.Printf("Queued job %s: %s, %d display sets", job.ID, job.Name, job.DisplaySets)
+    w.Header().Set("Location", "/jobs/" + job.ID)
+    writeJSON(w, http.StatusAccepted, status)
+}
+
+// jobOptions returns the server options overridden by the query parameters of an upload
+func (s *Server) jobOptions(q url.Values) (Options, error) {
+    opts := s.Opts
+    if opts.Languages == "" {
+        opts.Languages = DefaultLanguages
+    }
+    if lang := q.Get("lang"); lang != "" && lang != opts.Languages {
+        if err := s.validateLanguages(lang); err != nil {
+            return opts, err
+        }
+        opts.Languages = lang
+    }
+    for name, value := range map[string]*bool{"forced_only": &opts.ForcedOnly, "colors": &opts.KeepColors, "fix": &opts.Fix} {
+        if q.Get(name) == "" {
+            continue
+        }
+        b, err := strconv.ParseBool(q.Get(name))
+        if err != nil {
+            return opts, fmt.Errorf("Invalid %s parameter '%s'", name, q.Get(name))
+        }
+        *value = b
+    }
+    return opts, nil
+}
+
+// validateLanguages checks that the languages of a lang parameter are allowed, or installed
+func (s *Server) validateLanguages(lang string) error {
+    langs := strings.Split(lang, "+")
+    for _, l := range langs {
+        if !languageCode.MatchString(l) {
+            return fmt.Errorf("Invalid lang parameter '%s'", lang)
+        }
+    }
+    if len(s.Languages) > 0 {
+        for _, l := range langs {
+            if !containsString(s.Languages, l) {
+                return fmt.Errorf("Language '%s' isn't available (expected %s)", l, strings.Join(s.Languages, ", "))
+            }
+        }
+        return nil
+    }
+    if s.Opts.Engine != "" && s.Opts.Engine != EngineTesseract {
+        return nil
+    }
+    tessdata, err := TessdataDir(s.Opts)
+    if err != nil {
+        return err
+    }
+    if tessdata == "" {
+        return fmt.Errorf("Language '%s' isn't available without a tessdata directory or a list of languages", lang)
+    }
+    return ValidateLanguages(tessdata, langs)
+}
+
+func containsString(list []string, v string) bool {
+    for _, s := range list {
+        if s == v {
+            return true
+        }
+    }
+    return false
+}
+
+// expire forgets the jobs finished longer than JobTTL ago, s.mu must be held
+func (s *Server) expire(now time.Time) {
+    for id, job := range s.jobs {
+        if job.Finished != nil && now.Sub(*job.Finished) > s.JobTTL {
+            delete(s.jobs, id)
+        }
+    }
+}
+
+func (s *Server) list(w http.ResponseWriter) {
+    s.mu.Lock()
+    jobs := make([]Job, 0, len(s.jobs))
+    for _, job := range s.jobs {
+        jobs = append(jobs, *job)
+    }
+    s.mu.Unlock()
+    sort.Slice(jobs, func(i, j int) bool {
+        return jobs[i].Created.Before(jobs[j].Created)
+    })
+    writeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *Server) status(w http.ResponseWriter, id string) {
+    s.mu.Lock()
+    job, ok := s.jobs[id]
+    var status Job
+    if ok {
+        status = *job
+    }
+    s.mu.Unlock()
+    if !ok {
+        writeError(w, http.StatusNotFound, "Unknown job %s", id)
+        return
+    }
+    writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) cancel(w http.ResponseWriter, id string) {
+    s.mu.Lock()
+    job, ok := s.jobs[id]
+    if !ok {
+        s.mu.Unlock()
+        writeError(w, http.StatusNotFound, "Unknown job %s", id)
+        return
+    }
+    switch job.Status {
+    case JobQueued:
+        now := time.Now()
+        job.Status, job.Finished, job.pgs = JobCancelled, &now, nil
+        // Frees its place in the queue at once, workers may all be busy
+        for i, queued := range s.queue {
+            if queued == job {
+                s.queue = append(s.queue[:i], s.queue[i + 1:]...)
+                break
+            }
+        }
+        log.Printf("Cancelled job %s", id)
+    case JobRunning:
+        // The worker keeps the cues recognized so far
+        job.Status = JobCancelled
+        job.cancel()
+        log.Printf("Cancelled job %s", id)
+    default:
+        delete(s.jobs, id)
+    }
+    status := *job
+    s.mu.Unlock()
+    writeJSON(w, http.StatusOK, status)
+}
+
+func (s *Server) result(w http.ResponseWriter, id string, format string) {
+    if format == "" {
+        format = FormatSRT
+    }
+    if err := ValidateFormat(format); err != nil {
+        writeError(w, http.StatusBadRequest, "%v", err)
+        return
+    }
+    s.mu.Lock()
+    job, ok := s.jobs[id]
+    var status Job
+    if ok {
+        status = *job
+    }
+    s.mu.Unlock()
+    if !ok {
+        writeError(w, http.StatusNotFound, "Unknown job %s", id)
+        return
+    }
+    // Jobs cancelled while running have partial results
+    partial := status.Status == JobCancelled && status.Started != nil && status.Finished != nil
+    if status.Status != JobDone && !partial {
+        writeError(w, http.StatusConflict, "Job %s is %s", id, status.Status)
+        return
+    }
+    name := id
+    if status.Name != "" {
+        name = strings.TrimSuffix(filepath.Base(status.Name), filepath.Ext(status.Name))
+    }
+    w.Header().Set("Content-Type", formatTypes[format])
+    w.Header().Set("Suptext-Job-Status", status.Status)
+    w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + format}))
+    if err := WriteCues(w, status.cues, format); err != nil {
+        log.Printf("Warning: Failed to send result of job %s: %v", id, err)
+    }
+}
+
+// work recognizes queued jobs until the server is closed, with an OCR engine per language
+func (s *Server) work() {
+    defer s.wg.Done()
+    engines := &workerEngines{max: s.MaxEngines, engines: map[string]ContextEngine{}}
+    defer engines.close()
+    for {
+        s.mu.Lock()
+        for len(s.queue) == 0 && !s.closed {
+            s.queued.Wait()
+        }
+        if s.closed {
+            s.mu.Unlock()
+            return
+        }
+        job := s.queue[0]
+        s.queue = s.queue[1:]
+        now := time.Now()
+        ctx, cancel := context.WithCancel(context.Background())
+        if s.JobTimeout > 0 {
+            ctx, cancel = context.WithTimeout(context.Background(), s.JobTimeout)
+        }
+        job.Status, job.Started, job.cancel = JobRunning, &now, cancel
+        pgs, opts := job.pgs, job.opts
+        s.mu.Unlock()
+
+        cues, summary, err := s.recognize(ctx, engines, pgs, opts)
+        timed_out := errors.Is(ctx.Err(), context.DeadlineExceeded)
+        cancel()
+        s.mu.Lock()
+        finished := time.Now()
+        job.pgs, job.Finished = nil, &finished
+        switch {
+        case summary.Cancelled || job.Status == JobCancelled:
+            // Partial results of jobs cancelled or timed out
+            job.Status, job.cues, job.Cues, job.OCRErrors = JobCancelled, cues, len(cues), summary.OCRErrors
+            if timed_out {
+                job.Error = fmt.Sprintf("Timed out after %v", s.JobTimeout)
+            }
+        case err != nil:
+            job.Status, job.Error = JobFailed, err.Error()
+        default:
+            job.Status, job.cues, job.Cues, job.OCRErrors = JobDone, cues, len(cues), summary.OCRErrors
+            if summary.OCRErrors > 0 {
+                job.Warnings = append(job.Warnings, fmt.Sprintf("%d objects failed to recognize", summary.OCRErrors))
+            }
+        }
+        status := job.Status
+        s.mu.Unlock()
+        if status == JobFailed {
+            log.Printf("Job %s failed: %v", job.ID, err)
+        } else {
+            log.Printf("Job %s %s: %s", job.ID, status, summary.String())
+        }
+    }
+}
+
+// recognize recognizes the cues of a job, creating the engine of its languages unless kept
+func (s *Server) recognize(ctx context.Context, engines *workerEngines, pgs *PGS, opts Options) ([]Cue, Summary, error) {
+    engine, ok := engines.get(opts.Languages)
+    if !ok {
+        e, err := s.NewEngine(opts)
+        if err != nil {
+            return nil, Summary{}, fmt.Errorf("Failed to initialize OCR: %v", err)
+        }
+        // Later jobs wait for the recognitions of cancelled ones
+        engine = NewContextEngine(e)
+        engines.add(opts.Languages, engine)
+    }
+    return pgs.RecognizeCuesContext(ctx, engine, opts)
+}
+
+// workerEngines are the OCR engines of a worker by languages, closing the least recently used
+// one above max
+type workerEngines struct {
+    max int
+    engines map[string]ContextEngine
+    // Languages from least to most recently used
+    used []string
+}
+
+func (w *workerEngines) get(lang string) (ContextEngine, bool) {
+    engine, ok := w.engines[lang]
+    if ok {
+        w.touch(lang)
+    }
+    return engine, ok
+}
+
+func (w *workerEngines) add(lang string, engine ContextEngine) {
+    w.engines[lang] = engine
+    w.touch(lang)
+    for len(w.used) > w.max {
+        oldest := w.used[0]
+        w.used = w.used[1:]
+        if err := w.engines[oldest].Close(); err != nil {
+            log.Printf("Warning: Failed to close OCR engine: %v", err)
+        }
+        delete(w.engines, oldest)
+    }
+}
+
+// touch marks lang as the most recently used
+func (w *workerEngines) touch(lang string) {
+    for i, l := range w.used {
+        if l == lang {
+            w.used = append(w.used[:i], w.used[i + 1:]...)
+            break
+        }
+    }
+    w.used = append(w.used, lang)
+}
+
+func (w *workerEngines) close() {
+    for _, engine := range w.engines {
+        if err := engine.Close(); err != nil {
+            log.Printf("Warning: Failed to close OCR engine: %v", err)
+        }
+    }
+}
+
+// errorReader remembers the first read error besides EOF, to tell uploads above the size limit apart
+type errorReader struct {
+    r io.ReadCloser
+    err error
+}
+
+func (e *errorReader) Read(p []byte) (int, error) {
+    n, err := e.r.Read(p)
+    if err != nil && err != io.EOF && e.err == nil {
+        e.err = err
+    }
+    return n, err
+}
+
+func (e *errorReader) Close() error {
+    return e.r.Close()
+}
+
+func (e *errorReader) tooLarge() bool {
+    var max *http.MaxBytesError
+    return errors.As(e.err, &max)
+}
+
+func newJobID() (string, error) {
+    id := make([]byte, 8)
+    if _, err := rand.Read(id); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(id), nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(code)
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", JSONIndent)
+    if err := enc.Encode(v); err != nil {
+        log.Printf("Warning: Failed to send response: %v", err)
+    }
+}
+
+func writeError(w http.ResponseWriter, code int, format string, args ...interface{}) {
+    writeJSON(w, code, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed string) {
+    w.Header().Set("Allow", allowed)
+    writeError(w, http.StatusMethodNotAllowed, "Method not allowed, expected %s", allowed)
+}
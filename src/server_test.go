@@ -0,0 +1,307 @@
+package suptext
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Helper function to create a SUP file with a 2x2 subtitle at each PTS
+func createTestSUP(pts ...uint32) []byte {
+	var buf bytes.Buffer
+	for _, ts := range pts {
+		pcs := make([]byte, 19)
+		binary.BigEndian.PutUint16(pcs[0:2], 1920)
+		binary.BigEndian.PutUint16(pcs[2:4], 1080)
+		pcs[4] = 0x10
+		pcs[7] = 0x80
+		pcs[10] = 1
+		binary.BigEndian.PutUint16(pcs[11:13], 1)
+		binary.BigEndian.PutUint16(pcs[15:17], 10)
+		binary.BigEndian.PutUint16(pcs[17:19], 20)
+		pds := []byte{0, 0, 1, 235, 128, 128, 255}
+		rle := []byte{0x01, 0x01, 0x00, 0x00, 0x01, 0x01, 0x00, 0x00}
+		ods := []byte{0, 1, 0, 0xC0, 0, 0, byte(len(rle) + 4), 0, 2, 0, 2}
+		ods = append(ods, rle...)
+		for _, seg := range []struct {
+			typ  uint8
+			data []byte
+		}{{PCS, pcs}, {PDS, pds}, {ODS, ods}, {END, nil}} {
+			buf.Write(createSectionHeader(ts, ts, seg.typ, uint16(len(seg.data))))
+			buf.Write(seg.data)
+		}
+	}
+	return buf.Bytes()
+}
+
+// blockingEngine recognizes bitmaps once released
+type blockingEngine struct {
+	release chan struct{}
+}
+
+func (e *blockingEngine) Recognize(b *Bitmap) (OCRResult, error) {
+	<-e.release
+	return OCRResult{Text: "Later", Words: 1, Confidence: 90, MinConfidence: 90}, nil
+}
+
+func (e *blockingEngine) Close() error {
+	return nil
+}
+
+func decodeJob(t *testing.T, resp *http.Response) Job {
+	t.Helper()
+	defer resp.Body.Close()
+	var job Job
+	if err := json.NewDecoder(resp.Body).Decode(&job); err != nil {
+		t.Fatalf("Expected a job, got: %v", err)
+	}
+	return job
+}
+
+func waitJob(t *testing.T, url string, id string, status string) Job {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		resp, err := http.Get(url + "/jobs/" + id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		job := decodeJob(t, resp)
+		if job.Status == status {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Expected job %s to be %s", id, status)
+	return Job{}
+}
+
+func TestServer(t *testing.T) {
+	engines := 0
+	s := &Server{Workers: 1, NewEngine: func(opts Options) (OCREngine, error) {
+		engines++
+		return &fakeEngine{text: "Hello"}, nil
+	}}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	defer s.Close()
+
+	// Streamed body
+	resp, err := http.Post(ts.URL+"/jobs?name=movie.sup", "application/octet-stream", bytes.NewReader(createTestSUP(1000, 3000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", resp.StatusCode)
+	}
+	job := decodeJob(t, resp)
+	if job.DisplaySets != 2 || job.Languages != DefaultLanguages {
+		t.Errorf("Expected 2 display sets in %s, got %+v", DefaultLanguages, job)
+	}
+	job = waitJob(t, ts.URL, job.ID, JobDone)
+	if job.Cues != 2 {
+		t.Errorf("Expected 2 cues, got %d", job.Cues)
+	}
+
+	resp, err = http.Get(ts.URL + "/jobs/" + job.ID + "/result?format=vtt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	out.ReadFrom(resp.Body)
+	resp.Body.Close()
+	if !strings.HasPrefix(out.String(), "WEBVTT") || !strings.Contains(out.String(), "00:00:01.000 --> 00:00:03.000\nHello") {
+		t.Errorf("Unexpected VTT result:\n%s", out.String())
+	}
+	if !strings.Contains(resp.Header.Get("Content-Disposition"), "movie.vtt") {
+		t.Errorf("Expected movie.vtt attachment, got %s", resp.Header.Get("Content-Disposition"))
+	}
+
+	// Form upload reuses the engine of its language
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	fw, _ := mw.CreateFormFile("file", "other.sup")
+	fw.Write(createTestSUP(5000))
+	mw.Close()
+	resp, err = http.Post(ts.URL+"/jobs", mw.FormDataContentType(), &form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job = waitJob(t, ts.URL, decodeJob(t, resp).ID, JobDone)
+	if job.Name != "other.sup" || job.Cues != 1 {
+		t.Errorf("Expected 1 cue of other.sup, got %+v", job)
+	}
+	if engines != 1 {
+		t.Errorf("Expected 1 OCR engine, got %d", engines)
+	}
+
+	resp, _ = http.Get(ts.URL + "/jobs")
+	var jobs []Job
+	json.NewDecoder(resp.Body).Decode(&jobs)
+	resp.Body.Close()
+	if len(jobs) != 2 {
+		t.Errorf("Expected 2 jobs, got %d", len(jobs))
+	}
+
+	// Invalid uploads and requests
+	for _, c := range []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodPost, "/jobs", "junk", http.StatusBadRequest},
+		{http.MethodPost, "/jobs", "", http.StatusBadRequest},
+		{http.MethodPost, "/jobs?fix=maybe", "", http.StatusBadRequest},
+		{http.MethodGet, "/jobs/" + job.ID + "/result?format=txt", "", http.StatusBadRequest},
+		{http.MethodGet, "/jobs/unknown", "", http.StatusNotFound},
+		{http.MethodPut, "/jobs", "", http.StatusMethodNotAllowed},
+	} {
+		req, _ := http.NewRequest(c.method, ts.URL+c.path, strings.NewReader(c.body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Errorf("Expected %s %s to give %d, got %d", c.method, c.path, c.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestServerLimits(t *testing.T) {
+	engine := &blockingEngine{release: make(chan struct{})}
+	s := &Server{Workers: 1, MaxQueued: 1, MaxUploadSize: 200, NewEngine: func(opts Options) (OCREngine, error) {
+		return engine, nil
+	}}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	post := func(sup []byte, status int) Job {
+		t.Helper()
+		resp, err := http.Post(ts.URL+"/jobs", "application/octet-stream", bytes.NewReader(sup))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != status {
+			t.Fatalf("Expected status %d, got %d", status, resp.StatusCode)
+		}
+		if status != http.StatusAccepted {
+			resp.Body.Close()
+			return Job{}
+		}
+		return decodeJob(t, resp)
+	}
+	post(createTestSUP(1000, 2000, 3000, 4000), http.StatusRequestEntityTooLarge)
+
+	running := post(createTestSUP(1000), http.StatusAccepted)
+	waitJob(t, ts.URL, running.ID, JobRunning)
+	queued := post(createTestSUP(2000), http.StatusAccepted)
+	post(createTestSUP(3000), http.StatusServiceUnavailable)
+
+	// Cancelled jobs free their place in the queue while the worker is busy
+	req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/jobs/"+queued.ID, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	queued = post(createTestSUP(2000), http.StatusAccepted)
+	post(createTestSUP(3000), http.StatusServiceUnavailable)
+
+	// Cancelled jobs never run or keep the cues recognized so far, without waiting for the OCR engine
+	for _, id := range []string{queued.ID, running.ID} {
+		req, _ := http.NewRequest(http.MethodDelete, ts.URL+"/jobs/"+id, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job := decodeJob(t, resp); job.Status != JobCancelled {
+			t.Errorf("Expected job %s to be cancelled, got %s", id, job.Status)
+		}
+	}
+	for i := 0; i < 200; i++ {
+		resp, _ := http.Get(ts.URL + "/jobs/" + running.ID)
+		if decodeJob(t, resp).Finished != nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	resp, _ = http.Get(ts.URL + "/jobs/" + running.ID + "/result")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Suptext-Job-Status") != JobCancelled {
+		t.Errorf("Expected partial result of cancelled job, got %d %s", resp.StatusCode, resp.Header.Get("Suptext-Job-Status"))
+	}
+	resp, _ = http.Get(ts.URL + "/jobs/" + queued.ID + "/result")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected result of job cancelled before running to give 409, got %d", resp.StatusCode)
+	}
+	close(engine.release)
+	s.Close()
+	post(createTestSUP(1000), http.StatusServiceUnavailable)
+}
+
+func TestServerJobTimeout(t *testing.T) {
+	engine := &blockingEngine{release: make(chan struct{})}
+	defer close(engine.release)
+	s := &Server{JobTimeout: 50 * time.Millisecond, NewEngine: func(opts Options) (OCREngine, error) {
+		return engine, nil
+	}}
+	defer s.Close()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/jobs", "application/octet-stream", bytes.NewReader(createTestSUP(1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := waitJob(t, ts.URL, decodeJob(t, resp).ID, JobCancelled)
+	if !strings.Contains(job.Error, "Timed out") {
+		t.Errorf("Expected timeout error, got %q", job.Error)
+	}
+}
+
+func TestServerLanguages(t *testing.T) {
+	var created []string
+	s := &Server{Workers: 1, MaxEngines: 1, Languages: []string{"deu", "fra"}, NewEngine: func(opts Options) (OCREngine, error) {
+		created = append(created, opts.Languages)
+		return &fakeEngine{text: "Hello"}, nil
+	}}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	post := func(lang string, status int) {
+		t.Helper()
+		resp, err := http.Post(ts.URL+"/jobs?lang="+lang, "application/octet-stream", bytes.NewReader(createTestSUP(1000)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != status {
+			t.Fatalf("Expected status %d for lang %s, got %d", status, lang, resp.StatusCode)
+		}
+		if status == http.StatusAccepted {
+			waitJob(t, ts.URL, decodeJob(t, resp).ID, JobDone)
+		} else {
+			resp.Body.Close()
+		}
+	}
+	post("..%2Fx", http.StatusBadRequest)
+	post("spa", http.StatusBadRequest)
+	post("deu%2Bspa", http.StatusBadRequest)
+	post(DefaultLanguages, http.StatusAccepted)
+	post("deu", http.StatusAccepted)
+	post("fra", http.StatusAccepted)
+	// The engine of deu was closed to keep a single one
+	post("deu", http.StatusAccepted)
+	s.Close()
+	expected := []string{DefaultLanguages, "deu", "fra", "deu"}
+	if strings.Join(created, " ") != strings.Join(expected, " ") {
+		t.Errorf("Expected engines %v, got %v", expected, created)
+	}
+}
@@ -0,0 +1,381 @@
+package suptext
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "os"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+)
+
+// Characters Tesseract commonly confuses, tried in order when correcting unknown words
+var OCRConfusions = [][2]string{
+    {"l", "I"}, {"I", "l"}, {"1", "l"}, {"l", "i"}, {"i", "l"}, {"|", "I"}, {"|", "l"},
+    {"0", "O"}, {"0", "o"}, {"O", "0"}, {"5", "S"}, {"8", "B"},
+    {"rn", "m"}, {"m", "rn"}, {"vv", "w"}, {"cl", "d"}, {"li", "h"}, {"ii", "u"},
+}
+
+// Numbers, times and ordinals such as 1985, 10:30, 1st or 90s are never spell checked
+var numberPattern = regexp.MustCompile(`(?i)^[0-9][0-9,.:']*(?:st|nd|rd|th|s|am|pm)?$`)
+
+// Maximum number of confusions replaced in a single word
+const MaxConfusionEdits = 2
+
+// Dictionary is the set of words of a Hunspell dictionary, expanded with their affixes
+type Dictionary struct {
+    words map[string]bool
+}
+
+type affixEntry struct {
+    strip string
+    add string
+    cond *regexp.Regexp
+}
+
+type affixRule struct {
+    suffix bool
+    cross bool
+    entries []affixEntry
+}
+
+// affixFile holds the parts of a Hunspell .aff file needed to expand dictionary words
+type affixFile struct {
+    flagType string
+    needAffix string
+    rules map[string]*affixRule
+}
+
+// LoadDictionary loads the Hunspell files <path>.dic and <path>.aff, path may also name either file
+func LoadDictionary(path string) (*Dictionary, error) {
+    base := strings.TrimSuffix(strings.TrimSuffix(path, ".dic"), ".aff")
+    faff, err := os.Open(base + ".aff")
+    if err != nil {
+        return nil, err
+    }
+    defer faff.Close()
+    fdic, err := os.Open(base + ".dic")
+    if err != nil {
+        return nil, err
+    }
+    defer fdic.Close()
+    return ReadDictionary(fdic, faff)
+}
+
+func ReadDictionary(dic io.Reader, aff io.Reader) (*Dictionary, error) {
+    affixes, err := readAffixes(aff)
+    if err != nil {
+        return nil, fmt.Errorf("Invalid affix file: %v", err)
+    }
+
+    d := &Dictionary{words: map[string]bool{}}
+    scanner := bufio.NewScanner(dic)
+    for n := 1; scanner.Scan(); n++ {
+        line := strings.TrimSpace(scanner.Text())
+        // First line is the approximate word count
+        if n == 1 {
+            if _, err := strconv.Atoi(line); err == nil {
+                continue
+            }
+        }
+        // Morphological fields follow whitespace
+        if i := strings.IndexAny(line, " \t"); i >= 0 {
+            line = line[:i]
+        }
+        if line == "" {
+            continue
+        }
+        word, flags, _ := strings.Cut(line, "/")
+        d.addWord(word, affixes.parseFlags(flags), affixes)
+    }
+    return d, scanner.Err()
+}
+
+func (d *Dictionary) addWord(word string, flags []string, affixes *affixFile) {
+    needAffix := false
+    var prefixes, suffixes []*affixRule
+    for _, f := range flags {
+        if f == affixes.needAffix {
+            needAffix = true
+        }
+        if rule, ok := affixes.rules[f]; ok {
+            if rule.suffix {
+                suffixes = append(suffixes, rule)
+            } else {
+                prefixes = append(prefixes, rule)
+            }
+        }
+    }
+    if !needAffix {
+        d.words[word] = true
+    }
+
+    var suffixed []string
+    for _, rule := range suffixes {
+        for _, form := range rule.apply(word) {
+            d.words[form] = true
+            if rule.cross {
+                suffixed = append(suffixed, form)
+            }
+        }
+    }
+    for _, rule := range prefixes {
+        for _, form := range rule.apply(word) {
+            d.words[form] = true
+        }
+        // Cross product of prefixes and suffixes
+        if rule.cross {
+            for _, s := range suffixed {
+                for _, form := range rule.apply(s) {
+                    d.words[form] = true
+                }
+            }
+        }
+    }
+}
+
+func (r *affixRule) apply(word string) []string {
+    var forms []string
+    for _, e := range r.entries {
+        if !e.cond.MatchString(word) {
+            continue
+        }
+        if r.suffix {
+            if strings.HasSuffix(word, e.strip) && len(word) > len(e.strip) {
+                forms = append(forms, word[:len(word) - len(e.strip)] + e.add)
+            }
+        } else if strings.HasPrefix(word, e.strip) && len(word) > len(e.strip) {
+            forms = append(forms, e.add + word[len(e.strip):])
+        }
+    }
+    return forms
+}
+
+func readAffixes(r io.Reader) (*affixFile, error) {
+    a := &affixFile{rules: map[string]*affixRule{}}
+    scanner := bufio.NewScanner(r)
+    for n := 1; scanner.Scan(); n++ {
+        fields := strings.Fields(scanner.Text())
+        if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+            continue
+        }
+        switch fields[0] {
+        case "FLAG":
+            if len(fields) > 1 {
+                a.flagType = fields[1]
+            }
+        case "NEEDAFFIX":
+            if len(fields) > 1 {
+                a.needAffix = fields[1]
+            }
+        case "PFX", "SFX":
+            if err := a.addAffixLine(fields); err != nil {
+                return nil, fmt.Errorf("line %d: %v", n, err)
+            }
+        }
+    }
+    return a, scanner.Err()
+}
+
+// addAffixLine parses a rule header "SFX <flag> <cross> <count>" or entry "SFX <flag> <strip> <add> <condition>"
+func (a *affixFile) addAffixLine(fields []string) error {
+    if len(fields) < 4 {
+        return fmt.Errorf("truncated %s line", fields[0])
+    }
+    rule, ok := a.rules[fields[1]]
+    if !ok {
+        a.rules[fields[1]] = &affixRule{suffix: fields[0] == "SFX", cross: fields[2] == "Y"}
+        return nil
+    }
+
+    strip, add := fields[2], fields[3]
+    if strip == "0" {
+        strip = ""
+    }
+    // Continuation flags of the affix aren't supported, drop them
+    add, _, _ = strings.Cut(add, "/")
+    if add == "0" {
+        add = ""
+    }
+    cond := "."
+    if len(fields) > 4 {
+        cond = fields[4]
+    }
+    var expr string
+    if rule.suffix {
+        expr = "(?:" + cond + ")$"
+    } else {
+        expr = "^(?:" + cond + ")"
+    }
+    re, err := regexp.Compile(expr)
+    if err != nil {
+        return fmt.Errorf("invalid condition '%s': %v", cond, err)
+    }
+    rule.entries = append(rule.entries, affixEntry{strip: strip, add: add, cond: re})
+    return nil
+}
+
+// parseFlags splits a dictionary word's flags according to the FLAG type
+func (a *affixFile) parseFlags(flags string) []string {
+    var out []string
+    switch a.flagType {
+    case "long":
+        for i := 0; i + 1 < len(flags); i += 2 {
+            out = append(out, flags[i:i + 2])
+        }
+    case "num":
+        out = strings.Split(flags, ",")
+    default:
+        for _, r := range flags {
+            out = append(out, string(r))
+        }
+    }
+    return out
+}
+
+func (d *Dictionary) Size() int {
+    return len(d.words)
+}
+
+// Check reports whether word is in the dictionary, allowing capitalized and upper case forms
+func (d *Dictionary) Check(word string) bool {
+    if d.words[word] {
+        return true
+    }
+    lower := strings.ToLower(word)
+    first, size := utf8.DecodeRuneInString(word)
+    if unicode.IsUpper(first) && word[size:] == lower[size:] && d.words[lower] {
+        return true
+    }
+    if word == strings.ToUpper(word) {
+        return d.words[lower] || d.words[capitalize(lower)]
+    }
+    return false
+}
+
+func capitalize(word string) string {
+    first, size := utf8.DecodeRuneInString(word)
+    return string(unicode.ToUpper(first)) + word[size:]
+}
+
+// Suggest returns the first dictionary word reachable from word by replacing OCR confusions
+func (d *Dictionary) Suggest(word string) (string, bool) {
+    candidates := []string{word}
+    seen := map[string]bool{word: true}
+    for edit := 0; edit < MaxConfusionEdits; edit++ {
+        var next []string
+        for _, c := range candidates {
+            for _, pair := range OCRConfusions {
+                for i := strings.Index(c, pair[0]); i >= 0; {
+                    fixed := c[:i] + pair[1] + c[i + len(pair[0]):]
+                    if d.Check(fixed) {
+                        return fixed, true
+                    }
+                    if !seen[fixed] {
+                        seen[fixed] = true
+                        next = append(next, fixed)
+                    }
+                    j := strings.Index(c[i + 1:], pair[0])
+                    if j < 0 {
+                        break
+                    }
+                    i += j + 1
+                }
+            }
+        }
+        candidates = next
+    }
+    return "", false
+}
+
+// SpellReport counts the corrected and unresolved unknown words of a file
+type SpellReport struct {
+    Corrected int
+    Unknown map[string]int
+}
+
+// UnknownWords returns the unresolved unknown words, most frequent first
+func (r *SpellReport) UnknownWords() []string {
+    words := make([]string, 0, len(r.Unknown))
+    for w := range r.Unknown {
+        words = append(words, w)
+    }
+    sort.Slice(words, func(i, j int) bool {
+        if r.Unknown[words[i]] != r.Unknown[words[j]] {
+            return r.Unknown[words[i]] > r.Unknown[words[j]]
+        }
+        return words[i] < words[j]
+    })
+    return words
+}
+
+func (r *SpellReport) Write(w io.Writer) error {
+    for _, word := range r.UnknownWords() {
+        if _, err := fmt.Fprintf(w, "%d\t%s\n", r.Unknown[word], word); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// isSpellWordRune reports whether r is part of a word for spell checking. OCR confusion
+// characters are included so that misread words are checked whole
+func isSpellWordRune(r rune) bool {
+    return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\'' || r == '’' || r == '|'
+}
+
+// CorrectLine replaces unknown words of line with their suggestions, recording unresolved words in report
+func (d *Dictionary) CorrectLine(line string, report *SpellReport) string {
+    var b strings.Builder
+    for len(line) > 0 {
+        // Copy separators as is
+        i := strings.IndexFunc(line, isSpellWordRune)
+        if i < 0 {
+            b.WriteString(line)
+            break
+        }
+        b.WriteString(line[:i])
+        line = line[i:]
+        j := strings.IndexFunc(line, func(r rune) bool { return !isSpellWordRune(r) })
+        if j < 0 {
+            j = len(line)
+        }
+        b.WriteString(d.correctWord(line[:j], report))
+        line = line[j:]
+    }
+    return b.String()
+}
+
+func (d *Dictionary) correctWord(token string, report *SpellReport) string {
+    // Quotes around the word aren't part of it
+    word := strings.Trim(token, "'’")
+    if word == "" || d.Check(word) || isNumber(word) {
+        return token
+    }
+    lead := strings.Index(token, word)
+    if fixed, ok := d.Suggest(word); ok {
+        report.Corrected++
+        return token[:lead] + fixed + token[lead + len(word):]
+    }
+    report.Unknown[word]++
+    return token
+}
+
+func isNumber(word string) bool {
+    return numberPattern.MatchString(word)
+}
+
+// CorrectCues spell corrects the lines of cues in place
+func (d *Dictionary) CorrectCues(cues []Cue) SpellReport {
+    report := SpellReport{Unknown: map[string]int{}}
+    for i := range cues {
+        for j := range cues[i].Lines {
+            cues[i].Lines[j].Text = d.CorrectLine(cues[i].Lines[j].Text, &report)
+        }
+    }
+    return report
+}
@@ -0,0 +1,118 @@
+package suptext
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testAffixes = `SET UTF-8
+SFX S Y 2
+SFX S 0 s [^y]
+SFX S y ies y
+PFX U Y 1
+PFX U 0 un .
+SFX D Y 1
+SFX D 0 ed [^e]
+`
+
+const testWords = `6
+hello
+world/S
+I'm
+modern
+lock/UD
+party/S
+`
+
+func createTestDictionary(t *testing.T) *Dictionary {
+	dict, err := ReadDictionary(strings.NewReader(testWords), strings.NewReader(testAffixes))
+	if err != nil {
+		t.Fatalf("Failed to read dictionary: %v", err)
+	}
+	return dict
+}
+
+func TestDictionaryCheck(t *testing.T) {
+	dict := createTestDictionary(t)
+	known := []string{"hello", "Hello", "HELLO", "worlds", "parties", "unlock", "locked", "unlocked", "I'm"}
+	for _, w := range known {
+		if !dict.Check(w) {
+			t.Errorf("Expected %q to be known", w)
+		}
+	}
+	unknown := []string{"hellos", "partys", "hELLO", "unhello", "i'm"}
+	for _, w := range unknown {
+		if dict.Check(w) {
+			t.Errorf("Expected %q to be unknown", w)
+		}
+	}
+}
+
+func TestDictionarySuggest(t *testing.T) {
+	dict := createTestDictionary(t)
+	cases := map[string]string{
+		"rnodern": "modern",
+		"Hel1o":   "Hello",
+		"|'m":     "I'm",
+		"w0rlds":  "worlds",
+		"he11o":   "hello",
+	}
+	for in, expected := range cases {
+		got, ok := dict.Suggest(in)
+		if !ok || got != expected {
+			t.Errorf("Suggest(%q): expected %q, got %q (%v)", in, expected, got, ok)
+		}
+	}
+	if _, ok := dict.Suggest("Kenobi"); ok {
+		t.Error("Expected no suggestion for Kenobi")
+	}
+}
+
+func TestCorrectCues(t *testing.T) {
+	dict := createTestDictionary(t)
+	cues := []Cue{
+		{Lines: []CueLine{{Text: "\"Hel1o,\" |'m rnodern in 1985."}}},
+		{Lines: []CueLine{{Text: "Kenobi, 1st party-worlds Kenobi"}}},
+	}
+	report := dict.CorrectCues(cues)
+	if got := cues[0].Lines[0].Text; got != "\"Hello,\" I'm modern in 1985." {
+		t.Errorf("Unexpected correction %q", got)
+	}
+	if report.Corrected != 3 {
+		t.Errorf("Expected 3 corrected words, got %d", report.Corrected)
+	}
+	if len(report.Unknown) != 2 || report.Unknown["Kenobi"] != 2 || report.Unknown["in"] != 1 {
+		t.Errorf("Unexpected unknown words %v", report.Unknown)
+	}
+	var buf bytes.Buffer
+	if err := report.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "2\tKenobi\n1\tin\n" {
+		t.Errorf("Unexpected report %q", buf.String())
+	}
+}
+
+func TestLoadDictionary(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "en_TEST")
+	if err := os.WriteFile(base+".aff", []byte("FLAG long\nSFX Aa Y 1\nSFX Aa 0 s .\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(base+".dic", []byte("1\nword/AaBb\tpo:noun\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	dict, err := LoadDictionary(base + ".dic")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !dict.Check("words") || dict.Size() != 2 {
+		t.Errorf("Expected long flags to expand to word, words; got %d words", dict.Size())
+	}
+	if _, err := LoadDictionary(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected error for missing dictionary")
+	}
+}
@@ -0,0 +1,47 @@
+package suptext
+
+import (
+    "fmt"
+)
+
+// Summary reports what happened while recognizing the cues of a file
+type Summary struct {
+    Cues int
+    ForcedCues int
+    // Recognition stopped early, the cues are those recognized so far
+    Cancelled bool
+    // Objects the OCR engine failed on, their text is missing
+    OCRErrors int
+    // Lines changed by correction rules
+    CorrectedLines int
+    // Bitmaps taken from / added to the OCR cache
+    CacheHits int
+    CacheDiskHits int // Hits read from the persistent cache, included in CacheHits
+    CacheMisses int
+    // Spell checking results, nil without a dictionary
+    Spelling *SpellReport
+    // Glyphs missing from the glyph database, or learned by training it
+    UnknownGlyphs int
+    LearnedGlyphs int
+}
+
+func (s *Summary) String() string {
+    out := fmt.Sprintf("%d cues (%d forced), OCR cache %d hits (%d from disk) %d misses, %d lines corrected by rules",
+        s.Cues, s.ForcedCues, s.CacheHits, s.CacheDiskHits, s.CacheMisses, s.CorrectedLines)
+    if s.Spelling != nil {
+        out += fmt.Sprintf(", %d words spell corrected, %d unknown words", s.Spelling.Corrected, len(s.Spelling.Unknown))
+    }
+    if s.OCRErrors > 0 {
+        out += fmt.Sprintf(", %d OCR errors", s.OCRErrors)
+    }
+    if s.UnknownGlyphs > 0 {
+        out += fmt.Sprintf(", %d unknown glyphs", s.UnknownGlyphs)
+    }
+    if s.LearnedGlyphs > 0 {
+        out += fmt.Sprintf(", %d glyphs learned", s.LearnedGlyphs)
+    }
+    if s.Cancelled {
+        out += ", cancelled"
+    }
+    return out
+}
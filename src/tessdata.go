@@ -0,0 +1,110 @@
+package suptext
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "strings"
+)
+
+const DefaultLanguages = "eng"
+
+// Tesseract model variants
+const (
+    ModelDefault = ""
+    ModelFast = "fast"     // LSTM models from <tessdata>/tessdata_fast
+    ModelBest = "best"     // LSTM models from <tessdata>/tessdata_best
+    ModelLegacy = "legacy" // Legacy (non-LSTM) engine, needs traineddata that contains legacy models
+)
+
+// Tesseract OCR engine modes, only settable when the engine is initialized
+const (
+    OEMTesseractOnly = 0
+    OEMLSTMOnly = 1
+)
+
+// Number of Tesseract page segmentation modes, valid modes are 0 to PageSegModeCount-1
+const PageSegModeCount = 14
+
+// InitVariables returns the Tesseract variables that must be set when the engine initializes.
+// Engine mode and user words/patterns can't be set through SetVariable once initialized,
+// arbitrary variables are passed along so both init-only and runtime variables work.
+func InitVariables(opts Options) (map[string]string, error) {
+    if opts.PageSegMode < 0 || opts.PageSegMode >= PageSegModeCount {
+        return nil, fmt.Errorf("Invalid page segmentation mode %d (expected 1-%d)", opts.PageSegMode, PageSegModeCount - 1)
+    }
+
+    vars := map[string]string{}
+    for k, v := range opts.Variables {
+        vars[k] = v
+    }
+    if opts.Model == ModelLegacy {
+        vars["tessedit_ocr_engine_mode"] = fmt.Sprint(OEMTesseractOnly)
+    }
+    for k, fname := range map[string]string{"user_words_file": opts.UserWords, "user_patterns_file": opts.UserPatterns} {
+        if fname == "" {
+            continue
+        }
+        abs, err := filepath.Abs(fname)
+        if err != nil {
+            return nil, err
+        }
+        if _, err := os.Stat(abs); err != nil {
+            return nil, fmt.Errorf("Failed to read %s: %v", k, err)
+        }
+        vars[k] = abs
+    }
+    return vars, nil
+}
+
+// LanguageList splits Languages ("deu+eng") into Tesseract language codes
+func (o *Options) LanguageList() []string {
+    var langs []string
+    for _, l := range strings.Split(o.Languages, "+") {
+        if l = strings.TrimSpace(l); l != "" {
+            langs = append(langs, l)
+        }
+    }
+    if len(langs) == 0 {
+        return []string{DefaultLanguages}
+    }
+    return langs
+}
+
+// TessdataDir resolves the traineddata directory from the tessdata prefix and model.
+// Returns an empty string to let Tesseract use its compiled-in default.
+func TessdataDir(opts Options) (string, error) {
+    prefix := opts.TessdataPrefix
+    if prefix == "" {
+        prefix = os.Getenv("TESSDATA_PREFIX")
+    }
+
+    switch opts.Model {
+    case ModelDefault, ModelLegacy:
+        return strings.TrimSuffix(prefix, string(filepath.Separator)), nil
+    case ModelFast, ModelBest:
+        if prefix == "" {
+            return "", fmt.Errorf("Model '%s' requires a tessdata directory containing tessdata_%s", opts.Model, opts.Model)
+        }
+        dir := filepath.Join(prefix, "tessdata_" + opts.Model)
+        if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+            return "", fmt.Errorf("Model '%s' not found: missing directory %s", opts.Model, dir)
+        }
+        return dir, nil
+    }
+    return "", fmt.Errorf("Unknown model '%s' (expected %s, %s or %s)", opts.Model, ModelFast, ModelBest, ModelLegacy)
+}
+
+// ValidateLanguages checks that every language has a traineddata file in tessdata, if known
+func ValidateLanguages(tessdata string, langs []string) error {
+    if tessdata == "" {
+        return nil
+    }
+    for _, l := range langs {
+        fname := filepath.Join(tessdata, l + ".traineddata")
+        if _, err := os.Stat(fname); err != nil {
+            return fmt.Errorf("Language '%s' not installed: missing %s", l, fname)
+        }
+    }
+    return nil
+}
@@ -0,0 +1,107 @@
+package suptext
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLanguageList(t *testing.T) {
+	opts := Options{Languages: "deu+ eng+"}
+	langs := opts.LanguageList()
+	if len(langs) != 2 || langs[0] != "deu" || langs[1] != "eng" {
+		t.Errorf("Expected [deu eng], got %v", langs)
+	}
+	empty := Options{}
+	if langs := empty.LanguageList(); len(langs) != 1 || langs[0] != DefaultLanguages {
+		t.Errorf("Expected default language, got %v", langs)
+	}
+}
+
+func TestTessdataDir_Models(t *testing.T) {
+	prefix := t.TempDir()
+	if err := os.Mkdir(filepath.Join(prefix, "tessdata_best"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := TessdataDir(Options{TessdataPrefix: prefix, Model: ModelBest})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if dir != filepath.Join(prefix, "tessdata_best") {
+		t.Errorf("Unexpected best model directory %s", dir)
+	}
+	if _, err := TessdataDir(Options{TessdataPrefix: prefix, Model: ModelFast}); err == nil {
+		t.Error("Expected error for missing fast models")
+	}
+	if dir, _ := TessdataDir(Options{TessdataPrefix: prefix + "/", Model: ModelLegacy}); dir != prefix {
+		t.Errorf("Expected legacy model to use prefix %s, got %s", prefix, dir)
+	}
+	if _, err := TessdataDir(Options{TessdataPrefix: prefix, Model: "huge"}); err == nil {
+		t.Error("Expected error for unknown model")
+	}
+}
+
+func TestTessdataDir_RequiresPrefix(t *testing.T) {
+	t.Setenv("TESSDATA_PREFIX", "")
+	if _, err := TessdataDir(Options{Model: ModelFast}); err == nil {
+		t.Error("Expected error for fast model without tessdata directory")
+	}
+	if dir, err := TessdataDir(Options{}); err != nil || dir != "" {
+		t.Errorf("Expected default tessdata, got %q, %v", dir, err)
+	}
+}
+
+func TestValidateLanguages(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "eng.traineddata"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateLanguages(dir, []string{"eng"}); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+	if err := ValidateLanguages(dir, []string{"deu", "eng"}); err == nil {
+		t.Error("Expected error for missing deu traineddata")
+	}
+	if err := ValidateLanguages("", []string{"deu"}); err != nil {
+		t.Errorf("Expected no validation without tessdata, got: %v", err)
+	}
+}
+
+func TestInitVariables(t *testing.T) {
+	dir := t.TempDir()
+	words := filepath.Join(dir, "show.user-words")
+	if err := os.WriteFile(words, []byte("Kenobi\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{
+		Model:     ModelLegacy,
+		UserWords: words,
+		Variables: map[string]string{"load_system_dawg": "0"},
+	}
+	vars, err := InitVariables(opts)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if vars["tessedit_ocr_engine_mode"] != "0" {
+		t.Errorf("Expected legacy engine mode, got %q", vars["tessedit_ocr_engine_mode"])
+	}
+	if vars["user_words_file"] != words {
+		t.Errorf("Expected user words file %s, got %q", words, vars["user_words_file"])
+	}
+	if vars["load_system_dawg"] != "0" {
+		t.Errorf("Expected custom variable to be passed, got %q", vars["load_system_dawg"])
+	}
+	if _, ok := vars["user_patterns_file"]; ok {
+		t.Error("Expected no user patterns file")
+	}
+}
+
+func TestInitVariables_Invalid(t *testing.T) {
+	if _, err := InitVariables(Options{UserPatterns: filepath.Join(t.TempDir(), "missing")}); err == nil {
+		t.Error("Expected error for missing user patterns file")
+	}
+	if _, err := InitVariables(Options{PageSegMode: 14}); err == nil {
+		t.Error("Expected error for invalid page segmentation mode")
+	}
+}
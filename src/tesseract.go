@@ -0,0 +1,258 @@
+//go:build cgo && !notesseract
+
+package suptext
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "log"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "github.com/otiai10/gosseract/v2"
+)
+
+const TesseractSupported = true
+
+// OCRClient is a Tesseract client configured from Options
+type OCRClient struct {
+    *gosseract.Client
+    // Generated init-time config file, removed on Close
+    config string
+}
+
+func NewOCRClient(opts Options) (*OCRClient, error) {
+    langs := opts.LanguageList()
+    tessdata, err := TessdataDir(opts)
+    if err != nil {
+        return nil, err
+    }
+    if err := ValidateLanguages(tessdata, langs); err != nil {
+        return nil, err
+    }
+    init_vars, err := InitVariables(opts)
+    if err != nil {
+        return nil, err
+    }
+
+    c := &OCRClient{Client: gosseract.NewClient()}
+    if tessdata != "" {
+        // gosseract expects the prefix to end with a separator
+        if err := c.SetTessdataPrefix(tessdata + string(filepath.Separator)); err != nil {
+            c.Close()
+            return nil, err
+        }
+    }
+    if err := c.SetLanguage(langs...); err != nil {
+        c.Close()
+        return nil, err
+    }
+
+    if opts.PageSegMode != 0 {
+        if err := c.SetPageSegMode(gosseract.PageSegMode(opts.PageSegMode)); err != nil {
+            c.Close()
+            return nil, err
+        }
+    }
+    if opts.Whitelist != "" {
+        if err := c.SetWhitelist(opts.Whitelist); err != nil {
+            c.Close()
+            return nil, err
+        }
+    }
+    if opts.Blacklist != "" {
+        if err := c.SetBlacklist(opts.Blacklist); err != nil {
+            c.Close()
+            return nil, err
+        }
+    }
+
+    if err := c.setInitConfig(init_vars); err != nil {
+        c.Close()
+        return nil, err
+    }
+    return c, nil
+}
+
+// Recognize OCRs the bitmap image with Tesseract
+func (c *OCRClient) Recognize(b *Bitmap) (OCRResult, error) {
+    words, err := c.recognizeWords(b)
+    if err != nil {
+        return OCRResult{}, err
+    }
+    return NewOCRResult(words), nil
+}
+
+// RecognizeWords OCRs the bitmap image and also returns the recognized words with their boxes
+func (c *OCRClient) RecognizeWords(b *Bitmap) (OCRResult, []WordBox, error) {
+    words, err := c.recognizeWords(b)
+    if err != nil {
+        return OCRResult{}, nil, err
+    }
+    boxes := make([]WordBox, len(words))
+    for i, w := range words {
+        boxes[i] = WordBox{Word: w.Word, Box: w.Box, Confidence: w.Confidence}
+    }
+    return NewOCRResult(words), boxes, nil
+}
+
+func (c *OCRClient) recognizeWords(b *Bitmap) ([]gosseract.BoundingBox, error) {
+    // Get image bytes
+    img_bytes, err := GetImageBytesJPEG(b.Image)
+    if err != nil {
+        return nil, fmt.Errorf("Failed to encode JPEG: %v", err)
+    }
+    if err := c.SetImageFromBytes(img_bytes); err != nil {
+        return nil, err
+    }
+    return c.GetBoundingBoxesVerbose()
+}
+
+func (c *OCRClient) Close() error {
+    if c.config != "" {
+        os.Remove(c.config)
+    }
+    return c.Client.Close()
+}
+
+// setInitConfig writes vars to a Tesseract config file read when the engine initializes
+func (c *OCRClient) setInitConfig(vars map[string]string) error {
+    if len(vars) == 0 {
+        return nil
+    }
+    f, err := os.CreateTemp("", "suptext-*.config")
+    if err != nil {
+        return fmt.Errorf("Failed to create tesseract config: %v", err)
+    }
+    defer f.Close()
+    c.config = f.Name()
+    keys := make([]string, 0, len(vars))
+    for k := range vars {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    for _, k := range keys {
+        if _, err := fmt.Fprintf(f, "%s %s\n", k, vars[k]); err != nil {
+            return fmt.Errorf("Failed to write tesseract config: %v", err)
+        }
+    }
+    return c.SetConfigFile(c.config)
+}
+
+// OCRFingerprint identifies the Tesseract version, models and settings that affect recognized text
+func OCRFingerprint(opts Options) (string, error) {
+    tessdata, err := TessdataDir(opts)
+    if err != nil {
+        return "", err
+    }
+    vars, err := InitVariables(opts)
+    if err != nil {
+        return "", err
+    }
+
+    h := sha256.New()
+    fmt.Fprintf(h, "tesseract %s\n", gosseract.Version())
+    fmt.Fprintf(h, "tessdata %s\nmodel %s\npsm %d\n", tessdata, opts.Model, opts.PageSegMode)
+    fmt.Fprintf(h, "whitelist %q\nblacklist %q\n", opts.Whitelist, opts.Blacklist)
+    for _, l := range opts.LanguageList() {
+        fmt.Fprintf(h, "lang %s", l)
+        // Updated models get new fingerprints
+        if tessdata != "" {
+            if info, err := os.Stat(filepath.Join(tessdata, l + ".traineddata")); err == nil {
+                fmt.Fprintf(h, " %d %d", info.Size(), info.ModTime().UnixNano())
+            }
+        }
+        fmt.Fprintln(h)
+    }
+    keys := make([]string, 0, len(vars))
+    for k := range vars {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    for _, k := range keys {
+        fmt.Fprintf(h, "var %s %q", k, vars[k])
+        // User words and patterns are identified by content rather than path
+        if k == "user_words_file" || k == "user_patterns_file" {
+            data, err := os.ReadFile(vars[k])
+            if err != nil {
+                return "", err
+            }
+            fmt.Fprintf(h, " %x", sha256.Sum256(data))
+        }
+        fmt.Fprintln(h)
+    }
+    return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func RunOCR(ocr *gosseract.Client, img []byte) (string, error) {
+    ocr.SetImageFromBytes(img)
+    return ocr.Text()
+}
+
+// RunOCRWithConfidence recognizes the image once and rebuilds its text lines from the recognized words
+func RunOCRWithConfidence(ocr *gosseract.Client, img []byte) (OCRResult, error) {
+    if err := ocr.SetImageFromBytes(img); err != nil {
+        return OCRResult{}, err
+    }
+    words, err := ocr.GetBoundingBoxesVerbose()
+    if err != nil {
+        return OCRResult{}, err
+    }
+    return NewOCRResult(words), nil
+}
+
+func NewOCRResult(words []gosseract.BoundingBox) OCRResult {
+    var result OCRResult
+    var lines []string
+    var line []string
+    var sum float64
+    var block, par, num int
+
+    for i, w := range words {
+        // Start a new line whenever block, paragraph or line number changes
+        if i > 0 && (w.BlockNum != block || w.ParNum != par || w.LineNum != num) {
+            lines = append(lines, strings.Join(line, " "))
+            line = nil
+        }
+        block, par, num = w.BlockNum, w.ParNum, w.LineNum
+        line = append(line, w.Word)
+
+        sum += w.Confidence
+        if i == 0 || w.Confidence < result.MinConfidence {
+            result.MinConfidence = w.Confidence
+        }
+    }
+    if line != nil {
+        lines = append(lines, strings.Join(line, " "))
+    }
+
+    result.Text = strings.Join(lines, "\n")
+    result.Words = len(words)
+    if result.Words > 0 {
+        result.Confidence = sum / float64(result.Words)
+    }
+    return result
+}
+
+func (d *DisplaySet) AppendSRT(ocr *gosseract.Client, f *os.File, i uint, ets string) error {
+    text, err := d.OCR(ocr)
+    if err != nil {
+        return err
+    }
+    sts := d.StartTS()
+    srt := fmt.Sprintf("%d\n%s --> %s\n%s\n\n", i, sts, ets, text)
+    if _, err := f.WriteString(srt); err != nil {
+        log.Fatalf("Failed to write to file: %v", err)
+    }
+    return nil
+}
+
+func (d *DisplaySet) OCR(ocr *gosseract.Client) (string, error) {
+    cue, err := d.Recognize(&OCRClient{Client: ocr}, Options{}, nil)
+    if err != nil {
+        return "", err
+    }
+    return cue.Text(), nil
+}
@@ -0,0 +1,70 @@
+//go:build cgo && !notesseract
+
+package suptext
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/otiai10/gosseract/v2"
+)
+
+func TestNewOCRResult(t *testing.T) {
+	words := []gosseract.BoundingBox{
+		{Word: "Hello", Confidence: 90, BlockNum: 1, ParNum: 1, LineNum: 1},
+		{Word: "there", Confidence: 80, BlockNum: 1, ParNum: 1, LineNum: 1},
+		{Word: "General", Confidence: 40, BlockNum: 1, ParNum: 1, LineNum: 2},
+		{Word: "Kenobi", Confidence: 70, BlockNum: 1, ParNum: 2, LineNum: 1},
+	}
+	result := NewOCRResult(words)
+	if result.Text != "Hello there\nGeneral\nKenobi" {
+		t.Errorf("Unexpected text %q", result.Text)
+	}
+	if result.Words != 4 {
+		t.Errorf("Expected 4 words, got %d", result.Words)
+	}
+	if result.Confidence != 70 {
+		t.Errorf("Expected mean confidence 70, got %f", result.Confidence)
+	}
+	if result.MinConfidence != 40 {
+		t.Errorf("Expected min confidence 40, got %f", result.MinConfidence)
+	}
+}
+
+func TestNewOCRResult_NoWords(t *testing.T) {
+	result := NewOCRResult(nil)
+	if result.Text != "" || result.Words != 0 || result.Confidence != 0 {
+		t.Errorf("Expected empty result, got %+v", result)
+	}
+}
+
+func TestOCRFingerprint(t *testing.T) {
+	words := filepath.Join(t.TempDir(), "show.user-words")
+	os.WriteFile(words, []byte("Kenobi\n"), 0644)
+	base := Options{Languages: "eng", UserWords: words}
+
+	fp, err := OCRFingerprint(base)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	same, _ := OCRFingerprint(base)
+	if fp != same {
+		t.Error("Expected stable fingerprint")
+	}
+	psm := base
+	psm.PageSegMode = 6
+	if other, _ := OCRFingerprint(psm); other == fp {
+		t.Error("Expected page segmentation mode to change fingerprint")
+	}
+	// Output options don't affect recognition
+	colors := base
+	colors.KeepColors = true
+	if other, _ := OCRFingerprint(colors); other != fp {
+		t.Error("Expected colors option not to change fingerprint")
+	}
+	os.WriteFile(words, []byte("Kenobi\nSkywalker\n"), 0644)
+	if other, _ := OCRFingerprint(base); other == fp {
+		t.Error("Expected user words content to change fingerprint")
+	}
+}
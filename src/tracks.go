@@ -0,0 +1,383 @@
+package suptext
+
+import (
+    "bufio"
+    "fmt"
+    "regexp"
+    "strings"
+)
+
+// Track policy preferences for forced and SDH tracks
+const (
+    TrackAny = "any"
+    TrackPrefer = "prefer"
+    TrackAvoid = "avoid"
+)
+
+// Pairs of ISO 639-2 terminology (Tesseract) and bibliographic codes
+var languageCodes = map[string]string{
+    "deu": "ger", "fra": "fre", "nld": "dut", "ces": "cze", "ell": "gre", "fas": "per",
+    "ron": "rum", "slk": "slo", "zho": "chi", "isl": "ice", "sqi": "alb", "hye": "arm",
+    "eus": "baq", "kat": "geo", "mkd": "mac", "msa": "may", "cym": "wel",
+}
+
+// Track names of subtitles for the deaf and hard of hearing
+var sdhName = regexp.MustCompile(`(?i)\b(sdh|cc|hearing impaired|hoh)\b`)
+
+// SubtitleTrack is a PGS track of any container
+type SubtitleTrack struct {
+    // Matroska track number or transport stream PID
+    ID uint64
+    Language string
+    Name string
+    Default bool
+    Forced bool
+    SDH bool
+    // Bytes of subtitle images, 0 until read
+    Size int
+}
+
+// Demuxer reads the PGS tracks of a container in a single pass
+type Demuxer interface {
+    SubtitleTracks() []SubtitleTrack
+    ReadTracks(ids []uint64) (map[uint64]PGS, error)
+}
+
+// SetProgress makes d count the segments and display sets it reads in progress
+func SetProgress(d Demuxer, progress *ProgressTracker) {
+    switch d := d.(type) {
+    case *MKVReader:
+        d.Progress = progress
+    case *TSReader:
+        d.Progress = progress
+    case *BDMV:
+        d.Progress = progress
+    }
+}
+
+// SetSegmentHook makes d call hook with each segment of the tracks it reads, before they're
+// decoded. Blu-ray folders stitch clips together, their segments can't be followed.
+func SetSegmentHook(d Demuxer, hook func(track uint64, section Section, data []byte)) error {
+    switch d := d.(type) {
+    case *MKVReader:
+        d.OnSegment = hook
+    case *TSReader:
+        d.OnSegment = hook
+    default:
+        return fmt.Errorf("Segments of Blu-ray folders can't be followed, inspect the clips of their STREAM folder")
+    }
+    return nil
+}
+
+// OpenDemuxer opens the Matroska file or transport stream of r, nil for SUP files
+func OpenDemuxer(r *bufio.Reader) (Demuxer, error) {
+    magic, _ := r.Peek(2 * M2TSPacketSize + 1)
+    if IsMatroska(magic) {
+        m, err := OpenMKV(r)
+        if err != nil {
+            return nil, err
+        }
+        return m, nil
+    }
+    if IsTransportStream(magic) {
+        t, err := OpenTS(r)
+        if err != nil {
+            return nil, err
+        }
+        return t, nil
+    }
+    return nil, nil
+}
+
+// LanguageCodes returns the ISO 639-2 codes of a Tesseract or ISO 639-2 language,
+// e.g. deu and ger for deu, ger or deu_latf
+func LanguageCodes(lang string) []string {
+    lang = strings.ToLower(strings.SplitN(lang, "_", 2)[0])
+    for t, b := range languageCodes {
+        if lang == t || lang == b {
+            return []string{t, b}
+        }
+    }
+    return []string{lang}
+}
+
+// HasLanguage reports whether the track is in one of the ISO 639-2 codes of lang
+func (t *SubtitleTrack) HasLanguage(lang string) bool {
+    for _, code := range LanguageCodes(lang) {
+        if strings.EqualFold(t.Language, code) {
+            return true
+        }
+    }
+    return false
+}
+
+// TrackPolicy picks a subtitle track, filtering in order by ID, languages, forced and SDH
+type TrackPolicy struct {
+    // Explicit track, 0 for any
+    ID uint64
+    // Preferred languages, the first one having tracks is used
+    Languages []string
+    Forced string
+    SDH string
+    // Pick the largest remaining track instead of the first default one
+    Largest bool
+}
+
+// NeedsSizes reports whether the sizes of the candidates decide the track
+func (p *TrackPolicy) NeedsSizes(candidates []SubtitleTrack) bool {
+    return p.Largest && len(candidates) > 1
+}
+
+// Candidates returns the tracks the policy chooses from, the default track first
+func (p *TrackPolicy) Candidates(tracks []SubtitleTrack) ([]SubtitleTrack, error) {
+    if len(tracks) == 0 {
+        return nil, fmt.Errorf("No PGS subtitle tracks found")
+    }
+    if p.ID != 0 {
+        for _, t := range tracks {
+            if t.ID == p.ID {
+                return []SubtitleTrack{t}, nil
+            }
+        }
+        return nil, fmt.Errorf("No PGS subtitle track %d", p.ID)
+    }
+
+    candidates := tracks
+    if len(p.Languages) > 0 {
+        candidates = nil
+        for _, lang := range p.Languages {
+            for _, t := range tracks {
+                if t.HasLanguage(lang) {
+                    candidates = append(candidates, t)
+                }
+            }
+            if len(candidates) > 0 {
+                break
+            }
+        }
+        if len(candidates) == 0 {
+            return nil, fmt.Errorf("No %s PGS subtitle tracks found", strings.Join(p.Languages, "+"))
+        }
+    }
+    candidates = preferTracks(candidates, p.Forced, func(t SubtitleTrack) bool { return t.Forced })
+    candidates = preferTracks(candidates, p.SDH, func(t SubtitleTrack) bool { return t.SDH })
+
+    // Stable move of the default tracks to the front
+    var ordered []SubtitleTrack
+    for _, def := range []bool{true, false} {
+        for _, t := range candidates {
+            if t.Default == def {
+                ordered = append(ordered, t)
+            }
+        }
+    }
+    return ordered, nil
+}
+
+// preferTracks keeps the tracks matching pref if any do
+func preferTracks(tracks []SubtitleTrack, pref string, match func(SubtitleTrack) bool) []SubtitleTrack {
+    if pref != TrackPrefer && pref != TrackAvoid {
+        return tracks
+    }
+    var kept []SubtitleTrack
+    for _, t := range tracks {
+        if match(t) == (pref == TrackPrefer) {
+            kept = append(kept, t)
+        }
+    }
+    if len(kept) == 0 {
+        return tracks
+    }
+    return kept
+}
+
+// Select returns the track picked among candidates, the largest one if the policy wants it
+func (p *TrackPolicy) Select(candidates []SubtitleTrack) SubtitleTrack {
+    best := candidates[0]
+    if p.Largest {
+        for _, t := range candidates[1:] {
+            if t.Size > best.Size {
+                best = t
+            }
+        }
+    }
+    return best
+}
+
+// ValidateTrackPreference checks a forced or SDH preference
+func ValidateTrackPreference(pref string) error {
+    switch pref {
+    case "", TrackAny, TrackPrefer, TrackAvoid:
+        return nil
+    }
+    return fmt.Errorf("Unknown track preference '%s' (expected %s, %s or %s)", pref, TrackAny, TrackPrefer, TrackAvoid)
+}
+
+// SelectTrack reads the track picked by the policy, reading all candidates at once when their
+// sizes decide
+func SelectTrack(d Demuxer, policy TrackPolicy) (SubtitleTrack, PGS, error) {
+    candidates, err := policy.Candidates(d.SubtitleTracks())
+    if err != nil {
+        return SubtitleTrack{}, PGS{}, err
+    }
+    if !policy.NeedsSizes(candidates) {
+        candidates = candidates[:1]
+    }
+    ids := make([]uint64, len(candidates))
+    for i, t := range candidates {
+        ids[i] = t.ID
+    }
+    tracks, err := d.ReadTracks(ids)
+    if err != nil {
+        return SubtitleTrack{}, PGS{}, err
+    }
+    for i := range candidates {
+        pgs := tracks[candidates[i].ID]
+        candidates[i].Size = pgs.Size()
+    }
+    track := policy.Select(candidates)
+    return track, tracks[track.ID], nil
+}
+
+// ReadAllTracks reads every track of d, setting their sizes
+func ReadAllTracks(d Demuxer) ([]SubtitleTrack, map[uint64]PGS, error) {
+    tracks := d.SubtitleTracks()
+    ids := make([]uint64, len(tracks))
+    for i, t := range tracks {
+        ids[i] = t.ID
+    }
+    pgs, err := d.ReadTracks(ids)
+    if err != nil {
+        return nil, nil, err
+    }
+    for i := range tracks {
+        p := pgs[tracks[i].ID]
+        tracks[i].Size = p.Size()
+    }
+    return tracks, pgs, nil
+}
+
+// Flags returns the default, forced and SDH flags of the track, e.g. "default,forced"
+func (t *SubtitleTrack) Flags() string {
+    var flags []string
+    if t.Default {
+        flags = append(flags, "default")
+    }
+    if t.Forced {
+        flags = append(flags, "forced")
+    }
+    if t.SDH {
+        flags = append(flags, "sdh")
+    }
+    return strings.Join(flags, ",")
+}
+
+// SubtitleTracks returns the PGS tracks, forced and SDH tracks are also detected by name
+func (m *MKVReader) SubtitleTracks() []SubtitleTrack {
+    var tracks []SubtitleTrack
+    for _, t := range m.PGSTracks() {
+        tracks = append(tracks, SubtitleTrack{
+            ID: t.Number,
+            Language: t.Language,
+            Name: t.Name,
+            Default: t.Default,
+            Forced: t.Forced || strings.Contains(strings.ToLower(t.Name), "forced"),
+            SDH: t.HearingImpaired || sdhName.MatchString(t.Name),
+        })
+    }
+    return tracks
+}
+
+func (m *MKVReader) ReadTracks(ids []uint64) (map[uint64]PGS, error) {
+    return m.ReadPGSTracks(ids)
+}
+
+// SubtitleTracks returns the PGS streams by PID
+func (t *TSReader) SubtitleTracks() []SubtitleTrack {
+    var tracks []SubtitleTrack
+    for _, s := range t.PGSStreams() {
+        tracks = append(tracks, SubtitleTrack{ID: uint64(s.PID), Language: s.Language})
+    }
+    return tracks
+}
+
+func (t *TSReader) ReadTracks(ids []uint64) (map[uint64]PGS, error) {
+    pids := make([]uint16, len(ids))
+    for i, id := range ids {
+        pids[i] = uint16(id)
+    }
+    streams, err := t.ReadPGSStreams(pids)
+    if err != nil {
+        return nil, err
+    }
+    tracks := map[uint64]PGS{}
+    for pid, pgs := range streams {
+        tracks[uint64(pid)] = pgs
+    }
+    return tracks, nil
+}
+
+// SubtitleTracks returns the PGS streams of the playlist by PID of its first clip
+func (b *BDMV) SubtitleTracks() []SubtitleTrack {
+    var tracks []SubtitleTrack
+    for _, s := range b.Playlist.PGSStreams() {
+        tracks = append(tracks, SubtitleTrack{ID: uint64(s.PID), Language: s.Language})
+    }
+    return tracks
+}
+
+func (b *BDMV) ReadTracks(ids []uint64) (map[uint64]PGS, error) {
+    streams, err := b.ReadPGSStreams()
+    if err != nil {
+        return nil, err
+    }
+    tracks := map[uint64]PGS{}
+    for i, s := range b.Playlist.PGSStreams() {
+        for _, id := range ids {
+            if id == uint64(s.PID) {
+                tracks[id] = streams[i]
+            }
+        }
+    }
+    return tracks, nil
+}
+
+// TrackSuffixes returns unique file name suffixes of tracks, <lang>[.forced][.sdh] numbered from .2
+// on collisions. With forcedOutputs the <suffix>.forced names of non-forced tracks are taken too.
+func TrackSuffixes(tracks []SubtitleTrack, forcedOutputs bool) []string {
+    taken := map[string]bool{}
+    suffixes := make([]string, len(tracks))
+    for i, t := range tracks {
+        base := strings.ToLower(t.Language)
+        if base == "" {
+            base = "und"
+        }
+        if t.Forced {
+            base += ".forced"
+        }
+        if t.SDH {
+            base += ".sdh"
+        }
+        suffix := base
+        for n := 2; taken[suffix] || (forcedOutputs && !t.Forced && taken[suffix + ".forced"]); n++ {
+            suffix = fmt.Sprintf("%s.%d", base, n)
+        }
+        taken[suffix] = true
+        if forcedOutputs && !t.Forced {
+            taken[suffix + ".forced"] = true
+        }
+        suffixes[i] = suffix
+    }
+    return suffixes
+}
+
+// TrackOCRLanguages returns the OCR language of languages matching the track, e.g. deu of eng+deu
+// for a ger track, or all languages if none matches
+func TrackOCRLanguages(t SubtitleTrack, languages string) string {
+    for _, lang := range strings.Split(languages, "+") {
+        if t.HasLanguage(lang) {
+            return lang
+        }
+    }
+    return languages
+}
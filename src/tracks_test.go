@@ -0,0 +1,159 @@
+package suptext
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func createTestTracks() []SubtitleTrack {
+	return []SubtitleTrack{
+		{ID: 1, Language: "eng", Size: 100},
+		{ID: 2, Language: "eng", Name: "Forced", Forced: true, Size: 10},
+		{ID: 3, Language: "eng", Name: "English SDH", SDH: true, Size: 300},
+		{ID: 4, Language: "ger", Default: true, Size: 50},
+		{ID: 5, Language: "ger", Size: 80},
+	}
+}
+
+func candidateIDs(t *testing.T, policy TrackPolicy) []uint64 {
+	candidates, err := policy.Candidates(createTestTracks())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var ids []uint64
+	for _, c := range candidates {
+		ids = append(ids, c.ID)
+	}
+	return ids
+}
+
+func TestTrackPolicyCandidates(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy TrackPolicy
+		want   []uint64
+	}{
+		{"any", TrackPolicy{}, []uint64{4, 1, 2, 3, 5}},
+		{"explicit", TrackPolicy{ID: 3, Languages: []string{"ger"}}, []uint64{3}},
+		{"bibliographic code", TrackPolicy{Languages: []string{"deu"}}, []uint64{4, 5}},
+		{"language order", TrackPolicy{Languages: []string{"fra", "eng", "deu"}}, []uint64{1, 2, 3}},
+		{"avoid forced", TrackPolicy{Languages: []string{"eng"}, Forced: TrackAvoid}, []uint64{1, 3}},
+		{"prefer forced", TrackPolicy{Languages: []string{"eng"}, Forced: TrackPrefer}, []uint64{2}},
+		{"avoid sdh", TrackPolicy{Languages: []string{"eng"}, Forced: TrackAvoid, SDH: TrackAvoid}, []uint64{1}},
+		{"prefer missing", TrackPolicy{Languages: []string{"ger"}, SDH: TrackPrefer}, []uint64{4, 5}},
+	}
+	for _, c := range cases {
+		got := candidateIDs(t, c.policy)
+		if len(got) != len(c.want) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%s: expected %v, got %v", c.name, c.want, got)
+				break
+			}
+		}
+	}
+
+	if _, err := (&TrackPolicy{Languages: []string{"jpn"}}).Candidates(createTestTracks()); err == nil {
+		t.Error("Expected error without tracks of the language")
+	}
+	if _, err := (&TrackPolicy{ID: 9}).Candidates(createTestTracks()); err == nil {
+		t.Error("Expected error for missing track")
+	}
+}
+
+func TestTrackPolicySelect(t *testing.T) {
+	policy := TrackPolicy{Languages: []string{"eng"}, Forced: TrackAvoid, Largest: true}
+	candidates, _ := policy.Candidates(createTestTracks())
+	if got := policy.Select(candidates); got.ID != 3 {
+		t.Errorf("Expected largest track 3, got %d", got.ID)
+	}
+	policy = TrackPolicy{Languages: []string{"ger"}}
+	candidates, _ = policy.Candidates(createTestTracks())
+	if got := policy.Select(candidates); got.ID != 4 {
+		t.Errorf("Expected default track 4, got %d", got.ID)
+	}
+}
+
+func TestLanguageCodes(t *testing.T) {
+	for _, lang := range []string{"deu", "ger", "deu_latf", "GER"} {
+		if codes := LanguageCodes(lang); len(codes) != 2 || codes[0] != "deu" || codes[1] != "ger" {
+			t.Errorf("Expected deu and ger for %s, got %v", lang, codes)
+		}
+	}
+	if codes := LanguageCodes("chi_sim"); len(codes) != 2 || codes[1] != "chi" {
+		t.Errorf("Expected zho and chi, got %v", codes)
+	}
+	if codes := LanguageCodes("eng"); len(codes) != 1 || codes[0] != "eng" {
+		t.Errorf("Expected eng, got %v", codes)
+	}
+}
+
+func TestSelectTrack_MKV(t *testing.T) {
+	d, err := OpenDemuxer(bufio.NewReader(bytes.NewReader(createTestMKV(t))))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	tracks := d.SubtitleTracks()
+	if len(tracks) != 2 || !tracks[0].Forced || tracks[0].Language != "ger" {
+		t.Fatalf("Unexpected tracks %+v", tracks)
+	}
+	track, pgs, err := SelectTrack(d, TrackPolicy{Languages: []string{"deu"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if track.ID != 2 || len(pgs.Sections) != 2 {
+		t.Errorf("Expected track 2 with 2 display sets, got %d with %d", track.ID, len(pgs.Sections))
+	}
+
+	sup, err := OpenDemuxer(bufio.NewReader(bytes.NewReader([]byte("PG\x00\x00"))))
+	if sup != nil || err != nil {
+		t.Errorf("Expected no demuxer for SUP input, got %v, %v", sup, err)
+	}
+}
+
+func TestValidateTrackPreference(t *testing.T) {
+	for _, pref := range []string{"", TrackAny, TrackPrefer, TrackAvoid} {
+		if err := ValidateTrackPreference(pref); err != nil {
+			t.Errorf("Expected %q to be valid, got: %v", pref, err)
+		}
+	}
+	if err := ValidateTrackPreference("only"); err == nil {
+		t.Error("Expected error for unknown preference")
+	}
+}
+
+func TestTrackSuffixes(t *testing.T) {
+	tracks := []SubtitleTrack{
+		{Language: "eng"},
+		{Language: "eng", Forced: true},
+		{Language: "ENG"},
+		{Language: "eng", SDH: true},
+		{},
+	}
+	want := []string{"eng", "eng.forced", "eng.2", "eng.sdh", "und"}
+	for i, got := range TrackSuffixes(tracks, false) {
+		if got != want[i] {
+			t.Errorf("Expected suffix %d to be %s, got %s", i, want[i], got)
+		}
+	}
+	// The forced output of the first track takes eng.forced
+	want = []string{"eng", "eng.forced.2", "eng.2", "eng.sdh", "und"}
+	for i, got := range TrackSuffixes(tracks, true) {
+		if got != want[i] {
+			t.Errorf("Expected suffix %d with forced outputs to be %s, got %s", i, want[i], got)
+		}
+	}
+}
+
+func TestTrackOCRLanguages(t *testing.T) {
+	if got := TrackOCRLanguages(SubtitleTrack{Language: "ger"}, "eng+deu_latf"); got != "deu_latf" {
+		t.Errorf("Expected deu_latf, got %s", got)
+	}
+	if got := TrackOCRLanguages(SubtitleTrack{Language: "jpn"}, "eng+deu"); got != "eng+deu" {
+		t.Errorf("Expected all languages, got %s", got)
+	}
+}
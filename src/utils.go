@@ -2,6 +2,7 @@ package suptext
 
 import (
     "bufio"
+    "context"
     "encoding/binary"
     "fmt"
     "io"
@@ -9,121 +10,261 @@ import (
     "time"
 )
 
+// SegmentSource yields PGS segment headers and their undecoded data in stream order,
+// returning io.EOF after the last segment
+type SegmentSource interface {
+    NextSegment() (Section, []byte, error)
+}
+
+// SUPReader reads the segments of a SUP file
+type SUPReader struct {
+    r *bufio.Reader
+}
+
+func NewSUPReader(r *bufio.Reader) *SUPReader {
+    return &SUPReader{r: r}
+}
+
+func (s *SUPReader) NextSegment() (Section, []byte, error) {
+    // Read section header bytes
+    bytes := make([]byte, SegmentHeaderSize)
+    if _, err := io.ReadFull(s.r, bytes); err != nil {
+        return Section{}, nil, err
+    }
+    // Parse section header
+    section, err := NewSection(bytes)
+    if err != nil {
+        return section, nil, err
+    }
+    if 0 == section.Size {
+        return section, nil, nil
+    }
+    // Read section data bytes
+    section_data := make([]byte, section.Size)
+    if _, err := io.ReadFull(s.r, section_data); err != nil {
+        return section, nil, err
+    }
+    return section, section_data, nil
+}
+
 func ReadPGS(r *bufio.Reader) (PGS, error) {
-    pgs := PGS{}
-    ds := DisplaySet{}
-    var running_ods *ObjectData
+    return ReadSegments(NewSUPReader(r))
+}
+
+// ReadPGSContext is ReadPGS returning the display sets read so far and ctx.Err() once ctx is done
+func ReadPGSContext(ctx context.Context, r *bufio.Reader) (PGS, error) {
+    return ReadSegmentsContext(ctx, NewSUPReader(r))
+}
 
+// ReadPGSProgress is ReadPGSContext counting the segments and display sets read in progress
+func ReadPGSProgress(ctx context.Context, r *bufio.Reader, progress *ProgressTracker) (PGS, error) {
+    return readSegments(ctx, NewSUPReader(r), progress)
+}
+
+// ReadSegments decodes the segments of src into display sets
+func ReadSegments(src SegmentSource) (PGS, error) {
+    return ReadSegmentsContext(context.Background(), src)
+}
+
+// ReadSegmentsContext is ReadSegments returning the complete display sets read so far and
+// ctx.Err() once ctx is done
+func ReadSegmentsContext(ctx context.Context, src SegmentSource) (PGS, error) {
+    return readSegments(ctx, src, nil)
+}
+
+func readSegments(ctx context.Context, src SegmentSource, progress *ProgressTracker) (PGS, error) {
+    b := &PGSBuilder{Progress: progress}
     for {
-        // Read section header bytes
-        bytes := make([]byte, SegmentHeaderSize)
-        if _, err := io.ReadFull(r, bytes); err != nil {
-            if err == io.EOF {
-                break
-            }
-            return pgs, err
+        if err := ctx.Err(); err != nil {
+            return b.pgs, err
+        }
+        section, data, err := src.NextSegment()
+        if err == io.EOF {
+            break
         }
-        // Parse section header
-        section, err := NewSection(bytes)
         if err != nil {
-            return pgs, err
-        }
-        // If section has no data, add as is
-        if 0 == section.Size {
-            ds.END = section
-            // Validate window-composition linkage before appending
-            ds.ValidateWindowCompositionLinkage()
-            pgs.Sections = append(pgs.Sections, ds)
-            ds = DisplaySet{}
-            continue
-        }
-        // Read section data bytes
-        section_data := make([]byte, section.Size)
-        if _, err := io.ReadFull(r, section_data); err != nil {
-            return pgs, err
-        }
-        // Parse section data
-        if section.Type == PCS {
-            data, err := NewPresentationData(section_data)
-            if err != nil {
-                return pgs, err
-            }
-            section.Data = data
-            ds.PCS = section
-        } else if section.Type == WDS {
-            // Get screen dimensions from PCS if available, otherwise use defaults
-            screenWidth, screenHeight := ds.GetScreenDimensions()
-            data, err := NewWindowsDataWithBounds(section_data, screenWidth, screenHeight)
-            if err != nil {
-                log.Printf("Warning: Failed to parse WDS section at PTS %d: %v", section.PTS, err)
-                // Continue processing instead of returning error
-                continue
-            }
-            section.Data = data
-            ds.WDS = section
-            // Validate linkage if we now have both PCS and WDS
-            if ds.PCS.Data != nil {
-                ds.ValidateWindowCompositionLinkage()
-            }
-        } else if section.Type == PDS {
-            data, err := NewPaletteData(section_data)
-            if err != nil {
-                return pgs, err
-            }
-            section.Data = data
-            ds.PDS = section
-        } else if section.Type == ODS {
-            data, err := NewObjectData(section_data)
+            return b.pgs, err
+        }
+        if err := b.Add(section, data); err != nil {
+            return b.pgs, err
+        }
+    }
+    return b.Finish(), nil
+}
+
+// contextReader fails reads once its context is done
+type contextReader struct {
+    ctx context.Context
+    r io.Reader
+}
+
+// NewContextReader returns a reader of r failing with ctx.Err() once ctx is done, so that
+// containers read from it stop early
+func NewContextReader(ctx context.Context, r io.Reader) io.Reader {
+    return &contextReader{ctx: ctx, r: r}
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+    if err := c.ctx.Err(); err != nil {
+        return 0, err
+    }
+    return c.r.Read(p)
+}
+
+// trackSegmentHook returns hook called with track, nil if hook is nil
+func trackSegmentHook(hook func(track uint64, section Section, data []byte), track uint64) func(Section, []byte) {
+    if hook == nil {
+        return nil
+    }
+    return func(section Section, data []byte) {
+        hook(track, section, data)
+    }
+}
+
+// PGSBuilder groups decoded segments into display sets
+type PGSBuilder struct {
+    // Counts the segments and display sets added if not nil
+    Progress *ProgressTracker
+    // Called with each segment before it's decoded if not nil
+    OnSegment func(section Section, data []byte)
+    pgs PGS
+    ds DisplaySet
+    running_ods *ObjectData
+}
+
+// Add decodes a segment and adds it to the current display set
+func (b *PGSBuilder) Add(section Section, section_data []byte) error {
+    b.Progress.Segment()
+    if b.OnSegment != nil {
+        b.OnSegment(section, section_data)
+    }
+    // If section has no data, add as is
+    if 0 == section.Size {
+        b.ds.END = section
+        // Validate window-composition linkage before appending
+        b.ds.ValidateWindowCompositionLinkage()
+        b.pgs.Sections = append(b.pgs.Sections, b.ds)
+        b.Progress.DisplaySet()
+        b.ds = DisplaySet{}
+        return nil
+    }
+    // Parse section data
+    if section.Type == PCS {
+        data, err := NewPresentationData(section_data)
+        if err != nil {
+            return err
+        }
+        section.Data = data
+        b.ds.PCS = section
+    } else if section.Type == WDS {
+        // Get screen dimensions from PCS if available, otherwise use defaults
+        screenWidth, screenHeight := b.ds.GetScreenDimensions()
+        data, err := NewWindowsDataWithBounds(section_data, screenWidth, screenHeight)
+        if err != nil {
+            log.Printf("Warning: Failed to parse WDS section at PTS %d: %v", section.PTS, err)
+            // Continue processing instead of returning error
+            return nil
+        }
+        section.Data = data
+        b.ds.WDS = section
+        // Validate linkage if we now have both PCS and WDS
+        if b.ds.PCS.Data != nil {
+            b.ds.ValidateWindowCompositionLinkage()
+        }
+    } else if section.Type == PDS {
+        data, err := NewPaletteData(section_data)
+        if err != nil {
+            return err
+        }
+        section.Data = data
+        b.ds.PDS = section
+    } else if section.Type == ODS {
+        data, err := NewObjectData(section_data)
+        if err != nil {
+            log.Printf("Warning: Failed to parse ODS section at PTS %d: %v", section.PTS, err)
+            // Continue processing instead of returning error
+            return nil
+        }
+        // Merge to previous ODS if it wasn't ended
+        if b.running_ods != nil {
+            err = b.running_ods.MergeSequence(data)
             if err != nil {
-                log.Printf("Warning: Failed to parse ODS section at PTS %d: %v", section.PTS, err)
-                // Continue processing instead of returning error
-                continue
-            }
-            // Merge to previous ODS if it wasn't ended
-            if running_ods != nil {
-                err = running_ods.MergeSequence(data)
-                if err != nil {
-                    log.Printf("Warning: Failed to merge ODS sequence at PTS %d: %v", section.PTS, err)
-                    // Continue with new ODS instead of failing
-                    if !data.Ended {
-                        running_ods = &data
-                    } else {
-                        section.Data = data
-                        ds.ODS = append(ds.ODS, section)
-                        running_ods = nil
-                    }
-                    continue
+                log.Printf("Warning: Failed to merge ODS sequence at PTS %d: %v", section.PTS, err)
+                // Continue with new ODS instead of failing
+                if !data.Ended {
+                    b.running_ods = &data
+                } else {
+                    section.Data = data
+                    b.ds.ODS = append(b.ds.ODS, section)
+                    b.running_ods = nil
                 }
-                // If ODS now ended, add it to DS
-                if running_ods.Ended {
-                    section.Data = *running_ods
-                    ds.ODS = append(ds.ODS, section)
-                    running_ods = nil
-                }
-            } else if !data.Ended {
-                running_ods = &data
-            } else {
-                section.Data = data
-                ds.ODS = append(ds.ODS, section)
+                return nil
+            }
+            // If ODS now ended, add it to DS
+            if b.running_ods.Ended {
+                section.Data = *b.running_ods
+                b.ds.ODS = append(b.ds.ODS, section)
+                b.running_ods = nil
             }
+        } else if !data.Ended {
+            b.running_ods = &data
         } else {
-            return pgs, fmt.Errorf("Segment type not supported: 0x%x", section.Type)
+            section.Data = data
+            b.ds.ODS = append(b.ds.ODS, section)
         }
+    } else {
+        return fmt.Errorf("Segment type not supported: 0x%x", section.Type)
     }
+    return nil
+}
 
+// AddPacket adds the segments of a container packet, which are stored without the magic and
+// timestamps of SUP segment headers: <type> <size> <data>
+func (b *PGSBuilder) AddPacket(packet []byte, pts, dts uint32) error {
+    for len(packet) > 0 {
+        if len(packet) < 3 {
+            log.Printf("Warning: Truncated segment header at PTS %d", pts)
+            return nil
+        }
+        section := Section{
+            PTS: pts,
+            DTS: dts,
+            Type: packet[0],
+            Size: binary.BigEndian.Uint16(packet[1:3]),
+        }
+        end := 3 + int(section.Size)
+        if end > len(packet) {
+            log.Printf("Warning: Truncated segment 0x%x at PTS %d", section.Type, pts)
+            return nil
+        }
+        var data []byte
+        if section.Size > 0 {
+            data = packet[3:end]
+        }
+        if err := b.Add(section, data); err != nil {
+            return err
+        }
+        packet = packet[end:]
+    }
+    return nil
+}
+
+// Finish appends the last display set if its END segment is missing and returns the display sets
+func (b *PGSBuilder) Finish() PGS {
+    ds := b.ds
     // EOF reached: append last DisplaySet if END marker was missing
     // Also merge any incomplete ODS sequences
-    if running_ods != nil {
-        log.Printf("Warning: Incomplete ODS ID %d at EOF - merging into current DisplaySet", running_ods.ID)
+    if b.running_ods != nil {
+        log.Printf("Warning: Incomplete ODS ID %d at EOF - merging into current DisplaySet", b.running_ods.ID)
         section := Section{
             PTS: ds.PCS.PTS, // Use PCS PTS as fallback
             DTS: ds.PCS.DTS,
             Type: ODS,
-            Size: uint16(running_ods.BytesRead),
-            Data: *running_ods,
+            Size: uint16(b.running_ods.BytesRead),
+            Data: *b.running_ods,
         }
         ds.ODS = append(ds.ODS, section)
-        running_ods = nil
+        b.running_ods = nil
     }
     
     if ds.END.Type != END &&
@@ -133,10 +274,10 @@ func ReadPGS(r *bufio.Reader) (PGS, error) {
          len(ds.ODS) > 0) {
         // Validate window-composition linkage before appending
         ds.ValidateWindowCompositionLinkage()
-        pgs.Sections = append(pgs.Sections, ds)
+        b.pgs.Sections = append(b.pgs.Sections, ds)
     }
-
-    return pgs, nil
+    b.ds = DisplaySet{}
+    return b.pgs
 }
 
 func NewSection(bytes []byte) (Section, error) {
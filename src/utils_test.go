@@ -3,6 +3,7 @@ package suptext
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
 	"testing"
 )
@@ -302,3 +303,22 @@ func TestFormatMilliseconds(t *testing.T) {
 	}
 }
 
+
+func TestReadPGSContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pgs, err := ReadPGSContext(ctx, bufio.NewReader(bytes.NewReader(createTestSUP(1000, 3000))))
+	if err != context.Canceled || len(pgs.Sections) != 0 {
+		t.Errorf("Expected context.Canceled without display sets, got %v and %d sets", err, len(pgs.Sections))
+	}
+	pgs, err = ReadPGSContext(context.Background(), bufio.NewReader(bytes.NewReader(createTestSUP(1000, 3000))))
+	if err != nil || len(pgs.Sections) != 2 {
+		t.Errorf("Expected 2 display sets, got %v and %d sets", err, len(pgs.Sections))
+	}
+
+	// Containers read through a context reader stop too
+	r := NewContextReader(ctx, bytes.NewReader(createTestMKV(t)))
+	if _, err := r.Read(make([]byte, 16)); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package suptext
+
+import (
+    "fmt"
+)
+
+// Problem is a structural error of a display set that loses or garbles its subtitle
+type Problem struct {
+    Set int // Index of the display set in PGS.Sections
+    PTS uint32
+    Message string
+}
+
+func (p Problem) String() string {
+    return fmt.Sprintf("display set %d at %s: %s", p.Set, FormatMilliseconds(p.PTS), p.Message)
+}
+
+// Validate checks every display set for missing segments, objects, windows and palettes the
+// composition needs, and objects that fail to decode
+func (p *PGS) Validate() []Problem {
+    var problems []Problem
+    var last uint32
+    for i := range p.Sections {
+        ds := &p.Sections[i]
+        add := func(format string, args ...interface{}) {
+            problems = append(problems, Problem{Set: i, PTS: ds.PCS.PTS, Message: fmt.Sprintf(format, args...)})
+        }
+        pcs, ok := ds.PCS.Data.(PresentationCompositionData)
+        if ds.PCS.Type != PCS || !ok {
+            add("missing PCS segment")
+            continue
+        }
+        if ds.END.Type != END {
+            add("missing END segment")
+        }
+        if i > 0 && ds.PCS.PTS < last {
+            add("PTS goes back from %s", FormatMilliseconds(last))
+        }
+        last = ds.PCS.PTS
+
+        objects := map[uint16]ObjectData{}
+        for _, ods := range ds.ODS {
+            obj, ok := ods.Data.(ObjectData)
+            if !ok {
+                continue
+            }
+            objects[obj.ID] = obj
+            if !obj.Ended {
+                add("object %d is incomplete, %d of %d bytes", obj.ID, obj.BytesRead, obj.Length)
+                continue
+            }
+            if obj.Width == 0 || obj.Height == 0 {
+                add("object %d has invalid dimensions %dx%d", obj.ID, obj.Width, obj.Height)
+                continue
+            }
+            if _, err := RLEDecode(obj.Data); err != nil {
+                add("object %d fails to decode: %v", obj.ID, err)
+            }
+        }
+
+        // Only epoch starts are recognized, from their own segments
+        if !ds.IsEpochStart() || len(pcs.Comps) == 0 {
+            continue
+        }
+        windows, _ := ds.WDS.Data.(WindowsData)
+        for _, comp := range pcs.Comps {
+            if _, ok := objects[comp.ObjID]; !ok {
+                add("composition references missing object %d", comp.ObjID)
+            }
+            found := ds.WDS.Data == nil
+            for _, w := range windows.Windows {
+                found = found || w.WinID == comp.WinID
+            }
+            if !found {
+                add("composition of object %d references missing window %d", comp.ObjID, comp.WinID)
+            }
+        }
+        if _, ok := ds.PDS.Data.(PaletteData); !ok {
+            add("missing PDS segment")
+        }
+    }
+    return problems
+}
@@ -0,0 +1,32 @@
+package suptext
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPGSValidate(t *testing.T) {
+	valid := createTestDisplaySet(1000)
+	valid.END = Section{PTS: 1000, Type: END}
+	if problems := (&PGS{Sections: []DisplaySet{valid}}).Validate(); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+
+	missing := createTestDisplaySet(500)
+	missing.PDS = Section{}
+	missing.ODS[0].Data = ObjectData{ID: 2, Width: 2, Height: 2, Ended: true, Data: []byte{0x01}}
+	pgs := PGS{Sections: []DisplaySet{valid, missing, {END: Section{Type: END}}}}
+	problems := pgs.Validate()
+	expected := []string{"missing END", "PTS goes back", "fails to decode", "missing object 1", "missing PDS", "missing PCS"}
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got %v", len(expected), problems)
+	}
+	for i, p := range problems {
+		if !strings.Contains(p.Message, expected[i]) {
+			t.Errorf("Expected problem %d to be %q, got %q", i, expected[i], p.Message)
+		}
+	}
+	if problems[0].Set != 1 || problems[0].PTS != 500 {
+		t.Errorf("Expected problem of display set 1 at 500, got %+v", problems[0])
+	}
+}
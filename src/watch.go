@@ -0,0 +1,185 @@
+package suptext
+
+import (
+    "context"
+    "io/fs"
+    "log"
+    "path/filepath"
+    "strings"
+    "time"
+)
+
+// Default watcher timings
+const (
+    DefaultWatchStable = 5 * time.Second
+    DefaultWatchInterval = 2 * time.Second
+)
+
+// notifier wakes the watcher when watched directories change
+type notifier interface {
+    Add(dir string) error
+    Events() <-chan struct{}
+    Close() error
+}
+
+// Watcher reports the SUP files, videos and Blu-ray folders dropped into directories, once their
+// size and modification time stop changing. Changes are noticed through inotify on Linux,
+// otherwise and with Poll by scanning every Interval.
+type Watcher struct {
+    Dirs []string
+    // Folders below Dirs whose inputs aren't reported, e.g. where converted inputs are moved
+    Ignore []string
+    // Time an input must stay unchanged before it's reported
+    Stable time.Duration
+    Interval time.Duration
+    Poll bool
+}
+
+// inputState is the size and latest modification of an input, summed over the files of folders
+type inputState struct {
+    Size int64
+    ModTime time.Time
+}
+
+// watchedInput is an input waiting to become stable, or reported
+type watchedInput struct {
+    state inputState
+    since time.Time
+    reported bool
+}
+
+// Run reports every stable input with the directory it was found in to found until ctx is done.
+// Inputs are reported again once they change, inputs present when Run starts are reported too.
+func (w *Watcher) Run(ctx context.Context, found func(dir string, path string)) error {
+    stable, interval := w.Stable, w.Interval
+    if stable <= 0 {
+        stable = DefaultWatchStable
+    }
+    if interval <= 0 {
+        interval = DefaultWatchInterval
+    }
+    var n notifier
+    var events <-chan struct{}
+    if !w.Poll {
+        var err error
+        if n, err = newNotifier(); err != nil {
+            log.Printf("Warning: Polling directories every %v: %v", interval, err)
+            n = nil
+        } else {
+            defer n.Close()
+            events = n.Events()
+            for _, dir := range w.Dirs {
+                if err := addWatches(n, dir); err != nil {
+                    return err
+                }
+            }
+            // New files are noticed at once, stable checks only need a tick per stable time
+            if stable / 2 > interval {
+                interval = stable / 2
+            }
+        }
+    }
+
+    inputs := map[string]*watchedInput{}
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        now := time.Now()
+        seen := map[string]bool{}
+        for _, dir := range w.Dirs {
+            paths, err := FindInputs(dir)
+            if err != nil {
+                log.Printf("Warning: Failed to scan %s: %v", dir, err)
+            }
+            for _, path := range paths {
+                if w.ignored(path) {
+                    continue
+                }
+                seen[path] = true
+                state, err := readInputState(path)
+                if err != nil {
+                    continue
+                }
+                in, ok := inputs[path]
+                if !ok || in.state != state {
+                    inputs[path] = &watchedInput{state: state, since: now}
+                    continue
+                }
+                if !in.reported && now.Sub(in.since) >= stable {
+                    in.reported = true
+                    found(dir, path)
+                }
+            }
+        }
+        for path := range inputs {
+            if !seen[path] {
+                delete(inputs, path)
+            }
+        }
+
+        // Wait for changes, or the next check of unstable inputs
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-ticker.C:
+        case _, ok := <-events:
+            if !ok {
+                log.Printf("Warning: Polling directories every %v, notifications stopped", interval)
+                events = nil
+                continue
+            }
+            // Watch the folders created since
+            for _, dir := range w.Dirs {
+                addWatches(n, dir)
+            }
+        }
+    }
+}
+
+// ignored returns whether path is in one of the ignored folders
+func (w *Watcher) ignored(path string) bool {
+    for _, dir := range w.Ignore {
+        if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".." + string(filepath.Separator)) {
+            return true
+        }
+    }
+    return false
+}
+
+// readInputState returns the state of a file, or of the files of a folder
+func readInputState(path string) (inputState, error) {
+    var state inputState
+    err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+        if err != nil {
+            return err
+        }
+        info, err := d.Info()
+        if err != nil {
+            return err
+        }
+        if !d.IsDir() {
+            state.Size += info.Size()
+        }
+        if info.ModTime().After(state.ModTime) {
+            state.ModTime = info.ModTime()
+        }
+        return nil
+    })
+    return state, err
+}
+
+// addWatches watches dir and its subdirectories, new folders are watched on the next change
+func addWatches(n notifier, dir string) error {
+    return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+        if err != nil {
+            if p == dir {
+                return err
+            }
+            return nil
+        }
+        if d.IsDir() {
+            return n.Add(p)
+        }
+        return nil
+    })
+}
@@ -0,0 +1,77 @@
+//go:build linux
+
+package suptext
+
+import (
+    "os"
+    "sync"
+    "syscall"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_MOVED_TO |
+    syscall.IN_MOVED_FROM | syscall.IN_DELETE | syscall.IN_ATTRIB
+
+// inotify wakes the watcher on any event of the watched directories
+type inotify struct {
+    f *os.File
+    // Descriptor of f for adding watches, f.Fd() would make f blocking and its Read uncloseable
+    fd int
+    events chan struct{}
+    mu sync.Mutex
+    watched map[string]bool
+    closed bool
+}
+
+func newNotifier() (notifier, error) {
+    fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+    if err != nil {
+        return nil, os.NewSyscallError("inotify_init1", err)
+    }
+    // Non-blocking files are read through the runtime poller, Close ends a pending Read
+    n := &inotify{f: os.NewFile(uintptr(fd), "inotify"), fd: fd, events: make(chan struct{}, 1), watched: map[string]bool{}}
+    go n.read()
+    return n, nil
+}
+
+func (n *inotify) read() {
+    buf := make([]byte, 64 * (syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1))
+    for {
+        if _, err := n.f.Read(buf); err != nil {
+            close(n.events)
+            return
+        }
+        // Events only wake the watcher, which scans the directories
+        select {
+        case n.events <- struct{}{}:
+        default:
+        }
+    }
+}
+
+func (n *inotify) Add(dir string) error {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    if n.closed {
+        return os.ErrClosed
+    }
+    if n.watched[dir] {
+        return nil
+    }
+    if _, err := syscall.InotifyAddWatch(n.fd, dir, inotifyMask); err != nil {
+        return os.NewSyscallError("inotify_add_watch", err)
+    }
+    n.watched[dir] = true
+    return nil
+}
+
+func (n *inotify) Events() <-chan struct{} {
+    return n.events
+}
+
+func (n *inotify) Close() error {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    // The descriptor may be reused once closed
+    n.closed = true
+    return n.f.Close()
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package suptext
+
+import (
+    "errors"
+)
+
+func newNotifier() (notifier, error) {
+    return nil, errors.New("inotify is only available on Linux")
+}
@@ -0,0 +1,103 @@
+package suptext
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testWatcher(t *testing.T, poll bool) {
+	dir := t.TempDir()
+	w := &Watcher{Dirs: []string{dir}, Ignore: []string{filepath.Join(dir, "done")}, Stable: 100 * time.Millisecond, Interval: 20 * time.Millisecond, Poll: poll}
+	found := make(chan string, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- w.Run(ctx, func(root string, path string) {
+			if root != dir {
+				t.Errorf("Expected %s to be found in %s, got %s", path, dir, root)
+			}
+			found <- path
+		})
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Errorf("Expected context.Canceled, got: %v", err)
+		}
+	}()
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case path := <-found:
+			if path != want {
+				t.Fatalf("Expected %s, got %s", want, path)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("Expected %s to be reported", want)
+		}
+	}
+	sup := filepath.Join(dir, "new", "a.sup")
+	os.MkdirAll(filepath.Dir(sup), 0755)
+	if err := os.WriteFile(sup, []byte("PG"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "a.srt"), nil, 0644)
+	os.MkdirAll(filepath.Join(dir, "done"), 0755)
+	os.WriteFile(filepath.Join(dir, "done", "b.sup"), nil, 0644)
+	expect(sup)
+
+	// Reported once until it changes
+	select {
+	case path := <-found:
+		t.Fatalf("Expected no report, got %s", path)
+	case <-time.After(300 * time.Millisecond):
+	}
+	if err := os.WriteFile(sup, []byte("PGPG"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect(sup)
+}
+
+func TestWatcherPoll(t *testing.T) {
+	testWatcher(t, true)
+}
+
+func TestWatcherNotify(t *testing.T) {
+	testWatcher(t, false)
+}
+
+func TestNotifierClose(t *testing.T) {
+	n, err := newNotifier()
+	if err != nil {
+		t.Skip(err)
+	}
+	dir := t.TempDir()
+	if err := n.Add(dir); err != nil {
+		t.Fatal(err)
+	}
+	// The read after the first event waits until closing
+	os.WriteFile(filepath.Join(dir, "a.sup"), nil, 0644)
+	select {
+	case <-n.Events():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected an event")
+	}
+	time.Sleep(50 * time.Millisecond)
+	n.Close()
+	// Closing ends the pending read, which closes the events after those already buffered
+	timeout := time.After(2 * time.Second)
+	for open := true; open; {
+		select {
+		case _, open = <-n.Events():
+		case <-timeout:
+			t.Fatal("Expected closing to end the read")
+		}
+	}
+	if err := n.Add(t.TempDir()); err == nil {
+		t.Error("Expected adding to a closed notifier to fail")
+	}
+}
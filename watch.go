@@ -0,0 +1,249 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "fmt"
+    "log"
+    "os"
+    "os/signal"
+    "path/filepath"
+    "strings"
+    "sync"
+    "syscall"
+    "time"
+    "github.com/eliaonceagain/suptext/src"
+)
+
+// Watch events, printed as JSON lines
+const (
+    eventFound = "found"
+    eventStarted = "started"
+    eventConverted = "converted"
+    eventSkipped = "skipped"
+    eventFailed = "failed"
+    eventCancelled = "cancelled"
+    eventMoved = "moved"
+)
+
+// watchEvent is a line of the watch log
+type watchEvent struct {
+    Time time.Time `json:"time"`
+    Event string `json:"event"`
+    Path string `json:"path"`
+    // Where a moved file went
+    Dest string `json:"dest,omitempty"`
+    Outputs []string `json:"outputs,omitempty"`
+    Cues int `json:"cues,omitempty"`
+    OCRErrors int `json:"ocr_errors,omitempty"`
+    Warnings []string `json:"warnings,omitempty"`
+    Error string `json:"error,omitempty"`
+    Code int `json:"code,omitempty"`
+    DurationMs int64 `json:"duration_ms,omitempty"`
+}
+
+// watchJob is an input found in a watched directory
+type watchJob struct {
+    Dir string
+    Path string
+}
+
+// watcher converts the inputs found in watched directories and moves them once converted
+type watcher struct {
+    c *conversion
+    // Directories mirroring the watched ones, empty to leave files where they are
+    Output string
+    Done string
+    Failed string
+    queue chan watchJob
+    mu sync.Mutex
+    enc *json.Encoder
+    // Inputs queued or converting, true if they changed meanwhile
+    pending map[string]bool
+}
+
+// watchCommand converts the inputs dropped into directories until interrupted
+func watchCommand(args []string) {
+    fs := newFlagSet("watch", "<dir>...")
+    flags := addConvertFlags(fs)
+    done := fs.String("done", "", "Move converted inputs to this directory, with their subtitle files unless -output is set")
+    failed := fs.String("failed", "", "Move inputs that failed to convert to this directory")
+    stable := fs.Float64("stable", suptext.DefaultWatchStable.Seconds(), "Seconds an input must stay unchanged before it's converted")
+    interval := fs.Float64("interval", suptext.DefaultWatchInterval.Seconds(), "Seconds between scans of the directories")
+    poll := fs.Bool("poll", false, "Scan the directories instead of using inotify")
+    fs.Parse(args)
+    if fs.NArg() == 0 {
+        fs.Usage()
+        os.Exit(exitUsage)
+    }
+    if flags.Output == "-" {
+        fatal(exitUsage, "watch can't write to stdout")
+    }
+    if *stable < 0 || *interval <= 0 {
+        fatal(exitUsage, "--stable and --interval must be positive")
+    }
+    for _, dir := range fs.Args() {
+        if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+            fatalf(exitUsage, "watch needs directories, got %s", dir)
+        }
+    }
+    c := flags.conversion(overwriteOlder)
+    if !suptext.TesseractSupported && (c.Opts.Engine == "" || c.Opts.Engine == suptext.EngineTesseract) {
+        fatal(exitOCR, suptext.ErrNoTesseract)
+    }
+
+    w := &watcher{c: c, Output: flags.Output, Done: *done, Failed: *failed, queue: make(chan watchJob),
+        enc: json.NewEncoder(os.Stdout), pending: map[string]bool{}}
+    wt := &suptext.Watcher{
+        Dirs: fs.Args(),
+        Stable: time.Duration(*stable * float64(time.Second)),
+        Interval: time.Duration(*interval * float64(time.Second)),
+        Poll: *poll,
+    }
+    for _, dir := range []string{w.Output, w.Done, w.Failed} {
+        if dir == "" {
+            continue
+        }
+        if err := os.MkdirAll(dir, 0755); err != nil {
+            fatal(exitIO, err)
+        }
+        wt.Ignore = append(wt.Ignore, dir)
+    }
+
+    // Inputs run in parallel instead of their tracks, like batches
+    c.Jobs = 1
+    jobs := flags.Jobs
+    if jobs <= 0 || c.Opts.TrainGlyphs {
+        jobs = 1
+    }
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    var wg sync.WaitGroup
+    for i := 0; i < jobs; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            w.work(ctx)
+        }()
+    }
+    log.Printf("Watching %s with %d jobs", strings.Join(wt.Dirs, ", "), jobs)
+    err := wt.Run(ctx, func(dir string, path string) {
+        w.found(ctx, watchJob{Dir: dir, Path: path})
+    })
+    // A second signal kills at once
+    stop()
+    close(w.queue)
+    if ctx.Err() == nil {
+        wg.Wait()
+        fatal(exitIO, err)
+    }
+    log.Printf("Stopping, waiting for running conversions")
+    wg.Wait()
+}
+
+// found queues an input unless it's already queued or converting
+func (w *watcher) found(ctx context.Context, job watchJob) {
+    w.mu.Lock()
+    if _, ok := w.pending[job.Path]; ok {
+        w.pending[job.Path] = true
+        w.mu.Unlock()
+        return
+    }
+    w.pending[job.Path] = false
+    w.mu.Unlock()
+    w.log(watchEvent{Event: eventFound, Path: job.Path})
+    select {
+    case w.queue <- job:
+    case <-ctx.Done():
+    }
+}
+
+// work converts queued inputs until the queue is closed, inputs still queued once ctx is done are
+// left for the next run
+func (w *watcher) work(ctx context.Context) {
+    for job := range w.queue {
+        for ctx.Err() == nil && w.convert(job) {
+        }
+    }
+}
+
+// convert converts and moves an input, returning whether it changed meanwhile and needs another
+// conversion
+func (w *watcher) convert(job watchJob) bool {
+    start := time.Now()
+    w.log(watchEvent{Event: eventStarted, Path: job.Path})
+    var res result
+    dir, err := mirrorDir(job.Dir, job.Path, w.Output)
+    if err != nil {
+        err = withCode(exitIO, err)
+    } else {
+        // Running conversions finish when stopping, only their timeout cancels them
+        res, err = w.c.run(context.Background(), job.Path, dir)
+    }
+    event := watchEvent{Event: eventConverted, Path: job.Path, Outputs: res.Outputs, Cues: res.Cues,
+        OCRErrors: res.OCRErrors, Warnings: res.Warnings, DurationMs: time.Since(start).Milliseconds()}
+    switch {
+    case exitCode(err) == exitCancelled:
+        log.Printf("Cancelled converting %s: %v", job.Path, err)
+        event.Event, event.Error, event.Code = eventCancelled, err.Error(), exitCancelled
+    case err != nil:
+        log.Printf("Failed to convert %s: %v", job.Path, err)
+        event.Event, event.Error, event.Code = eventFailed, err.Error(), exitCode(err)
+    case res.Skipped:
+        event.Event = eventSkipped
+    }
+    w.log(event)
+
+    w.mu.Lock()
+    changed := w.pending[job.Path]
+    if changed {
+        w.pending[job.Path] = false
+    } else {
+        delete(w.pending, job.Path)
+    }
+    w.mu.Unlock()
+    if changed {
+        return true
+    }
+
+    switch {
+    case err != nil && w.Failed != "":
+        w.move(job.Dir, job.Path, w.Failed)
+    case err == nil && w.Done != "":
+        w.move(job.Dir, job.Path, w.Done)
+        // Subtitle files written next to the input follow it
+        if w.Output == "" {
+            for _, out := range res.Outputs {
+                w.move(job.Dir, out, w.Done)
+            }
+        }
+    }
+    return false
+}
+
+// move moves path found below dir to the same folder below dest
+func (w *watcher) move(dir string, path string, dest string) {
+    event := watchEvent{Event: eventMoved, Path: path}
+    rel, err := filepath.Rel(dir, path)
+    if err != nil {
+        rel = filepath.Base(path)
+    }
+    event.Dest = filepath.Join(dest, rel)
+    if err = os.MkdirAll(filepath.Dir(event.Dest), 0755); err == nil {
+        err = os.Rename(path, event.Dest)
+    }
+    if err != nil {
+        log.Printf("Warning: Failed to move %s: %v", path, err)
+        event.Error, event.Code = err.Error(), exitIO
+    }
+    w.log(event)
+}
+
+// log prints an event as a JSON line
+func (w *watcher) log(event watchEvent) {
+    event.Time = time.Now()
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    if err := w.enc.Encode(event); err != nil {
+        fmt.Fprintln(os.Stderr, err)
+    }
+}